@@ -0,0 +1,141 @@
+package admin
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/wavefronthq/go-proxy/common"
+)
+
+const (
+	prometheusPrefix      = "wavefront_proxy_"
+	prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var quantiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+// Samples of one Prometheus metric, all ports of an internal metric share a family.
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	samples []string
+}
+
+func (f *metricFamily) add(suffix, labels string, value float64) {
+	f.samples = append(f.samples, fmt.Sprintf("%s%s%s %s", f.name, suffix, labels,
+		strconv.FormatFloat(value, 'g', -1, 64)))
+}
+
+// metrics renders the go-metrics registry in the Prometheus text exposition format. The runtime memory
+// stats are only read here, they are captured by the agent checkin and a capture per scrape would reset
+// the deltas the checkin reports.
+func (s *Server) metrics(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", prometheusContentType)
+	writePrometheus(w, metrics.DefaultRegistry)
+}
+
+// writePrometheus writes the metrics of a registry in the Prometheus text format. The listener port in
+// a metric name becomes a port label, counters and meters become counters, gauges stay gauges and timers
+// and histograms become summaries, with timers in seconds.
+func writePrometheus(w io.Writer, registry metrics.Registry) {
+	families := make(map[string]*metricFamily)
+	family := func(name, suffix, kind, help string) *metricFamily {
+		name = prometheusName(name) + suffix
+		f, ok := families[name]
+		if !ok {
+			f = &metricFamily{name: name, kind: kind, help: help}
+			families[name] = f
+		}
+		return f
+	}
+
+	// in name order so that the samples of a family are ordered by port
+	registered := make(map[string]interface{})
+	var fullNames []string
+	registry.Each(func(fullName string, i interface{}) {
+		registered[fullName] = i
+		fullNames = append(fullNames, fullName)
+	})
+	sort.Strings(fullNames)
+
+	for _, fullName := range fullNames {
+		name, port := common.SplitPort(fullName)
+		help := name
+		labels := ""
+		if port != "" {
+			help = strings.Replace(fullName, "."+port, ".<port>", 1)
+			labels = fmt.Sprintf(`port="%s"`, port)
+		}
+
+		switch metric := registered[fullName].(type) {
+		case metrics.Counter:
+			family(name, "_total", "counter", help).add("", braces(labels), float64(metric.Count()))
+		case metrics.Meter:
+			family(name, "_total", "counter", help).add("", braces(labels), float64(metric.Count()))
+		case metrics.Gauge:
+			family(name, "", "gauge", help).add("", braces(labels), float64(metric.Value()))
+		case metrics.GaugeFloat64:
+			family(name, "", "gauge", help).add("", braces(labels), metric.Value())
+		case metrics.Timer:
+			timer := metric.Snapshot()
+			addSummary(family(name, "_seconds", "summary", help), labels, timer.Percentiles(quantiles),
+				float64(timer.Sum()), timer.Count(), 1e9)
+		case metrics.Histogram:
+			histo := metric.Snapshot()
+			addSummary(family(name, "", "summary", help), labels, histo.Percentiles(quantiles),
+				float64(histo.Sum()), histo.Count(), 1)
+		}
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := families[name]
+		fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+		for _, sample := range f.samples {
+			fmt.Fprintln(w, sample)
+		}
+	}
+}
+
+// addSummary adds the quantiles, sum and count of a timer or histogram, dividing values by scale.
+func addSummary(f *metricFamily, labels string, percentiles []float64, sum float64, count int64, scale float64) {
+	for i, q := range quantiles {
+		quantile := fmt.Sprintf(`quantile="%s"`, strconv.FormatFloat(q, 'g', -1, 64))
+		if labels != "" {
+			quantile = labels + "," + quantile
+		}
+		f.add("", braces(quantile), percentiles[i]/scale)
+	}
+	f.add("_sum", braces(labels), sum/scale)
+	f.add("_count", braces(labels), float64(count))
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+// prometheusName converts an internal metric name to a valid Prometheus name, e.g. points.received to
+// wavefront_proxy_points_received.
+func prometheusName(name string) string {
+	b := []byte(prometheusPrefix + name)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	registry := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("points.2878.received", registry).Inc(5)
+	metrics.GetOrRegisterCounter("points.4242.received", registry).Inc(7)
+	metrics.GetOrRegisterGauge("build.version", registry).Update(4001)
+	metrics.GetOrRegisterTimer("push.2878.duration", registry).Update(1500 * time.Millisecond)
+
+	var buf bytes.Buffer
+	writePrometheus(&buf, registry)
+	out := buf.String()
+
+	for _, expected := range []string{
+		"# HELP wavefront_proxy_points_received_total points.<port>.received\n" +
+			"# TYPE wavefront_proxy_points_received_total counter\n" +
+			"wavefront_proxy_points_received_total{port=\"2878\"} 5\n" +
+			"wavefront_proxy_points_received_total{port=\"4242\"} 7\n",
+		"# TYPE wavefront_proxy_build_version gauge\nwavefront_proxy_build_version 4001\n",
+		"# TYPE wavefront_proxy_push_duration_seconds summary\n",
+		"wavefront_proxy_push_duration_seconds{port=\"2878\",quantile=\"0.5\"} 1.5\n",
+		"wavefront_proxy_push_duration_seconds_sum{port=\"2878\"} 1.5\n",
+		"wavefront_proxy_push_duration_seconds_count{port=\"2878\"} 1\n",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in:\n%s", expected, out)
+		}
+	}
+}
+
+func TestPrometheusName(t *testing.T) {
+	if name := prometheusName("preprocessor.my-rule.count"); name != "wavefront_proxy_preprocessor_my_rule_count" {
+		t.Errorf("unexpected name %s", name)
+	}
+}
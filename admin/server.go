@@ -0,0 +1,184 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/wavefronthq/go-proxy/agent"
+	"github.com/wavefronthq/go-proxy/logging"
+	"github.com/wavefronthq/go-proxy/points"
+)
+
+// State of the proxy served on /status, which also decides readiness.
+type Status struct {
+	AgentID   string                  `json:"agentId"`
+	Version   string                  `json:"version"`
+	Ready     bool                    `json:"ready"`
+	NotReady  []string                `json:"notReadyReasons,omitempty"`
+	Checkin   agent.CheckinStatus     `json:"checkin"`
+	Listeners []points.ListenerStatus `json:"listeners"`
+	// configured ports without a running listener
+	UnboundPorts []int `json:"unboundPorts,omitempty"`
+}
+
+// checkReady sets Ready and the reasons the proxy is not ready: a configured port is not bound,
+// the last checkin failed or a forwarder is stuck. A proxy which has not checked in yet can be ready.
+func (s *Status) checkReady() {
+	s.NotReady = nil
+	for _, port := range s.UnboundPorts {
+		s.NotReady = append(s.NotReady, fmt.Sprintf("port %d is not bound", port))
+	}
+	if s.Checkin.Error != "" {
+		s.NotReady = append(s.NotReady, "last checkin failed: "+s.Checkin.Error)
+	}
+	for _, listener := range s.Listeners {
+		if listener.StuckForwarders > 0 {
+			s.NotReady = append(s.NotReady, fmt.Sprintf("port %d has %d stuck forwarders (last response code %d)",
+				listener.Port, listener.StuckForwarders, listener.LastResponseCode))
+		}
+	}
+	s.Ready = len(s.NotReady) == 0
+}
+
+// HTTP server for health checks, proxy status and internal metrics.
+type Server struct {
+	Addr string
+	// returns the current state of the proxy, called on every status and readiness request
+	Status func() *Status
+	// attaches a tap to the listener on a port, /tap is disabled if nil
+	Tap func(port int, filter *points.TapFilter) (*points.Tap, error)
+	// returns the client statistics of the running listeners, /clients is disabled if nil
+	Clients func() []points.ClientsStatus
+}
+
+// Start binds the server address and serves requests in the background.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Starting admin HTTP server at: %s", listener.Addr())
+	go func() {
+		if err := http.Serve(listener, s.Handler()); err != nil {
+			log.Println("Admin HTTP server error:", err)
+		}
+	}()
+	return nil
+}
+
+// Handler returns the handler serving the admin endpoints.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+	mux.HandleFunc("/status", s.status)
+	mux.HandleFunc("/metrics", s.metrics)
+	mux.HandleFunc("/loglevel", s.logLevel)
+	mux.HandleFunc("/tap", s.tap)
+	mux.HandleFunc("/clients", s.clients)
+	return mux
+}
+
+func (s *Server) currentStatus() *Status {
+	status := s.Status()
+	status.checkReady()
+	return status
+}
+
+// healthz reports that the process is alive.
+func (s *Server) healthz(w http.ResponseWriter, req *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// readyz reports whether the proxy is ready to receive points, listing the reasons if it is not.
+func (s *Server) readyz(w http.ResponseWriter, req *http.Request) {
+	status := s.currentStatus()
+	if !status.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		for _, reason := range status.NotReady {
+			fmt.Fprintln(w, reason)
+		}
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// logLevel returns the current log level, or changes it on PUT or POST with a level parameter,
+// e.g. curl -X PUT localhost:8090/loglevel?level=debug
+func (s *Server) logLevel(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		level, err := logging.ParseLevel(req.FormValue("level"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logging.SetLevel(level)
+		log.Printf("Log level set to %s", level)
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	fmt.Fprintln(w, logging.Default().Level())
+}
+
+func (s *Server) status(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, s.currentStatus())
+}
+
+// clients returns the ingestion statistics per client and open connection of each listener, ordered by
+// decreasing rate. The port parameter selects a listener and top limits the clients and connections listed.
+func (s *Server) clients(w http.ResponseWriter, req *http.Request) {
+	if s.Clients == nil {
+		http.Error(w, "client statistics not available", http.StatusNotFound)
+		return
+	}
+	port, top := 0, 0
+	var err error
+	if value := req.FormValue("port"); value != "" {
+		if port, err = strconv.Atoi(value); err != nil {
+			http.Error(w, "port: expected a listener port", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := req.FormValue("top"); value != "" {
+		if top, err = strconv.Atoi(value); err != nil || top <= 0 {
+			http.Error(w, "top: expected a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	listeners := []points.ClientsStatus{}
+	for _, listener := range s.Clients() {
+		if port != 0 && listener.Port != port {
+			continue
+		}
+		if top > 0 && len(listener.Clients) > top {
+			listener.Clients = listener.Clients[:top]
+		}
+		if top > 0 && len(listener.Connections) > top {
+			listener.Connections = listener.Connections[:top]
+		}
+		listeners = append(listeners, listener)
+	}
+	if port != 0 && len(listeners) == 0 {
+		http.Error(w, fmt.Sprintf("no listener on port %d", port), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, listeners)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Println("Error writing response:", err)
+	}
+}
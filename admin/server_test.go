@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wavefronthq/go-proxy/agent"
+	"github.com/wavefronthq/go-proxy/points"
+)
+
+func get(t *testing.T, handler http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w
+}
+
+func TestReady(t *testing.T) {
+	status := &Status{
+		AgentID:   "agent",
+		Version:   "1.0",
+		Checkin:   agent.CheckinStatus{Time: time.Now()},
+		Listeners: []points.ListenerStatus{{Port: 2878, Received: 10, LastResponseCode: 202}},
+	}
+	handler := (&Server{Status: func() *Status { return status }}).Handler()
+
+	if w := get(t, handler, "/healthz"); w.Code != http.StatusOK {
+		t.Errorf("healthz: expected 200, found %d", w.Code)
+	}
+	if w := get(t, handler, "/readyz"); w.Code != http.StatusOK {
+		t.Errorf("readyz: expected 200, found %d: %s", w.Code, w.Body)
+	}
+
+	w := get(t, handler, "/status")
+	var decoded Status
+	if err := json.Unmarshal(w.Body.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Ready || decoded.AgentID != "agent" || len(decoded.Listeners) != 1 || decoded.Listeners[0].Received != 10 {
+		t.Errorf("unexpected status %s", w.Body)
+	}
+}
+
+func TestNotReady(t *testing.T) {
+	status := &Status{
+		Checkin:      agent.CheckinStatus{Time: time.Now(), Error: "connection refused"},
+		Listeners:    []points.ListenerStatus{{Port: 2878, StuckForwarders: 2, LastResponseCode: 406}},
+		UnboundPorts: []int{4242},
+	}
+	handler := (&Server{Status: func() *Status { return status }}).Handler()
+
+	w := get(t, handler, "/readyz")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("readyz: expected 503, found %d", w.Code)
+	}
+	for _, reason := range []string{"port 4242 is not bound", "connection refused", "port 2878 has 2 stuck forwarders"} {
+		if !strings.Contains(w.Body.String(), reason) {
+			t.Errorf("readyz: expected %q in %s", reason, w.Body)
+		}
+	}
+}
+
+func TestClients(t *testing.T) {
+	handler := (&Server{Clients: func() []points.ClientsStatus {
+		return []points.ClientsStatus{
+			{Port: 2878, Clients: []points.ClientStats{{Client: "10.0.0.1", Rate: 10}, {Client: "10.0.0.2", Rate: 1}}},
+			{Port: 4242, Clients: []points.ClientStats{{Client: "10.0.0.3"}}},
+		}
+	}}).Handler()
+
+	w := get(t, handler, "/clients?port=2878&top=1")
+	var decoded []points.ClientsStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 1 || decoded[0].Port != 2878 || len(decoded[0].Clients) != 1 || decoded[0].Clients[0].Client != "10.0.0.1" {
+		t.Errorf("unexpected clients %s", w.Body)
+	}
+	if w := get(t, handler, "/clients?port=1"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a port without listener, found %d", w.Code)
+	}
+	if w := get(t, handler, "/clients"); !strings.Contains(w.Body.String(), "10.0.0.3") {
+		t.Errorf("expected all listeners, found %s", w.Body)
+	}
+}
@@ -0,0 +1,200 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wavefronthq/go-proxy/points"
+)
+
+const (
+	defaultTapDuration = time.Minute
+	maxTapDuration     = 10 * time.Minute
+	sseContentType     = "text/event-stream"
+)
+
+// tap streams the point lines passing through the listener on the port parameter, e.g.
+// curl 'localhost:8090/tap?port=2878&metric=^cpu\.&tag=env=prod&count=100'
+// The lines are selected by the metric and source regexes, tag=key=regex matchers which must all match,
+// and a sample fraction. The stream ends after duration (1m by default, at most 10m) or count lines.
+// Text streams have one line per point with the time, the outcome (accepted, rewritten or blocked),
+// the client address and the line as received, followed by the reported point for rewritten points or
+// the reason for blocked points. With format=sse or Accept: text/event-stream each event is sent as JSON.
+func (s *Server) tap(w http.ResponseWriter, req *http.Request) {
+	if s.Tap == nil {
+		http.Error(w, "tap not available", http.StatusNotFound)
+		return
+	}
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	port, err := strconv.Atoi(req.FormValue("port"))
+	if err != nil {
+		http.Error(w, "port: expected a listener port", http.StatusBadRequest)
+		return
+	}
+	filter, err := parseTapFilter(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	duration, count, err := parseTapBounds(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sse := req.FormValue("format") == "sse" || strings.Contains(req.Header.Get("Accept"), sseContentType)
+
+	t, err := s.Tap(port, filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer t.Close()
+
+	if sse {
+		w.Header().Set("Content-Type", sseContentType)
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flush(w)
+
+	timeout := time.NewTimer(duration)
+	defer timeout.Stop()
+	sent := 0
+	for count <= 0 || sent < count {
+		select {
+		case event, ok := <-t.Events():
+			if !ok {
+				writeTapEnd(w, sse, "listener closed", t.Dropped())
+				return
+			}
+			if sse {
+				writeSSEEvent(w, event)
+			} else {
+				writeTapText(w, event)
+			}
+			flush(w)
+			sent++
+		case <-timeout.C:
+			writeTapEnd(w, sse, "duration elapsed", t.Dropped())
+			return
+		case <-req.Context().Done():
+			return
+		}
+	}
+	writeTapEnd(w, sse, "count reached", t.Dropped())
+}
+
+func parseTapFilter(req *http.Request) (*points.TapFilter, error) {
+	filter := &points.TapFilter{}
+	var err error
+	if filter.Metric, err = compileParam(req, "metric"); err != nil {
+		return nil, err
+	}
+	if filter.Source, err = compileParam(req, "source"); err != nil {
+		return nil, err
+	}
+	for _, tag := range req.Form["tag"] {
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("tag: expected key=regex, found %q", tag)
+		}
+		re, err := regexp.Compile(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("tag %s: %v", kv[0], err)
+		}
+		if filter.Tags == nil {
+			filter.Tags = make(map[string]*regexp.Regexp)
+		}
+		filter.Tags[kv[0]] = re
+	}
+	if sample := req.FormValue("sample"); sample != "" {
+		rate, err := strconv.ParseFloat(sample, 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			return nil, fmt.Errorf("sample: expected a fraction between 0 and 1, found %q", sample)
+		}
+		filter.SampleRate = rate
+	}
+	return filter, nil
+}
+
+func compileParam(req *http.Request, name string) (*regexp.Regexp, error) {
+	value := req.FormValue(name)
+	if value == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return re, nil
+}
+
+func parseTapBounds(req *http.Request) (time.Duration, int, error) {
+	duration := defaultTapDuration
+	if value := req.FormValue("duration"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return 0, 0, fmt.Errorf("duration: expected a positive duration such as 30s, found %q", value)
+		}
+		duration = d
+	}
+	if duration > maxTapDuration {
+		duration = maxTapDuration
+	}
+	count := 0
+	if value := req.FormValue("count"); value != "" {
+		c, err := strconv.Atoi(value)
+		if err != nil || c <= 0 {
+			return 0, 0, errors.New("count: expected a positive number")
+		}
+		count = c
+	}
+	return duration, count, nil
+}
+
+func writeTapText(w io.Writer, event points.TapEvent) {
+	fmt.Fprintf(w, "%s %s %s %s", event.Time.Format(time.RFC3339Nano), event.Status, event.Client, event.Line)
+	switch event.Status {
+	case points.TapRewritten, points.TapDerived:
+		fmt.Fprintf(w, " => %s", event.Point)
+	case points.TapBlocked:
+		fmt.Fprintf(w, " reason=%q", event.Reason)
+	}
+	fmt.Fprintln(w)
+}
+
+func writeSSEEvent(w io.Writer, event points.TapEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Status, data)
+}
+
+// writeTapEnd tells the client why the stream ended and how many events were dropped.
+func writeTapEnd(w io.Writer, sse bool, reason string, dropped int64) {
+	if sse {
+		fmt.Fprintf(w, "event: end\ndata: {\"reason\":%q,\"dropped\":%d}\n\n", reason, dropped)
+	} else {
+		fmt.Fprintf(w, "# tap ended: %s, %d events dropped\n", reason, dropped)
+	}
+	flush(w)
+}
+
+func flush(w io.Writer) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
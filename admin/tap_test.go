@@ -0,0 +1,70 @@
+package admin
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/wavefronthq/go-proxy/points"
+)
+
+func TestTapParams(t *testing.T) {
+	req := httptest.NewRequest("GET", "/tap?port=2878&metric=^cpu&tag=env=prod&tag=dc=us.*&sample=0.5&duration=1h&count=10", nil)
+	req.ParseForm()
+	filter, err := parseTapFilter(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.Metric.String() != "^cpu" || filter.Source != nil || len(filter.Tags) != 2 || filter.Tags["dc"].String() != "us.*" ||
+		filter.SampleRate != 0.5 {
+		t.Errorf("unexpected filter %+v", filter)
+	}
+	duration, count, err := parseTapBounds(req)
+	if err != nil || duration != maxTapDuration || count != 10 {
+		t.Errorf("unexpected bounds %v %d %v", duration, count, err)
+	}
+
+	for _, query := range []string{"metric=(", "tag=env", "sample=2", "duration=-1s", "count=x"} {
+		req := httptest.NewRequest("GET", "/tap?port=2878&"+query, nil)
+		req.ParseForm()
+		if _, err := parseTapFilter(req); err == nil {
+			if _, _, err = parseTapBounds(req); err == nil {
+				t.Errorf("expected an error for %s", query)
+			}
+		}
+	}
+}
+
+func TestTapErrors(t *testing.T) {
+	handler := (&Server{}).Handler()
+	if w := get(t, handler, "/tap?port=2878"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without a tap function, found %d", w.Code)
+	}
+
+	handler = (&Server{Tap: func(port int, filter *points.TapFilter) (*points.Tap, error) {
+		return nil, errors.New("no listener on port 2878")
+	}}).Handler()
+	if w := get(t, handler, "/tap"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a port, found %d", w.Code)
+	}
+	if w := get(t, handler, "/tap?port=2878"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a port without listener, found %d", w.Code)
+	}
+}
+
+func TestTapText(t *testing.T) {
+	var buf bytes.Buffer
+	at := time.Date(2018, 8, 6, 4, 32, 57, 0, time.UTC)
+	writeTapText(&buf, points.TapEvent{Time: at, Status: points.TapBlocked, Client: "127.0.0.1:1234",
+		Line: "cpu.idle", Reason: "invalid point"})
+	writeTapText(&buf, points.TapEvent{Time: at, Status: points.TapRewritten, Client: "127.0.0.1:1234",
+		Line: "cpu.idle 1 source=a", Point: `"cpu.idle" 1 0 source="b"`})
+	expected := "2018-08-06T04:32:57Z blocked 127.0.0.1:1234 cpu.idle reason=\"invalid point\"\n" +
+		"2018-08-06T04:32:57Z rewritten 127.0.0.1:1234 cpu.idle 1 source=a => \"cpu.idle\" 1 0 source=\"b\"\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
@@ -2,6 +2,7 @@ package agent
 
 import (
 	"log"
+	"sync"
 	"time"
 
 	"github.com/rcrowley/go-metrics"
@@ -11,6 +12,13 @@ import (
 // Agent interface.
 type WavefrontAgent interface {
 	InitAgent()
+	CheckinStatus() CheckinStatus
+}
+
+// Result of the most recent checkin with the Wavefront server, Time is zero before the first checkin.
+type CheckinStatus struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error,omitempty"`
 }
 
 type DefaultAgent struct {
@@ -20,6 +28,8 @@ type DefaultAgent struct {
 	PushAgent  bool
 	Ephemeral  bool
 	ServerURL  string
+	mtx        sync.Mutex
+	status     CheckinStatus
 }
 
 func (a *DefaultAgent) InitAgent() {
@@ -38,6 +48,22 @@ func (a *DefaultAgent) checkin(ticker *time.Ticker) {
 	}
 }
 
+// CheckinStatus returns the result of the most recent checkin.
+func (a *DefaultAgent) CheckinStatus() CheckinStatus {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.status
+}
+
+func (a *DefaultAgent) setCheckinStatus(err error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.status = CheckinStatus{Time: time.Now()}
+	if err != nil {
+		a.status.Error = err.Error()
+	}
+}
+
 func (a *DefaultAgent) doCheckin() {
 	log.Println("Fetching configuration from", a.ServerURL)
 
@@ -49,6 +75,7 @@ func (a *DefaultAgent) doCheckin() {
 
 	currentTime := getCurrentTime()
 	agentConfig, err := a.ApiService.Checkin(currentTime, a.LocalAgent, a.PushAgent, a.Ephemeral, agentMetrics)
+	a.setCheckinStatus(err)
 	if err != nil {
 		log.Println("Checkin error", err)
 		return
@@ -7,9 +7,11 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
+	"github.com/wavefronthq/go-proxy/common"
 	"github.com/wavefronthq/go-proxy/config"
 )
 
@@ -23,6 +25,8 @@ type WavefrontAPI interface {
 	GetConfig(currentMillis, bytesLeft, bytesPerMinute, currentQueueSize int64) (*config.AgentConfig, error)
 	Checkin(currentMillis int64, localAgent, pushAgent, ephemeral bool, agentMetrics []byte) (*config.AgentConfig, error)
 	PostData(workUnitId, format, pointLines string) (*http.Response, error)
+	PostEvents(events []byte) (*http.Response, error)
+	UpdateSource(op *common.SourceOperation) (*http.Response, error)
 	AgentError(details string)
 	AgentConfigProcessed() error
 }
@@ -31,10 +35,18 @@ type WavefrontAPIService struct {
 	ServerURL string
 	AgentID   string
 	Hostname  string
-	Token     string
+	Token     TokenSource
 	Version   string
 }
 
+// authorize adds the API credentials to a request.
+func (service *WavefrontAPIService) authorize(req *http.Request) error {
+	if service.Token == nil {
+		return errNoToken
+	}
+	return service.Token.Authorize(req)
+}
+
 func (service *WavefrontAPIService) GetConfig(currentMillis, bytesLeft, bytesPerMinute, currentQueueSize int64) (*config.AgentConfig, error) {
 	apiURL := service.ServerURL + getConfigSuffix
 	apiURL = fmt.Sprintf(apiURL, service.AgentID)
@@ -46,13 +58,15 @@ func (service *WavefrontAPIService) GetConfig(currentMillis, bytesLeft, bytesPer
 
 	q := req.URL.Query()
 	q.Add(hostnameParam, service.Hostname)
-	q.Add(tokenParam, service.Token)
 	q.Add(versionParam, service.Version)
 	q.Add(currentMillisParam, strconv.FormatInt(currentMillis, 10))
 	q.Add(bytesLeftParam, strconv.FormatInt(bytesLeft, 10))
 	q.Add(bytesPerMinParam, strconv.FormatInt(bytesPerMinute, 10))
 	q.Add(currentQueueSizeParam, strconv.FormatInt(currentQueueSize, 10))
 	req.URL.RawQuery = q.Encode()
+	if err := service.authorize(req); err != nil {
+		return &config.AgentConfig{}, err
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -77,13 +91,15 @@ func (service *WavefrontAPIService) Checkin(currentMillis int64, localAgent, pus
 
 	q := req.URL.Query()
 	q.Add(hostnameParam, service.Hostname)
-	q.Add(tokenParam, service.Token)
 	q.Add(versionParam, service.Version)
 	q.Add(currentMillisParam, strconv.FormatInt(currentMillis, 10))
 	q.Add(localParam, strconv.FormatBool(localAgent))
 	q.Add(pushParam, strconv.FormatBool(pushAgent))
 	q.Add(ephemeralParam, strconv.FormatBool(ephemeral))
 	req.URL.RawQuery = q.Encode()
+	if err := service.authorize(req); err != nil {
+		return &config.AgentConfig{}, err
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -109,6 +125,81 @@ func (service *WavefrontAPIService) PostData(workUnitId, format, pointLines stri
 	if err != nil {
 		return &http.Response{}, err
 	}
+	if err := service.authorize(req); err != nil {
+		return &http.Response{}, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return resp, err
+	}
+	defer resp.Body.Close()
+	return resp, nil
+}
+
+// PostEvents sends a JSON array of events.
+func (service *WavefrontAPIService) PostEvents(events []byte) (*http.Response, error) {
+	req, err := http.NewRequest("POST", service.ServerURL+postEventsSuffix, bytes.NewBuffer(events))
+	if err != nil {
+		return &http.Response{}, err
+	}
+	req.Header.Set(contentType, applicationJSON)
+	if err := service.authorize(req); err != nil {
+		return &http.Response{}, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return resp, err
+	}
+	defer resp.Body.Close()
+	return resp, nil
+}
+
+// UpdateSource applies a source tag or description operation. Add and delete tag operations carry
+// a single tag, see SourceOperation.Split.
+func (service *WavefrontAPIService) UpdateSource(op *common.SourceOperation) (*http.Response, error) {
+	source := url.PathEscape(op.Source)
+	var method, apiURL, mediaType string
+	var body []byte
+	switch {
+	case op.Type == common.SourceDescriptionType && op.Action == common.SourceActionSave:
+		method, apiURL = "POST", fmt.Sprintf(service.ServerURL+sourceDescSuffix, source)
+		mediaType, body = textPlain, []byte(op.Description)
+	case op.Type == common.SourceDescriptionType && op.Action == common.SourceActionDelete:
+		method, apiURL = "DELETE", fmt.Sprintf(service.ServerURL+sourceDescSuffix, source)
+	case op.Type == common.SourceTagType && op.Action == common.SourceActionSave:
+		tags := op.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		data, err := json.Marshal(tags)
+		if err != nil {
+			return &http.Response{}, err
+		}
+		method, apiURL = "PUT", fmt.Sprintf(service.ServerURL+sourceTagsSuffix, source)
+		mediaType, body = applicationJSON, data
+	case op.Type == common.SourceTagType && len(op.Tags) == 1 &&
+		(op.Action == common.SourceActionAdd || op.Action == common.SourceActionDelete):
+		method = "PUT"
+		if op.Action == common.SourceActionDelete {
+			method = "DELETE"
+		}
+		apiURL = fmt.Sprintf(service.ServerURL+sourceTagsSuffix, source) + "/" + url.PathEscape(op.Tags[0])
+	default:
+		return &http.Response{}, fmt.Errorf("unsupported %s operation %q", op.Type, op.Action)
+	}
+
+	req, err := http.NewRequest(method, apiURL, bytes.NewBuffer(body))
+	if err != nil {
+		return &http.Response{}, err
+	}
+	if mediaType != "" {
+		req.Header.Set(contentType, mediaType)
+	}
+	if err := service.authorize(req); err != nil {
+		return &http.Response{}, err
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -130,6 +221,9 @@ func (service *WavefrontAPIService) AgentConfigProcessed() error {
 	if err != nil {
 		return err
 	}
+	if err := service.authorize(req); err != nil {
+		return err
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
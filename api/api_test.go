@@ -0,0 +1,51 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/wavefronthq/go-proxy/common"
+)
+
+func TestUpdateSource(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath()+" "+string(body))
+	}))
+	defer server.Close()
+	service := &WavefrontAPIService{ServerURL: server.URL, Token: StaticToken("x")}
+
+	ops := []*common.SourceOperation{
+		{Type: common.SourceTagType, Action: common.SourceActionAdd, Source: "app 1", Tags: []string{"web/prod"}},
+		{Type: common.SourceTagType, Action: common.SourceActionDelete, Source: "app1", Tags: []string{"web"}},
+		{Type: common.SourceTagType, Action: common.SourceActionSave, Source: "app1"},
+		{Type: common.SourceDescriptionType, Action: common.SourceActionSave, Source: "app1", Description: "Web server"},
+		{Type: common.SourceDescriptionType, Action: common.SourceActionDelete, Source: "app1"},
+	}
+	for _, op := range ops {
+		if _, err := service.UpdateSource(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := []string{
+		"PUT /v2/source/app%201/tag/web%2Fprod ",
+		"DELETE /v2/source/app1/tag/web ",
+		"PUT /v2/source/app1/tag []",
+		"POST /v2/source/app1/description Web server",
+		"DELETE /v2/source/app1/description ",
+	}
+	for i := range expected {
+		if i >= len(requests) || requests[i] != expected[i] {
+			t.Errorf("expected %q, found %v", expected[i], requests)
+		}
+	}
+
+	// add and delete operations with several tags have to be split first
+	op := &common.SourceOperation{Type: common.SourceTagType, Action: common.SourceActionAdd, Source: "a", Tags: []string{"b", "c"}}
+	if _, err := service.UpdateSource(op); err == nil {
+		t.Error("expected an error for an unsplit operation")
+	}
+}
@@ -5,6 +5,9 @@ const (
 	postDataSuffix        = "/daemon/%s/pushdata/%s?format=%s"
 	checkinSuffix         = "/daemon/%s/checkin"
 	configProcessedSuffix = "/daemon/%s/config/processed"
+	postEventsSuffix      = "/v2/wfproxy/event"
+	sourceTagsSuffix      = "/v2/source/%s/tag"
+	sourceDescSuffix      = "/v2/source/%s/description"
 	hostnameParam         = "hostname"
 	tokenParam            = "token"
 	versionParam          = "version"
@@ -18,6 +21,7 @@ const (
 	contentType           = "Content-Type"
 	textPlain             = "text/plain"
 	applicationJSON       = "application/json"
+	formURLEncoded        = "application/x-www-form-urlencoded"
 
 	NotAcceptableStatusCode = 406
 	FormatGraphiteV2        = "graphite_v2"
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	// OAuth tokens are refreshed this long before they expire
+	tokenRefreshMargin = 60 * time.Second
+	// expiry assumed when the token endpoint does not return expires_in
+	defaultTokenLifetime = 5 * time.Minute
+	// wait between attempts after a failed refresh
+	tokenRetryInterval = 5 * time.Second
+)
+
+var errNoToken = errors.New("no API token available")
+
+// Source of the credentials added to each request to the Wavefront API.
+// Implementations never log the credentials themselves.
+type TokenSource interface {
+	Authorize(req *http.Request) error
+}
+
+// A fixed API token, sent as the token query parameter.
+type StaticToken string
+
+func (t StaticToken) Authorize(req *http.Request) error {
+	addTokenParam(req, string(t))
+	return nil
+}
+
+func addTokenParam(req *http.Request, token string) {
+	q := req.URL.Query()
+	q.Set(tokenParam, token)
+	req.URL.RawQuery = q.Encode()
+}
+
+// An API token read from a file, which is re-read whenever the file changes so that the token
+// can be rotated without restarting the proxy. The token is sent as the token query parameter.
+type FileToken struct {
+	filename string
+	mtx      sync.Mutex
+	token    string
+	modTime  time.Time
+	failing  bool
+	reloads  metrics.Counter
+	errors   metrics.Counter
+}
+
+// NewFileToken reads the token from filename, failing if it cannot be read or is empty.
+func NewFileToken(filename string) (*FileToken, error) {
+	t := &FileToken{
+		filename: filename,
+		reloads:  metrics.GetOrRegisterCounter("auth.file.reloads", nil),
+		errors:   metrics.GetOrRegisterCounter("auth.file.errors", nil),
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.read(info.ModTime()); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *FileToken) Authorize(req *http.Request) error {
+	token, err := t.get()
+	if err != nil {
+		return err
+	}
+	addTokenParam(req, token)
+	return nil
+}
+
+// get returns the current token, re-reading the file if it has changed.
+// If the file cannot be read the previous token is kept.
+func (t *FileToken) get() (string, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	info, err := os.Stat(t.filename)
+	if err == nil && !info.ModTime().Equal(t.modTime) {
+		if err = t.read(info.ModTime()); err == nil {
+			log.Printf("Reloaded token from %s", t.filename)
+			t.reloads.Inc(1)
+		}
+	}
+	if err != nil {
+		// only log the first of consecutive failures, the file is checked on every request
+		if !t.failing {
+			log.Printf("Error reloading token file %s, keeping the previous token: %v", t.filename, err)
+		}
+		t.errors.Inc(1)
+	}
+	t.failing = err != nil
+
+	if t.token == "" {
+		return "", errNoToken
+	}
+	return t.token, nil
+}
+
+func (t *FileToken) read(modTime time.Time) error {
+	data, err := ioutil.ReadFile(t.filename)
+	if err != nil {
+		return err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return fmt.Errorf("%s is empty", t.filename)
+	}
+	t.token = token
+	t.modTime = modTime
+	return nil
+}
+
+// A short-lived bearer token obtained from an OAuth token endpoint using the client credentials grant.
+// The token is refreshed shortly before it expires and is sent in the Authorization header.
+type OAuthToken struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+
+	mtx       sync.Mutex
+	token     string
+	refreshAt time.Time
+	expiry    time.Time
+	nextRetry time.Time
+	refreshes metrics.Counter
+	errors    metrics.Counter
+}
+
+type oauthResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Error       string `json:"error"`
+}
+
+func NewOAuthToken(tokenURL, clientID, clientSecret string) *OAuthToken {
+	return &OAuthToken{
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		refreshes:    metrics.GetOrRegisterCounter("auth.oauth.refreshes", nil),
+		errors:       metrics.GetOrRegisterCounter("auth.oauth.errors", nil),
+	}
+}
+
+func (t *OAuthToken) Authorize(req *http.Request) error {
+	token, err := t.get()
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// get returns the current token, refreshing it if it is about to expire. A failed refresh keeps
+// using the current token until it expires and is retried after tokenRetryInterval.
+func (t *OAuthToken) get() (string, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	now := time.Now()
+	if now.Before(t.refreshAt) || now.Before(t.nextRetry) {
+		if now.Before(t.expiry) {
+			return t.token, nil
+		}
+		return "", errNoToken
+	}
+
+	if err := t.refresh(now); err != nil {
+		log.Printf("Error refreshing OAuth token from %s: %v", t.tokenURL, err)
+		t.errors.Inc(1)
+		t.nextRetry = now.Add(tokenRetryInterval)
+		if now.Before(t.expiry) {
+			return t.token, nil
+		}
+		return "", errNoToken
+	}
+	t.refreshes.Inc(1)
+	return t.token, nil
+}
+
+func (t *OAuthToken) refresh(now time.Time) error {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequest("POST", t.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(contentType, formURLEncoded)
+	req.SetBasicAuth(url.QueryEscape(t.clientID), url.QueryEscape(t.clientSecret))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// the response body is not logged as it contains the token
+	var body oauthResponse
+	decodeErr := json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusOK {
+		if body.Error != "" {
+			return fmt.Errorf("%s: %s", resp.Status, body.Error)
+		}
+		return errors.New(resp.Status)
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("invalid response: %v", decodeErr)
+	}
+	if body.AccessToken == "" {
+		return errors.New("response has no access_token")
+	}
+	if body.TokenType != "" && !strings.EqualFold(body.TokenType, "bearer") {
+		return fmt.Errorf("unsupported token type %q", body.TokenType)
+	}
+
+	lifetime := defaultTokenLifetime
+	if body.ExpiresIn > 0 {
+		lifetime = time.Duration(body.ExpiresIn) * time.Second
+	}
+	margin := tokenRefreshMargin
+	if margin > lifetime/2 {
+		margin = lifetime / 2
+	}
+	t.token = body.AccessToken
+	t.expiry = now.Add(lifetime)
+	t.refreshAt = t.expiry.Add(-margin)
+	log.Printf("Refreshed OAuth token, expires in %v", lifetime)
+	return nil
+}
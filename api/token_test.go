@@ -0,0 +1,98 @@
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func authorize(t *testing.T, source TokenSource) *http.Request {
+	req, _ := http.NewRequest("GET", "http://localhost/api/daemon?hostname=foo", nil)
+	if err := source.Authorize(req); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestStaticToken(t *testing.T) {
+	req := authorize(t, StaticToken("secret"))
+	if req.URL.Query().Get(tokenParam) != "secret" || req.URL.Query().Get("hostname") != "foo" {
+		t.Errorf("unexpected query %s", req.URL.RawQuery)
+	}
+}
+
+func TestFileTokenRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "token")
+	ioutil.WriteFile(filename, []byte("first\n"), 0600)
+	source, err := NewFileToken(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token := authorize(t, source).URL.Query().Get(tokenParam); token != "first" {
+		t.Errorf("expected first, found %s", token)
+	}
+
+	ioutil.WriteFile(filename, []byte("second\n"), 0600)
+	os.Chtimes(filename, time.Now(), time.Now().Add(time.Minute))
+	if token := authorize(t, source).URL.Query().Get(tokenParam); token != "second" {
+		t.Errorf("expected second, found %s", token)
+	}
+
+	// an unreadable token keeps the previous one
+	ioutil.WriteFile(filename, nil, 0600)
+	os.Chtimes(filename, time.Now(), time.Now().Add(2*time.Minute))
+	if token := authorize(t, source).URL.Query().Get(tokenParam); token != "second" {
+		t.Errorf("expected second, found %s", token)
+	}
+}
+
+func TestOAuthToken(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error": "invalid_client"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token": "token%d", "token_type": "Bearer", "expires_in": 3600}`, requests)
+	}))
+	defer server.Close()
+
+	source := NewOAuthToken(server.URL, "client", "secret")
+	for i := 0; i < 2; i++ {
+		if header := authorize(t, source).Header.Get("Authorization"); header != "Bearer token1" {
+			t.Errorf("expected Bearer token1, found %s", header)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected the token to be cached, found %d requests", requests)
+	}
+
+	// refreshed once within the refresh margin
+	source.refreshAt = time.Now().Add(-time.Second)
+	if header := authorize(t, source).Header.Get("Authorization"); header != "Bearer token2" {
+		t.Errorf("expected Bearer token2, found %s", header)
+	}
+
+	bad := NewOAuthToken(server.URL, "client", "wrong")
+	req, _ := http.NewRequest("GET", "http://localhost/api", nil)
+	if err := bad.Authorize(req); err != errNoToken {
+		t.Errorf("expected %v, found %v", errNoToken, err)
+	}
+	if bad.errors.Count() == 0 {
+		t.Error("expected a refresh error to be counted")
+	}
+}
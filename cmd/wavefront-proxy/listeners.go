@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavefronthq/go-proxy/api"
+	"github.com/wavefronthq/go-proxy/config"
+	"github.com/wavefronthq/go-proxy/points"
+	"github.com/wavefronthq/go-proxy/points/cumulative"
+	"github.com/wavefronthq/go-proxy/points/decoder"
+	"github.com/wavefronthq/go-proxy/points/preprocessor"
+)
+
+// Running listeners for one data format, keyed by port.
+type listenerGroup struct {
+	builder   decoder.DecoderBuilder
+	portsList func(cfg *config.ProxyConfig) string
+	listeners map[int]points.PointListener
+}
+
+var (
+	listenerGroups = []*listenerGroup{
+		{
+			builder:   decoder.GraphiteBuilder{},
+			portsList: func(cfg *config.ProxyConfig) string { return cfg.PushListenerPorts },
+			listeners: make(map[int]points.PointListener),
+		},
+		{
+			builder:   decoder.OpenTSDBBuilder{},
+			portsList: func(cfg *config.ProxyConfig) string { return cfg.OpenTSDBPorts },
+			listeners: make(map[int]points.PointListener),
+		},
+		// the ports of the custom formats file, each with its own format
+		{
+			portsList: func(cfg *config.ProxyConfig) string { return formatPorts() },
+			listeners: make(map[int]points.PointListener),
+		},
+	}
+	preprocessors *preprocessor.Preprocessors
+	policies      *decoder.Policies
+	converters    *cumulative.Converters
+	formats       map[int]*decoder.FormatBuilder
+	// guards the running listeners and proxyConfig, which change on reload
+	listenersMtx sync.RWMutex
+)
+
+func (g *listenerGroup) start(port int, cfg *config.ProxyConfig, service api.WavefrontAPI) error {
+	policy, err := policies.For(port)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		// ports without a policy file still count their violations
+		if policy, err = decoder.NewValidationPolicy(strconv.Itoa(port), basePolicyConfig(cfg)); err != nil {
+			return err
+		}
+	}
+	preproc, err := preprocessors.For(port)
+	if err != nil {
+		return err
+	}
+	converter, err := converters.For(port)
+	if err != nil {
+		return err
+	}
+	builder := g.builder
+	if builder == nil {
+		format, ok := formats[port]
+		if !ok {
+			return fmt.Errorf("no custom format for port %d", port)
+		}
+		builder = format
+	}
+	listener := &points.DefaultPointListener{
+		Port:                     port,
+		Builder:                  decoder.WithPolicy(builder, policy),
+		MaxLineLength:            cfg.PushListenerMaxReceivedLength,
+		MaxDecompressedSize:      int64(cfg.PushListenerMaxDecompressedSize),
+		Preprocessor:             preproc,
+		Counters:                 converter,
+		DeltaAggregationInterval: time.Duration(cfg.DeltaCountersAggregationIntervalSeconds) * time.Second,
+	}
+	err = listener.Start(cfg.FlushThreads, cfg.PushFlushInterval, cfg.PushMemoryBufferLimit, cfg.PushFlushMaxPoints,
+		api.FormatGraphiteV2, api.GraphiteBlockWorkUnit, service)
+	if err != nil {
+		return err
+	}
+	g.listeners[port] = listener
+	return nil
+}
+
+// removeMissing removes the listeners whose ports are not in the given list and returns them, still
+// running.
+func (g *listenerGroup) removeMissing(ports []int) []points.PointListener {
+	keep := make(map[int]bool)
+	for _, port := range ports {
+		keep[port] = true
+	}
+	var removed []points.PointListener
+	for port, listener := range g.listeners {
+		if !keep[port] {
+			removed = append(removed, listener)
+			delete(g.listeners, port)
+		}
+	}
+	return removed
+}
+
+// startAdded starts listeners for the ports in the given list which are not running yet.
+func (g *listenerGroup) startAdded(ports []int, cfg *config.ProxyConfig, service api.WavefrontAPI) {
+	for _, port := range ports {
+		if _, ok := g.listeners[port]; ok {
+			continue
+		}
+		if err := g.start(port, cfg, service); err != nil {
+			log.Printf("Error starting listener on port %d: %v", port, err)
+		}
+	}
+}
+
+// listenerStatus returns the status of the running listeners and the configured ports which have no
+// running listener, ordered by port.
+func listenerStatus() ([]points.ListenerStatus, []int) {
+	listenersMtx.RLock()
+	defer listenersMtx.RUnlock()
+
+	var statuses []points.ListenerStatus
+	var unbound []int
+	for _, group := range listenerGroups {
+		ports, _ := parsePorts(group.portsList(proxyConfig))
+		for _, port := range ports {
+			if listener, ok := group.listeners[port]; ok {
+				statuses = append(statuses, listener.Status())
+			} else {
+				unbound = append(unbound, port)
+			}
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Port < statuses[j].Port })
+	sort.Ints(unbound)
+	return statuses, unbound
+}
+
+// tapListener attaches a tap to the running listener on a port.
+func tapListener(port int, filter *points.TapFilter) (*points.Tap, error) {
+	listenersMtx.RLock()
+	defer listenersMtx.RUnlock()
+	for _, group := range listenerGroups {
+		if listener, ok := group.listeners[port]; ok {
+			return listener.Tap(filter), nil
+		}
+	}
+	return nil, fmt.Errorf("no listener on port %d", port)
+}
+
+// listenerClients returns the client statistics of the running listeners, ordered by port.
+func listenerClients() []points.ClientsStatus {
+	listenersMtx.RLock()
+	defer listenersMtx.RUnlock()
+	var clients []points.ClientsStatus
+	for _, group := range listenerGroups {
+		for _, listener := range group.listeners {
+			clients = append(clients, listener.Clients())
+		}
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].Port < clients[j].Port })
+	return clients
+}
+
+func loadPreprocessors() *preprocessor.Preprocessors {
+	if proxyConfig.PreprocessorConfigFile == "" {
+		return nil
+	}
+	preprocessors, err := preprocessor.LoadFile(proxyConfig.PreprocessorConfigFile)
+	if err != nil {
+		log.Fatal("Error loading preprocessor rules: ", err)
+	}
+	log.Printf("Loaded preprocessor rules from %s", proxyConfig.PreprocessorConfigFile)
+	return preprocessors
+}
+
+func loadPolicies() *decoder.Policies {
+	if proxyConfig.ValidationPolicyFile == "" {
+		return nil
+	}
+	policies, err := decoder.LoadPolicyFile(proxyConfig.ValidationPolicyFile, basePolicyConfig(proxyConfig))
+	if err != nil {
+		log.Fatal("Error loading validation policy: ", err)
+	}
+	log.Printf("Loaded validation policies from %s", proxyConfig.ValidationPolicyFile)
+	return policies
+}
+
+func loadConverters() *cumulative.Converters {
+	if proxyConfig.CumulativeCountersFile == "" {
+		return nil
+	}
+	converters, err := cumulative.LoadFile(proxyConfig.CumulativeCountersFile)
+	if err != nil {
+		log.Fatal("Error loading cumulative counter rules: ", err)
+	}
+	log.Printf("Loaded cumulative counter rules from %s", proxyConfig.CumulativeCountersFile)
+	return converters
+}
+
+func loadFormats() map[int]*decoder.FormatBuilder {
+	if proxyConfig.CustomFormatsFile == "" {
+		return nil
+	}
+	formats, err := decoder.LoadFormatFile(proxyConfig.CustomFormatsFile)
+	if err == nil {
+		err = checkFormatPorts(proxyConfig, formats)
+	}
+	if err != nil {
+		log.Fatal("Error loading custom formats: ", err)
+	}
+	log.Printf("Loaded custom formats for %d ports from %s", len(formats), proxyConfig.CustomFormatsFile)
+	return formats
+}
+
+// checkFormatPorts returns an error if a custom format port is also a Wavefront or OpenTSDB port.
+func checkFormatPorts(cfg *config.ProxyConfig, formats map[int]*decoder.FormatBuilder) error {
+	for _, key := range []string{"pushListenerPorts", "opentsdbPorts"} {
+		portsList := cfg.PushListenerPorts
+		if key == "opentsdbPorts" {
+			portsList = cfg.OpenTSDBPorts
+		}
+		ports, err := parsePorts(portsList)
+		if err != nil {
+			return err
+		}
+		for _, port := range ports {
+			if _, ok := formats[port]; ok {
+				return fmt.Errorf("port %d is also used by %s", port, key)
+			}
+		}
+	}
+	return nil
+}
+
+// formatPorts returns the ports of the custom formats as a sorted port list.
+func formatPorts() string {
+	ports := make([]int, 0, len(formats))
+	for port := range formats {
+		ports = append(ports, port)
+	}
+	sort.Ints(ports)
+	portStrs := make([]string, len(ports))
+	for i, port := range ports {
+		portStrs[i] = strconv.Itoa(port)
+	}
+	return strings.Join(portStrs, ",")
+}
+
+// basePolicyConfig returns the validation policy of the ports the policy file doesn't override.
+func basePolicyConfig(cfg *config.ProxyConfig) decoder.PolicyConfig {
+	policy := decoder.DefaultPolicyConfig()
+	policy.BackfillCutoff = time.Duration(cfg.DataBackfillCutoffHours) * time.Hour
+	policy.PrefillCutoff = time.Duration(cfg.DataPrefillCutoffHours) * time.Hour
+	return policy
+}
+
+// shutdownDeadlines returns the deadlines for open connections and for flushing the buffered points
+// of a shutdown starting now.
+func shutdownDeadlines(cfg *config.ProxyConfig) (connDeadline, flushDeadline time.Time) {
+	connDeadline = time.Now().Add(time.Duration(cfg.ShutdownGracePeriodSeconds) * time.Second)
+	flushDeadline = connDeadline.Add(time.Duration(cfg.ShutdownFlushSeconds) * time.Second)
+	return connDeadline, flushDeadline
+}
+
+// shutdownAll shuts the listeners down in parallel. Returns the number of points flushed and the
+// number dropped.
+func shutdownAll(listeners []points.PointListener, connDeadline, flushDeadline time.Time) (flushed, dropped int64) {
+	var wg sync.WaitGroup
+	var mtx sync.Mutex
+	for _, listener := range listeners {
+		wg.Add(1)
+		go func(listener points.PointListener) {
+			defer wg.Done()
+			f, d := listener.Shutdown(connDeadline, flushDeadline)
+			mtx.Lock()
+			flushed += f
+			dropped += d
+			mtx.Unlock()
+		}(listener)
+	}
+	wg.Wait()
+	return flushed, dropped
+}
@@ -2,89 +2,150 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"net/http"
 	_ "net/http/pprof"
 
 	"github.com/rcrowley/go-metrics"
+	"github.com/wavefronthq/go-proxy/admin"
 	"github.com/wavefronthq/go-proxy/agent"
 	"github.com/wavefronthq/go-proxy/api"
 	"github.com/wavefronthq/go-proxy/config"
+	"github.com/wavefronthq/go-proxy/logging"
 	"github.com/wavefronthq/go-proxy/points"
-	"github.com/wavefronthq/go-proxy/points/decoder"
 )
 
 // flags
 var (
-	fCfgPtr            = flag.String("config", "", "Proxy configuration file")
-	fTokenPtr          = flag.String("token", "", "Wavefront API token")
+	fCfgPtr       = flag.String("config", "", "Proxy configuration file")
+	fTokenPtr     = flag.String("token", "", "Wavefront API token")
+	fTokenFilePtr = flag.String("tokenFile", "", "File holding the Wavefront API token, re-read when it changes")
+	fOAuthURLPtr  = flag.String("oauthTokenUrl", "",
+		"OAuth token endpoint used to exchange client credentials for a bearer token, the secret is set with oauthClientSecret in the config file or environment")
+	fOAuthClientIDPtr  = flag.String("oauthClientId", "", "OAuth client id")
 	fServerPtr         = flag.String("server", "", "Wavefront Server URL")
 	fHostnamePtr       = flag.String("host", "", "Hostname for the agent. Defaults to machine hostname")
-	fWavefrontPortsPtr = flag.String("pushListenerPorts", "2878",
+	fWavefrontPortsPtr = flag.String("pushListenerPorts", config.DefaultPushListenerPorts,
 		"Comma-separated list of ports to listen on for Wavefront formatted data")
-	fOpenTSDBPortsPtr = flag.String("opentsdbPorts", "4242",
+	fOpenTSDBPortsPtr = flag.String("opentsdbPorts", config.DefaultOpenTSDBPorts,
 		"Comma-separated list of ports to listen on for OpenTSDB formatted data")
 	fFlushThreadsPtr   = flag.Int("flushThreads", config.DefaultFlushThreads, "Number of threads that flush to the server")
 	fFlushIntervalPtr  = flag.Int("pushFlushInterval", config.DefaultFlushInterval, "Milliseconds between flushes to the Wavefront server")
 	fFlushMaxPointsPtr = flag.Int("pushFlushMaxPoints", config.DefaultFlushMaxPoints, "Max points per flush")
 	fMaxBufferSizePtr  = flag.Int("pushMemoryBufferLimit", config.DefaultMemoryBufferLimit, "Max points to retain in memory")
-	fIdFilePtr         = flag.String("idFile", ".wavefront_id", "The agentId file")
-	fLogFilePtr        = flag.String("logFile", "", "Output log file")
-	fPprofAddr         = flag.String("pprof-addr", "", "pprof address to listen on, disabled if empty")
-	fVersionPtr        = flag.Bool("version", false, "Display the version and exit")
+	fMaxLineLengthPtr  = flag.Int("pushListenerMaxReceivedLength", config.DefaultMaxReceivedLength,
+		"Max length of a received line, longer lines are discarded")
+	fMaxDecompressedPtr = flag.Int("pushListenerMaxDecompressedSize", config.DefaultMaxDecompressedSize,
+		"Max decompressed bytes per compressed connection or HTTP request, 0 for unlimited")
+	fPreprocessorPtr  = flag.String("preprocessorConfigFile", "", "Preprocessor rules file for the push listener ports")
+	fValidationPtr    = flag.String("validationPolicyFile", "", "Validation policy file for the listener ports")
+	fCumulativePtr    = flag.String("cumulativeCountersFile", "", "Cumulative counter conversion rules for the listener ports")
+	fFormatsPtr       = flag.String("customFormatsFile", "", "Line formats of the custom format listener ports")
+	fBackfillPtr      = flag.Int("dataBackfillCutoffHours", 0, "Points older than this many hours violate the validation policy, 0 disables it")
+	fPrefillPtr       = flag.Int("dataPrefillCutoffHours", 0, "Points more than this many hours ahead violate the validation policy, 0 disables it")
+	fDeltaIntervalPtr = flag.Int("deltaCountersAggregationIntervalSeconds", config.DefaultDeltaInterval,
+		"Seconds over which delta counters are summed per series before being sent, 0 sends every point")
+	fIdFilePtr        = flag.String("idFile", config.DefaultIdFile, "The agentId file")
+	fLogFilePtr       = flag.String("logFile", "", "Output log file")
+	fLogLevelPtr      = flag.String("logLevel", config.DefaultLogLevel, "Log level: debug, info, warn or error")
+	fLogFormatPtr     = flag.String("logFormat", config.DefaultLogFormat, "Log format: text, logfmt or json")
+	fBlockedLogPtr    = flag.String("blockedPointsLogFile", "", "Log file for blocked points, defaults to the main log")
+	fLogMaxSizePtr    = flag.Int("logMaxSizeMB", logging.DefaultLogMaxSizeMB, "Rotate the log files past this size in MB, 0 disables it")
+	fLogMaxAgePtr     = flag.Int("logMaxAgeHours", logging.DefaultLogMaxAgeHours, "Rotate the log files past this age in hours, 0 disables it")
+	fLogMaxBackupsPtr = flag.Int("logMaxBackups", logging.DefaultLogMaxBackups, "Number of rotated log files to keep, 0 keeps all of them")
+	fLogCompressPtr   = flag.Bool("logCompress", true, "Gzip the rotated log files")
+	fShutdownGracePtr = flag.Int("shutdownGracePeriodSeconds", config.DefaultShutdownGracePeriod,
+		"Seconds to wait on shutdown for open connections to finish sending")
+	fShutdownFlushPtr = flag.Int("shutdownFlushSeconds", config.DefaultShutdownFlushTime,
+		"Seconds to spend on shutdown flushing buffered points, after the grace period")
+	fSelfMetricsPtr = flag.Int("selfMetricsIntervalSeconds", config.DefaultSelfMetricsInterval,
+		"Seconds between reports of the proxy's internal metrics as ~proxy.* points, 0 to disable")
+	fAdminAddrPtr   = flag.String("admin-addr", "", "Address of the admin HTTP server for health checks, status and metrics, disabled if empty")
+	fPprofAddr      = flag.String("pprof-addr", "", "pprof address to listen on, disabled if empty")
+	fVersionPtr     = flag.Bool("version", false, "Display the version and exit")
+	fPrintConfigPtr = flag.Bool("print-effective-config", false,
+		"Display the effective configuration and the source of each setting, then exit")
 )
 
+// flag names which differ from their config key
+var flagKeys = map[string]string{
+	"host":       "hostname",
+	"pprof-addr": "pprofAddr",
+	"admin-addr": "adminAddr",
+}
+
 var (
-	version   string
-	commit    string
-	branch    string
-	tag       string
-	listeners []points.PointListener
+	version     string
+	commit      string
+	branch      string
+	tag         string
+	proxyConfig *config.ProxyConfig
+	selfMetrics *points.MetricsReporter
+	logFiles    []*logging.RotatingFile
 )
 
-func parseCfg(filename string) {
-	proxyConfig, err := config.LoadConfig(filename)
-	if err != nil {
-		log.Fatal("Error loading config file: ", err)
-	}
-
-	fTokenPtr = &proxyConfig.Token
-	fServerPtr = &proxyConfig.Server
-	fHostnamePtr = &proxyConfig.Hostname
-	fWavefrontPortsPtr = &proxyConfig.PushListenerPorts
-	fOpenTSDBPortsPtr = &proxyConfig.OpenTSDBPorts
-	fFlushThreadsPtr = &proxyConfig.FlushThreads
-	fFlushIntervalPtr = &proxyConfig.PushFlushInterval
-	fFlushMaxPointsPtr = &proxyConfig.PushFlushMaxPoints
-	fMaxBufferSizePtr = &proxyConfig.PushMemoryBufferLimit
-	fIdFilePtr = &proxyConfig.IdFile
-	fLogFilePtr = &proxyConfig.LogFile
-	fPprofAddr = &proxyConfig.PprofAddr
-}
-
-func waitForShutdown() {
-	for {
-		signals := make(chan os.Signal)
-		signal.Notify(signals, os.Interrupt)
-		select {
-		case sig := <-signals:
-			if sig == os.Interrupt {
-				log.Println("Stopping Wavefront Proxy")
-				stopListeners()
-				os.Exit(0)
-			}
+// setFlags returns the values of the explicitly set flags, keyed by config key.
+func setFlags() map[string]string {
+	values := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		key := f.Name
+		if k, ok := flagKeys[f.Name]; ok {
+			key = k
+		}
+		if config.IsKey(key) {
+			values[key] = f.Value.String()
 		}
+	})
+	return values
+}
+
+// loadConfig layers the config file, environment and flags on top of the defaults.
+func loadConfig() (*config.ProxyConfig, config.Sources, error) {
+	cfg, sources, err := config.Load(*fCfgPtr, setFlags())
+	if err != nil {
+		return nil, nil, err
 	}
+	checkHostname(cfg)
+	return cfg, sources, nil
 }
 
-func stopListeners() {
-	for _, listener := range listeners {
-		listener.Stop()
+func waitForShutdown(service api.WavefrontAPI) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1)
+	for sig := range signals {
+		switch sig {
+		case syscall.SIGHUP:
+			reloadConfig(service)
+		case syscall.SIGUSR1:
+			reopenLogFiles()
+		case os.Interrupt, syscall.SIGTERM:
+			log.Printf("Stopping Wavefront Proxy (%v)", sig)
+			go func() {
+				for sig := range signals {
+					switch sig {
+					case syscall.SIGUSR1:
+						reopenLogFiles()
+					case syscall.SIGHUP:
+						log.Println("Ignoring reload while shutting down")
+					default:
+						log.Println("Second signal received, exiting without flushing")
+						os.Exit(1)
+					}
+				}
+			}()
+			shutdownListeners()
+			os.Exit(0)
+		}
 	}
 }
 
@@ -96,23 +157,87 @@ func checkRequiredFlag(val string, msg string) {
 	}
 }
 
-func checkHostname() {
-	if *fHostnamePtr == "" {
+func checkHostname(cfg *config.ProxyConfig) {
+	if cfg.Hostname == "" {
 		hostname, err := os.Hostname()
 		if err != nil {
 			log.Fatal("Error resolving hostname")
 		}
-		fHostnamePtr = &hostname
+		cfg.Hostname = hostname
 	}
 }
 
+// newTokenSource returns the source of the API credentials configured in cfg.
+func newTokenSource(cfg *config.ProxyConfig) (api.TokenSource, error) {
+	switch {
+	case cfg.OAuthTokenURL != "":
+		if cfg.OAuthClientID == "" || cfg.OAuthClientSecret == "" {
+			return nil, fmt.Errorf("oauthClientId and oauthClientSecret are required with oauthTokenUrl")
+		}
+		return api.NewOAuthToken(cfg.OAuthTokenURL, cfg.OAuthClientID, cfg.OAuthClientSecret), nil
+	case cfg.TokenFile != "":
+		return api.NewFileToken(cfg.TokenFile)
+	}
+	return api.StaticToken(cfg.Token), nil
+}
+
+// setupLogger configures the leveled logger, which the standard log package is redirected to,
+// and the blocked points log.
 func setupLogger() {
-	if *fLogFilePtr != "" {
-		f, err := os.Create(*fLogFilePtr)
+	level, err := logging.ParseLevel(proxyConfig.LogLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	format, err := logging.ParseFormat(proxyConfig.LogFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var out io.Writer = os.Stderr
+	if proxyConfig.LogFile != "" {
+		f, err := openLogFile(proxyConfig.LogFile)
 		if err != nil {
-			panic(err)
+			log.Fatal("Error opening log file: ", err)
 		}
-		log.SetOutput(f)
+		out = f
+	}
+	logging.SetOutput(out)
+	logging.SetFormat(format)
+	logging.SetLevel(level)
+	logging.RedirectStdLog()
+
+	// blocked lines may be frequent and carry client data, so they stay out of the main log
+	if proxyConfig.BlockedPointsLogFile == "" {
+		logging.SetBlockedPoints(nil)
+		return
+	}
+	f, err := openLogFile(proxyConfig.BlockedPointsLogFile)
+	if err != nil {
+		log.Fatal("Error opening blocked points log: ", err)
+	}
+	logging.SetBlockedPoints(logging.NewBlockedLogger(f, format,
+		proxyConfig.BlockedPointsLogRate, proxyConfig.BlockedPointsLogSamplePercent))
+}
+
+// openLogFile opens a log file for appending, rotated according to the proxy config.
+func openLogFile(filename string) (*logging.RotatingFile, error) {
+	f, err := logging.OpenRotatingFile(filename, int64(proxyConfig.LogMaxSizeMB)*1024*1024,
+		time.Duration(proxyConfig.LogMaxAgeHours)*time.Hour, proxyConfig.LogMaxBackups, proxyConfig.LogCompress)
+	if err != nil {
+		return nil, err
+	}
+	logFiles = append(logFiles, f)
+	return f, nil
+}
+
+// reopenLogFiles reopens the log files on SIGUSR1, after they were moved by an external logrotate.
+func reopenLogFiles() {
+	for _, f := range logFiles {
+		if err := f.Reopen(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reopening log file %s: %v\n", f.Name(), err)
+			continue
+		}
+		logging.Info("Reopened log file", "file", f.Name())
 	}
 }
 
@@ -133,46 +258,120 @@ func checkFlags() {
 		os.Exit(0)
 	}
 
-	if *fCfgPtr != "" {
-		parseCfg(*fCfgPtr)
+	cfg, sources, err := loadConfig()
+	if err != nil {
+		log.Fatal("Error loading config: ", err)
 	}
-	checkRequiredFlag(*fTokenPtr, "Missing token")
-	checkRequiredFlag(*fServerPtr, "Missing server")
-	checkHostname()
-	setupLogger()
-}
+	proxyConfig = cfg
 
-func startPointListener(listener points.PointListener, service api.WavefrontAPI) {
-	listener.Start(*fFlushThreadsPtr, *fFlushIntervalPtr, *fMaxBufferSizePtr, *fFlushMaxPointsPtr,
-		api.FormatGraphiteV2, api.GraphiteBlockWorkUnit, service)
+	if *fPrintConfigPtr {
+		config.PrintEffective(os.Stdout, proxyConfig, sources)
+		os.Exit(0)
+	}
+
+	checkRequiredFlag(proxyConfig.Token+proxyConfig.TokenFile+proxyConfig.OAuthTokenURL, "Missing token")
+	checkRequiredFlag(proxyConfig.Server, "Missing server")
+	checkHostname(proxyConfig)
+	setupLogger()
 }
 
-func startPointListeners(service api.WavefrontAPI, portsList string, builder decoder.DecoderBuilder) {
-	ports := strings.Split(portsList, ",")
-	for _, portStr := range ports {
+func parsePorts(portsList string) ([]int, error) {
+	var ports []int
+	if portsList == "" {
+		return ports, nil
+	}
+	for _, portStr := range strings.Split(portsList, ",") {
 		port, err := strconv.Atoi(portStr)
 		if err != nil {
-			log.Fatal("Invalid port " + portStr)
+			return nil, fmt.Errorf("Invalid port %s", portStr)
 		}
-		listener := &points.DefaultPointListener{Port: port, Builder: builder}
-		listeners = append(listeners, listener)
-		startPointListener(listener, service)
+		ports = append(ports, port)
 	}
+	return ports, nil
 }
 
 func startListeners(service api.WavefrontAPI) {
-	if *fWavefrontPortsPtr != "" {
-		startPointListeners(service, *fWavefrontPortsPtr, decoder.GraphiteBuilder{})
+	preprocessors = loadPreprocessors()
+	policies = loadPolicies()
+	converters = loadConverters()
+	formats = loadFormats()
+
+	for _, group := range listenerGroups {
+		ports, err := parsePorts(group.portsList(proxyConfig))
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, port := range ports {
+			if err := group.start(port, proxyConfig, service); err != nil {
+				log.Fatal(err)
+			}
+		}
 	}
+}
+
+// shutdownListeners stops all listeners in parallel, waiting for open connections and flushing the
+// buffered points within the configured grace period and flush time.
+func shutdownListeners() {
+	listenersMtx.RLock()
+	defer listenersMtx.RUnlock()
 
-	if *fOpenTSDBPortsPtr != "" {
-		startPointListeners(service, *fOpenTSDBPortsPtr, decoder.OpenTSDBBuilder{})
+	connDeadline, flushDeadline := shutdownDeadlines(proxyConfig)
+
+	var wg sync.WaitGroup
+	var selfFlushed, selfDropped int64
+	if selfMetrics != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			selfFlushed, selfDropped = selfMetrics.Shutdown(flushDeadline)
+		}()
 	}
+	var listeners []points.PointListener
+	for _, group := range listenerGroups {
+		for _, listener := range group.listeners {
+			listeners = append(listeners, listener)
+		}
+	}
+	flushed, dropped := shutdownAll(listeners, connDeadline, flushDeadline)
+	wg.Wait()
+	log.Printf("Shutdown complete: flushed %d points, dropped %d points", flushed+selfFlushed, dropped+selfDropped)
 }
 
-func initAgent(agentID, serverURL string, service api.WavefrontAPI) {
+func initAgent(agentID, serverURL string, service api.WavefrontAPI) agent.WavefrontAgent {
 	agent := &agent.DefaultAgent{AgentID: agentID, ApiService: service, ServerURL: serverURL}
 	agent.InitAgent()
+	return agent
+}
+
+func startSelfMetrics(agentID string, service api.WavefrontAPI) {
+	selfMetrics = &points.MetricsReporter{
+		Hostname: proxyConfig.Hostname,
+		AgentID:  agentID,
+		Interval: time.Duration(proxyConfig.SelfMetricsIntervalSeconds) * time.Second,
+	}
+	selfMetrics.Start(proxyConfig.PushFlushInterval, proxyConfig.PushMemoryBufferLimit, proxyConfig.PushFlushMaxPoints,
+		api.FormatGraphiteV2, api.GraphiteBlockWorkUnit, service)
+}
+
+func startAdminServer(addr, agentID string, proxyAgent agent.WavefrontAgent) {
+	server := &admin.Server{
+		Addr: addr,
+		Status: func() *admin.Status {
+			listeners, unbound := listenerStatus()
+			return &admin.Status{
+				AgentID:      agentID,
+				Version:      getVersion(),
+				Checkin:      proxyAgent.CheckinStatus(),
+				Listeners:    listeners,
+				UnboundPorts: unbound,
+			}
+		},
+		Tap:     tapListener,
+		Clients: listenerClients,
+	}
+	if err := server.Start(); err != nil {
+		log.Fatal("Error starting admin HTTP server: ", err)
+	}
 }
 
 func buildVersion(v string) int64 {
@@ -192,6 +391,9 @@ func buildVersion(v string) int64 {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:]))
+	}
 	checkFlags()
 
 	log.Printf("Starting Wavefront Proxy Version %s", version)
@@ -199,25 +401,36 @@ func main() {
 	versionMetric := metrics.GetOrRegisterGauge("build.version", nil)
 	versionMetric.Update(buildVersion(version))
 
-	if *fPprofAddr != "" {
+	if pprofAddr := proxyConfig.PprofAddr; pprofAddr != "" {
 		go func() {
-			log.Printf("Starting pprof HTTP server at: %s", *fPprofAddr)
-			if err := http.ListenAndServe(*fPprofAddr, nil); err != nil {
+			log.Printf("Starting pprof HTTP server at: %s", pprofAddr)
+			if err := http.ListenAndServe(pprofAddr, nil); err != nil {
 				log.Fatal(err.Error())
 			}
 		}()
 	}
 
-	agentID := agent.CreateOrGetAgentId(*fIdFilePtr)
+	token, err := newTokenSource(proxyConfig)
+	if err != nil {
+		log.Fatal("Error loading token: ", err)
+	}
+
+	agentID := agent.CreateOrGetAgentId(proxyConfig.IdFile)
 	apiService := &api.WavefrontAPIService{
-		ServerURL: *fServerPtr,
+		ServerURL: proxyConfig.Server,
 		AgentID:   agentID,
-		Hostname:  *fHostnamePtr,
-		Token:     *fTokenPtr,
+		Hostname:  proxyConfig.Hostname,
+		Token:     token,
 		Version:   version,
 	}
 
-	initAgent(agentID, *fServerPtr, apiService)
+	proxyAgent := initAgent(agentID, proxyConfig.Server, apiService)
 	startListeners(apiService)
-	waitForShutdown()
+	if proxyConfig.SelfMetricsIntervalSeconds > 0 {
+		startSelfMetrics(agentID, apiService)
+	}
+	if proxyConfig.AdminAddr != "" {
+		startAdminServer(proxyConfig.AdminAddr, agentID, proxyAgent)
+	}
+	waitForShutdown(apiService)
 }
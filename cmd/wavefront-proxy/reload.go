@@ -0,0 +1,101 @@
+package main
+
+import (
+	"log"
+
+	"github.com/wavefronthq/go-proxy/api"
+	"github.com/wavefronthq/go-proxy/config"
+	"github.com/wavefronthq/go-proxy/logging"
+	"github.com/wavefronthq/go-proxy/points"
+)
+
+// settings which are applied to a running proxy on reload
+var liveKeys = map[string]bool{
+	"pushListenerPorts":     true,
+	"opentsdbPorts":         true,
+	"pushFlushInterval":     true,
+	"pushFlushMaxPoints":    true,
+	"pushMemoryBufferLimit": true,
+	"logLevel":              true,
+}
+
+// reloadConfig re-reads the config file and applies the changed settings to the running proxy.
+// Settings which cannot be changed without a restart keep their current values.
+func reloadConfig(service api.WavefrontAPI) {
+	if *fCfgPtr == "" {
+		log.Println("No config file to reload")
+		return
+	}
+
+	log.Println("Reloading configuration from", *fCfgPtr)
+	newConfig, _, err := loadConfig()
+	if err != nil {
+		log.Println("Error reloading config file:", err)
+		return
+	}
+
+	changes := config.Diff(proxyConfig, newConfig)
+	if len(changes) == 0 {
+		log.Println("No configuration changes")
+		return
+	}
+
+	ports := make([][]int, len(listenerGroups))
+	for i, group := range listenerGroups {
+		if ports[i], err = parsePorts(group.portsList(newConfig)); err != nil {
+			log.Println("Error reloading config file:", err)
+			return
+		}
+	}
+
+	for _, change := range changes {
+		log.Printf("Configuration change: %s", change)
+		if !liveKeys[change.Key] {
+			log.Printf("Warning: change to %s requires a restart to take effect", change.Key)
+		}
+	}
+
+	listenersMtx.Lock()
+	defer listenersMtx.Unlock()
+
+	applied := *proxyConfig
+	applied.PushListenerPorts = newConfig.PushListenerPorts
+	applied.OpenTSDBPorts = newConfig.OpenTSDBPorts
+	applied.PushFlushInterval = newConfig.PushFlushInterval
+	applied.PushFlushMaxPoints = newConfig.PushFlushMaxPoints
+	applied.PushMemoryBufferLimit = newConfig.PushMemoryBufferLimit
+
+	if level, err := logging.ParseLevel(newConfig.LogLevel); err != nil {
+		log.Println("Error reloading log level:", err)
+	} else {
+		applied.LogLevel = newConfig.LogLevel
+		logging.SetLevel(level)
+	}
+
+	// stop removed ports first so a port can move between listener types, flushing their buffered
+	// points like on shutdown
+	var removed []points.PointListener
+	for i, group := range listenerGroups {
+		removed = append(removed, group.removeMissing(ports[i])...)
+	}
+	if len(removed) > 0 {
+		connDeadline, flushDeadline := shutdownDeadlines(proxyConfig)
+		flushed, dropped := shutdownAll(removed, connDeadline, flushDeadline)
+		log.Printf("Stopped %d removed listeners: flushed %d points, dropped %d points", len(removed), flushed, dropped)
+	}
+
+	if applied.PushFlushInterval != proxyConfig.PushFlushInterval ||
+		applied.PushFlushMaxPoints != proxyConfig.PushFlushMaxPoints ||
+		applied.PushMemoryBufferLimit != proxyConfig.PushMemoryBufferLimit {
+		for _, group := range listenerGroups {
+			for _, listener := range group.listeners {
+				listener.Update(applied.PushFlushInterval, applied.PushMemoryBufferLimit, applied.PushFlushMaxPoints)
+			}
+		}
+	}
+
+	for i, group := range listenerGroups {
+		group.startAdded(ports[i], &applied, service)
+	}
+	proxyConfig = &applied
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/wavefronthq/go-proxy/config"
+	"github.com/wavefronthq/go-proxy/points/cumulative"
+	"github.com/wavefronthq/go-proxy/points/decoder"
+	"github.com/wavefronthq/go-proxy/points/preprocessor"
+)
+
+// runValidate implements "wavefront-proxy validate -config file": it checks the configuration the proxy
+// would start with and reports every problem found. Returns the process exit code.
+func runValidate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	cfgFile := flags.String("config", "", "Proxy configuration file to validate")
+	flags.Parse(args)
+
+	// settings which cannot be parsed are reported with the other problems
+	cfg, _, err := config.Load(*cfgFile, nil)
+	parseErrors, _ := err.(config.ParseErrors)
+	if err != nil && parseErrors == nil {
+		fmt.Fprintln(os.Stderr, "Error loading config:", err)
+		return 1
+	}
+	checkHostname(cfg)
+
+	if *cfgFile != "" {
+		unknown, err := config.UnknownKeys(*cfgFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error loading config:", err)
+			return 1
+		}
+		for _, key := range unknown {
+			fmt.Fprintf(os.Stderr, "Warning: %s: unknown setting, ignored\n", key)
+		}
+	}
+
+	problems := []*config.ValidationError(parseErrors)
+	for _, problem := range config.Validate(cfg) {
+		if !hasProblem(parseErrors, problem.Key) {
+			problems = append(problems, problem)
+		}
+	}
+	if cfg.PreprocessorConfigFile != "" && !hasProblem(problems, "preprocessorConfigFile") {
+		if _, err := preprocessor.LoadFile(cfg.PreprocessorConfigFile); err != nil {
+			problems = append(problems, &config.ValidationError{Key: "preprocessorConfigFile", Message: err.Error()})
+		}
+	}
+	if cfg.ValidationPolicyFile != "" && !hasProblem(problems, "validationPolicyFile") {
+		if _, err := decoder.LoadPolicyFile(cfg.ValidationPolicyFile, basePolicyConfig(cfg)); err != nil {
+			problems = append(problems, &config.ValidationError{Key: "validationPolicyFile", Message: err.Error()})
+		}
+	}
+	if cfg.CumulativeCountersFile != "" && !hasProblem(problems, "cumulativeCountersFile") {
+		if _, err := cumulative.LoadFile(cfg.CumulativeCountersFile); err != nil {
+			problems = append(problems, &config.ValidationError{Key: "cumulativeCountersFile", Message: err.Error()})
+		}
+	}
+	if cfg.CustomFormatsFile != "" && !hasProblem(problems, "customFormatsFile") {
+		formats, err := decoder.LoadFormatFile(cfg.CustomFormatsFile)
+		if err == nil {
+			err = checkFormatPorts(cfg, formats)
+		}
+		if err != nil {
+			problems = append(problems, &config.ValidationError{Key: "customFormatsFile", Message: err.Error()})
+		}
+	}
+
+	for _, problem := range problems {
+		fmt.Fprintln(os.Stderr, problem)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "%d problem(s) found\n", len(problems))
+		return 1
+	}
+	fmt.Println("Configuration OK")
+	return 0
+}
+
+func hasProblem(problems []*config.ValidationError, key string) bool {
+	for _, problem := range problems {
+		if problem.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,14 @@
+package common
+
+// Event such as a deployment marker, in the JSON form accepted by the Wavefront event API.
+type Event struct {
+	Name string `json:"name"`
+	// start and end of the event in epoch milliseconds
+	StartTime   int64             `json:"startTime"`
+	EndTime     int64             `json:"endTime"`
+	Annotations map[string]string `json:"annotations"`
+	Hosts       []string          `json:"hosts,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	// annotations given more than once
+	Dimensions map[string][]string `json:"dimensions,omitempty"`
+}
@@ -0,0 +1,28 @@
+package common
+
+import "strings"
+
+// SplitPort separates the listener port from an internal metric name such as points.2878.received.
+// Returns the name without the port segment (points.received) and the port, or the unchanged name and
+// an empty port if no segment is numeric.
+func SplitPort(name string) (string, string) {
+	segments := strings.Split(name, ".")
+	for i, segment := range segments {
+		if isNumeric(segment) {
+			return strings.Join(append(segments[:i:i], segments[i+1:]...), "."), segment
+		}
+	}
+	return name, ""
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -1,5 +1,19 @@
 package common
 
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Prefixes of delta counter names, the backend sums the values of delta counters instead of
+// keeping the latest one. DeltaPrefix is the canonical one.
+const (
+	DeltaPrefix    = "∆"
+	AltDeltaPrefix = "Δ"
+)
+
 type Point struct {
 	Name      string
 	Value     string
@@ -7,3 +21,51 @@ type Point struct {
 	Source    string
 	Tags      map[string]string
 }
+
+// HasDeltaPrefix returns true if name is the name of a delta counter.
+func HasDeltaPrefix(name string) bool {
+	return strings.HasPrefix(name, DeltaPrefix) || strings.HasPrefix(name, AltDeltaPrefix)
+}
+
+// TrimDeltaPrefix returns name without its delta prefix and whether it had one.
+func TrimDeltaPrefix(name string) (string, bool) {
+	if strings.HasPrefix(name, DeltaPrefix) {
+		return name[len(DeltaPrefix):], true
+	}
+	if strings.HasPrefix(name, AltDeltaPrefix) {
+		return name[len(AltDeltaPrefix):], true
+	}
+	return name, false
+}
+
+// Truncate shortens s to at most n bytes without splitting a character.
+func Truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// SeriesKey identifies the series of a point by its name, source and sorted tags.
+func SeriesKey(point *Point) string {
+	var buf bytes.Buffer
+	buf.WriteString(point.Name)
+	buf.WriteByte(0)
+	buf.WriteString(point.Source)
+
+	keys := make([]string, 0, len(point.Tags))
+	for k := range point.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		buf.WriteByte(0)
+		buf.WriteString(k)
+		buf.WriteByte('=')
+		buf.WriteString(point.Tags[k])
+	}
+	return buf.String()
+}
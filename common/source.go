@@ -0,0 +1,35 @@
+package common
+
+// Source metadata command types and actions.
+const (
+	SourceTagType         = "SourceTag"
+	SourceDescriptionType = "SourceDescription"
+
+	SourceActionAdd    = "add"
+	SourceActionDelete = "delete"
+	SourceActionSave   = "save"
+)
+
+// Update of the tags or the description of a source.
+type SourceOperation struct {
+	// SourceTagType or SourceDescriptionType
+	Type   string
+	Action string
+	Source string
+	// tags to add, delete or save, save replaces all tags of the source
+	Tags        []string
+	Description string
+}
+
+// Split returns one operation per tag for add and delete operations, which the source API
+// applies a tag at a time. Other operations are returned unchanged.
+func (op *SourceOperation) Split() []*SourceOperation {
+	if op.Type != SourceTagType || op.Action == SourceActionSave || len(op.Tags) < 2 {
+		return []*SourceOperation{op}
+	}
+	ops := make([]*SourceOperation, len(op.Tags))
+	for i, tag := range op.Tags {
+		ops[i] = &SourceOperation{Type: op.Type, Action: op.Action, Source: op.Source, Tags: []string{tag}}
+	}
+	return ops
+}
@@ -1,51 +1,92 @@
 package config
 
-import (
-	"log"
-
-	"github.com/spf13/viper"
-)
+import "github.com/wavefronthq/go-proxy/logging"
 
 const (
-	DefaultFlushThreads      = 4
-	DefaultFlushInterval     = 1000
-	DefaultFlushMaxPoints    = 40000
-	DefaultMemoryBufferLimit = 640000
+	DefaultFlushThreads        = 4
+	DefaultFlushInterval       = 1000
+	DefaultFlushMaxPoints      = 40000
+	DefaultMemoryBufferLimit   = 640000
+	DefaultMaxReceivedLength   = 64 * 1024
+	DefaultMaxDecompressedSize = 128 * 1024 * 1024
+	DefaultPushListenerPorts   = "2878"
+	DefaultOpenTSDBPorts       = "4242"
+	DefaultIdFile              = ".wavefront_id"
+	DefaultShutdownGracePeriod = 10
+	DefaultShutdownFlushTime   = 30
+	DefaultSelfMetricsInterval = 60
+	DefaultDeltaInterval       = 30
+	DefaultLogLevel            = "info"
+	DefaultLogFormat           = "text"
 )
 
+// Proxy settings, the cfg tag holds the key used in config files, environment variables and flags.
 type ProxyConfig struct {
-	Server                string
-	Hostname              string
-	Token                 string
-	PushListenerPorts     string
-	OpenTSDBPorts         string
-	FlushThreads          int
-	PushFlushInterval     int
-	PushFlushMaxPoints    int
-	PushMemoryBufferLimit int
-	IdFile                string
-	LogFile               string
-	PprofAddr             string
+	Server                                  string `cfg:"server"`
+	Hostname                                string `cfg:"hostname"`
+	Token                                   string `cfg:"token"`
+	TokenFile                               string `cfg:"tokenFile"`
+	OAuthTokenURL                           string `cfg:"oauthTokenUrl"`
+	OAuthClientID                           string `cfg:"oauthClientId"`
+	OAuthClientSecret                       string `cfg:"oauthClientSecret"`
+	PushListenerPorts                       string `cfg:"pushListenerPorts"`
+	OpenTSDBPorts                           string `cfg:"opentsdbPorts"`
+	FlushThreads                            int    `cfg:"flushThreads"`
+	PushFlushInterval                       int    `cfg:"pushFlushInterval"`
+	PushFlushMaxPoints                      int    `cfg:"pushFlushMaxPoints"`
+	PushMemoryBufferLimit                   int    `cfg:"pushMemoryBufferLimit"`
+	PushListenerMaxReceivedLength           int    `cfg:"pushListenerMaxReceivedLength"`
+	PushListenerMaxDecompressedSize         int    `cfg:"pushListenerMaxDecompressedSize"`
+	PreprocessorConfigFile                  string `cfg:"preprocessorConfigFile"`
+	ValidationPolicyFile                    string `cfg:"validationPolicyFile"`
+	CumulativeCountersFile                  string `cfg:"cumulativeCountersFile"`
+	CustomFormatsFile                       string `cfg:"customFormatsFile"`
+	DataBackfillCutoffHours                 int    `cfg:"dataBackfillCutoffHours"`
+	DataPrefillCutoffHours                  int    `cfg:"dataPrefillCutoffHours"`
+	DeltaCountersAggregationIntervalSeconds int    `cfg:"deltaCountersAggregationIntervalSeconds"`
+	IdFile                                  string `cfg:"idFile"`
+	LogFile                                 string `cfg:"logFile"`
+	LogLevel                                string `cfg:"logLevel"`
+	LogFormat                               string `cfg:"logFormat"`
+	LogMaxSizeMB                            int    `cfg:"logMaxSizeMB"`
+	LogMaxAgeHours                          int    `cfg:"logMaxAgeHours"`
+	LogMaxBackups                           int    `cfg:"logMaxBackups"`
+	LogCompress                             bool   `cfg:"logCompress"`
+	BlockedPointsLogFile                    string `cfg:"blockedPointsLogFile"`
+	BlockedPointsLogRate                    int    `cfg:"blockedPointsLogRate"`
+	BlockedPointsLogSamplePercent           int    `cfg:"blockedPointsLogSamplePercent"`
+	PprofAddr                               string `cfg:"pprofAddr"`
+	AdminAddr                               string `cfg:"adminAddr"`
+	ShutdownGracePeriodSeconds              int    `cfg:"shutdownGracePeriodSeconds"`
+	ShutdownFlushSeconds                    int    `cfg:"shutdownFlushSeconds"`
+	SelfMetricsIntervalSeconds              int    `cfg:"selfMetricsIntervalSeconds"`
 }
 
-func LoadConfig(filename string) (*ProxyConfig, error) {
-	log.Println("Loading configuration from", filename)
-
-	viper.SetConfigType("properties")
-	viper.SetConfigFile(filename)
-
-	err := viper.ReadInConfig()
-	if err != nil {
-		return &ProxyConfig{}, err
-	}
-
-	proxyConfig := &ProxyConfig{}
-	err = viper.Unmarshal(&proxyConfig)
-	if err != nil {
-		return proxyConfig, err
+// Default returns the configuration used when no other source sets a value.
+func Default() *ProxyConfig {
+	return &ProxyConfig{
+		PushListenerPorts:                       DefaultPushListenerPorts,
+		OpenTSDBPorts:                           DefaultOpenTSDBPorts,
+		FlushThreads:                            DefaultFlushThreads,
+		PushFlushInterval:                       DefaultFlushInterval,
+		PushFlushMaxPoints:                      DefaultFlushMaxPoints,
+		PushMemoryBufferLimit:                   DefaultMemoryBufferLimit,
+		PushListenerMaxReceivedLength:           DefaultMaxReceivedLength,
+		PushListenerMaxDecompressedSize:         DefaultMaxDecompressedSize,
+		IdFile:                                  DefaultIdFile,
+		ShutdownGracePeriodSeconds:              DefaultShutdownGracePeriod,
+		ShutdownFlushSeconds:                    DefaultShutdownFlushTime,
+		SelfMetricsIntervalSeconds:              DefaultSelfMetricsInterval,
+		DeltaCountersAggregationIntervalSeconds: DefaultDeltaInterval,
+		LogLevel:                                DefaultLogLevel,
+		LogFormat:                               DefaultLogFormat,
+		LogMaxSizeMB:                            logging.DefaultLogMaxSizeMB,
+		LogMaxAgeHours:                          logging.DefaultLogMaxAgeHours,
+		LogMaxBackups:                           logging.DefaultLogMaxBackups,
+		LogCompress:                             true,
+		BlockedPointsLogRate:                    logging.DefaultBlockedPointsRate,
+		BlockedPointsLogSamplePercent:           logging.DefaultBlockedPointsSamplePercent,
 	}
-	setDefaults(proxyConfig)
-	return proxyConfig, nil
 }
 
 func setDefaults(cfg *ProxyConfig) {
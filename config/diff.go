@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const redacted = "********"
+
+// keys whose values are never logged
+var sensitiveKeys = map[string]bool{
+	"token":             true,
+	"oauthClientSecret": true,
+}
+
+// Change of a single configuration setting.
+type Change struct {
+	Key string
+	Old interface{}
+	New interface{}
+}
+
+func (c Change) String() string {
+	if sensitiveKeys[c.Key] {
+		return fmt.Sprintf("%s: %s -> %s", c.Key, redacted, redacted)
+	}
+	return fmt.Sprintf("%s: %v -> %v", c.Key, c.Old, c.New)
+}
+
+// Diff returns the settings that differ between two configurations, in field order.
+func Diff(old, new *ProxyConfig) []Change {
+	var changes []Change
+	oldVal := reflect.ValueOf(old).Elem()
+	newVal := reflect.ValueOf(new).Elem()
+	for i := 0; i < oldVal.NumField(); i++ {
+		o, n := oldVal.Field(i).Interface(), newVal.Field(i).Interface()
+		if !reflect.DeepEqual(o, n) {
+			changes = append(changes, Change{Key: keyName(oldVal.Type().Field(i)), Old: o, New: n})
+		}
+	}
+	return changes
+}
+
+// keyName returns the configuration file key for a ProxyConfig field.
+func keyName(field reflect.StructField) string {
+	if key := field.Tag.Get("cfg"); key != "" {
+		return key
+	}
+	return strings.ToLower(field.Name[:1]) + field.Name[1:]
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old := &ProxyConfig{Token: "secret", PushListenerPorts: "2878", PushFlushInterval: 1000}
+	new := &ProxyConfig{Token: "other", PushListenerPorts: "2878,2879", PushFlushInterval: 1000}
+
+	changes := Diff(old, new)
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, found %v", changes)
+	}
+	if changes[0].Key != "token" || changes[1].Key != "pushListenerPorts" {
+		t.Errorf("unexpected changes %v", changes)
+	}
+	if s := changes[0].String(); strings.Contains(s, "secret") || strings.Contains(s, "other") {
+		t.Errorf("token not redacted: %s", s)
+	}
+	if s := changes[1].String(); s != "pushListenerPorts: 2878 -> 2878,2879" {
+		t.Errorf("unexpected change %s", s)
+	}
+
+	if changes := Diff(old, old); len(changes) != 0 {
+		t.Errorf("expected no changes, found %v", changes)
+	}
+}
@@ -0,0 +1,253 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// Prefix of the environment variables overriding config file settings,
+	// for example WAVEFRONT_PROXY_PUSH_LISTENER_PORTS for pushListenerPorts.
+	EnvPrefix = "WAVEFRONT_PROXY_"
+)
+
+// Source of a configuration setting.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// Source of each setting, keyed by config key.
+type Sources map[string]Source
+
+// Settings which could not be parsed. Load returns them along with the configuration, in which these
+// settings keep the value of the previous source.
+type ParseErrors []*ValidationError
+
+func (e ParseErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Load builds the proxy configuration from, in increasing order of precedence: the defaults, the config
+// file (if filename is set), WAVEFRONT_PROXY_* environment variables and the given flag values keyed by
+// config key. The config file format is chosen by extension: .yaml/.yml, .json or else properties.
+// Values which cannot be parsed are reported together as ParseErrors.
+func Load(filename string, flags map[string]string) (*ProxyConfig, Sources, error) {
+	cfg := Default()
+	sources := make(Sources)
+	for _, key := range Keys() {
+		sources[key] = SourceDefault
+	}
+
+	var parseErrors ParseErrors
+	if filename != "" {
+		values, err := readFile(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		parseErrors = append(parseErrors, apply(cfg, sources, values, SourceFile, filename)...)
+	}
+	parseErrors = append(parseErrors, apply(cfg, sources, readEnv(), SourceEnv, "environment")...)
+	parseErrors = append(parseErrors, apply(cfg, sources, flags, SourceFlag, "flags")...)
+
+	setDefaults(cfg)
+	if len(parseErrors) > 0 {
+		return cfg, sources, parseErrors
+	}
+	return cfg, sources, nil
+}
+
+// Keys returns the config keys of all settings.
+func Keys() []string {
+	t := reflect.TypeOf(ProxyConfig{})
+	keys := make([]string, t.NumField())
+	for i := range keys {
+		keys[i] = keyName(t.Field(i))
+	}
+	return keys
+}
+
+// IsKey returns true if key is a known config key.
+func IsKey(key string) bool {
+	_, ok := field(key)
+	return ok
+}
+
+// EnvName returns the environment variable overriding a config key.
+func EnvName(key string) string {
+	var name []rune
+	for i, r := range key {
+		if i > 0 && unicode.IsUpper(r) && unicode.IsLower(rune(key[i-1])) {
+			name = append(name, '_')
+		}
+		name = append(name, unicode.ToUpper(r))
+	}
+	return EnvPrefix + string(name)
+}
+
+// PrintEffective writes every setting along with its source, with sensitive values redacted.
+func PrintEffective(w io.Writer, cfg *ProxyConfig, sources Sources) {
+	val := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < val.NumField(); i++ {
+		key := keyName(val.Type().Field(i))
+		var value interface{} = val.Field(i).Interface()
+		if sensitiveKeys[key] && value != "" {
+			value = redacted
+		}
+		fmt.Fprintf(w, "%s=%v (%s)\n", key, value, sources[key])
+	}
+}
+
+func fileType(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".json":
+		return "json"
+	}
+	return "properties"
+}
+
+// UnknownKeys returns the keys in a config file which are not proxy settings, usually misspelled keys.
+func UnknownKeys(filename string) ([]string, error) {
+	v, err := readViper(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// viper keys are case insensitive
+	known := make(map[string]bool)
+	for _, key := range Keys() {
+		known[strings.ToLower(key)] = true
+	}
+	var unknown []string
+	for _, key := range v.AllKeys() {
+		if !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown, nil
+}
+
+func readViper(filename string) (*viper.Viper, error) {
+	v := viper.New()
+	v.SetConfigType(fileType(filename))
+	v.SetConfigFile(filename)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func readFile(filename string) (map[string]string, error) {
+	log.Println("Loading configuration from", filename)
+
+	v, err := readViper(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	for _, key := range Keys() {
+		if !v.IsSet(key) {
+			continue
+		}
+		// allow lists such as ports to be written as YAML or JSON arrays
+		if list, ok := v.Get(key).([]interface{}); ok {
+			items := make([]string, len(list))
+			for i, item := range list {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		} else {
+			values[key] = v.GetString(key)
+		}
+	}
+	return values, nil
+}
+
+func readEnv() map[string]string {
+	values := make(map[string]string)
+	for _, key := range Keys() {
+		if value, ok := os.LookupEnv(EnvName(key)); ok {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// apply sets the given values and returns the ones which could not be parsed, where names their origin.
+func apply(cfg *ProxyConfig, sources Sources, values map[string]string, source Source, where string) ParseErrors {
+	var parseErrors ParseErrors
+	for _, key := range Keys() {
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+		if err := set(cfg, key, value); err != nil {
+			parseErrors = append(parseErrors, &ValidationError{Key: key, Message: fmt.Sprintf("%v (%s)", err, where)})
+			continue
+		}
+		sources[key] = source
+	}
+	return parseErrors
+}
+
+// set parses value into the setting with the given key.
+func set(cfg *ProxyConfig, key, value string) error {
+	f, ok := field(key)
+	if !ok {
+		return errors.New("unknown key")
+	}
+
+	v := reflect.ValueOf(cfg).Elem().FieldByIndex(f.Index)
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Int:
+		i, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid value %q, expected a number", value)
+		}
+		v.SetInt(int64(i))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid value %q, expected a boolean", value)
+		}
+		v.SetBool(b)
+	default:
+		return errors.New("unsupported type")
+	}
+	return nil
+}
+
+func field(key string) (reflect.StructField, bool) {
+	t := reflect.TypeOf(ProxyConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		if keyName(t.Field(i)) == key {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
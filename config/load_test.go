@@ -0,0 +1,104 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, dir, name, content string) string {
+	filename := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestLoadFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := []string{
+		writeConfigFile(t, dir, "wavefront.conf", "server=https://foo/api\npushListenerPorts=2878,2879\nflushThreads=8\n"),
+		writeConfigFile(t, dir, "wavefront.yaml", "server: https://foo/api\npushListenerPorts: [2878, 2879]\nflushThreads: 8\n"),
+		writeConfigFile(t, dir, "wavefront.json", `{"server": "https://foo/api", "pushListenerPorts": "2878,2879", "flushThreads": 8}`),
+	}
+
+	for _, filename := range files {
+		cfg, sources, err := Load(filename, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Server != "https://foo/api" || cfg.PushListenerPorts != "2878,2879" || cfg.FlushThreads != 8 {
+			t.Errorf("%s: unexpected config %+v", filename, cfg)
+		}
+		if cfg.OpenTSDBPorts != DefaultOpenTSDBPorts || sources["opentsdbPorts"] != SourceDefault {
+			t.Errorf("%s: expected default opentsdbPorts", filename)
+		}
+		if sources["server"] != SourceFile {
+			t.Errorf("%s: expected server from file, found %s", filename, sources["server"])
+		}
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := writeConfigFile(t, dir, "wavefront.conf", "token=file\nflushThreads=8\npushFlushInterval=2000\n")
+	os.Setenv("WAVEFRONT_PROXY_FLUSH_THREADS", "6")
+	os.Setenv("WAVEFRONT_PROXY_TOKEN", "env")
+	defer os.Unsetenv("WAVEFRONT_PROXY_FLUSH_THREADS")
+	defer os.Unsetenv("WAVEFRONT_PROXY_TOKEN")
+
+	cfg, sources, err := Load(filename, map[string]string{"token": "flag"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]Source{"token": SourceFlag, "flushThreads": SourceEnv, "pushFlushInterval": SourceFile}
+	for key, source := range expected {
+		if sources[key] != source {
+			t.Errorf("expected %s from %s, found %s", key, source, sources[key])
+		}
+	}
+	if cfg.Token != "flag" || cfg.FlushThreads != 6 || cfg.PushFlushInterval != 2000 {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	filename = writeConfigFile(t, dir, "invalid.conf", "flushThreads=many\nlogCompress=maybe\npushFlushInterval=2000\n")
+	cfg, _, err = Load(filename, map[string]string{"pushFlushMaxPoints": "lots"})
+	parseErrors, ok := err.(ParseErrors)
+	if !ok || len(parseErrors) != 3 {
+		t.Fatalf("expected 3 parse errors, found %v", err)
+	}
+	for i, key := range []string{"flushThreads", "logCompress", "pushFlushMaxPoints"} {
+		if parseErrors[i].Key != key {
+			t.Errorf("expected a parse error for %s, found %v", key, parseErrors[i])
+		}
+	}
+	// flushThreads is still set in the environment
+	if cfg.PushFlushInterval != 2000 || cfg.FlushThreads != 6 {
+		t.Errorf("expected the valid settings to be applied, found %+v", cfg)
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	expected := map[string]string{
+		"pushListenerPorts": "WAVEFRONT_PROXY_PUSH_LISTENER_PORTS",
+		"opentsdbPorts":     "WAVEFRONT_PROXY_OPENTSDB_PORTS",
+		"idFile":            "WAVEFRONT_PROXY_ID_FILE",
+	}
+	for key, name := range expected {
+		if EnvName(key) != name {
+			t.Errorf("expected %s, found %s", name, EnvName(key))
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Key of the section of a port keyed file which applies to every port.
+const GlobalKey = "global"
+
+// Port keyed file, such as the preprocessor rules or validation policy file. Each section is keyed by
+// a comma separated port list, or by the global key.
+type PortFile struct {
+	// nil if the file has no global section
+	Global *PortSection
+	// sorted by key, so ports listed under several keys are configured in a stable order
+	Sections []*PortSection
+}
+
+// Settings of a port list, or of the global key.
+type PortSection struct {
+	Key   string
+	Ports []int
+	value interface{}
+	lax   bool
+}
+
+// ParsePortFile splits a port keyed file into its sections. Unless lax is set, decoding a section
+// rejects unknown fields.
+func ParsePortFile(data []byte, lax bool) (*PortFile, error) {
+	var sections map[string]interface{}
+	unmarshal := yaml.UnmarshalStrict
+	if lax {
+		unmarshal = yaml.Unmarshal
+	}
+	if err := unmarshal(data, &sections); err != nil {
+		return nil, err
+	}
+
+	file := &PortFile{}
+	for key, value := range sections {
+		section := &PortSection{Key: key, value: value, lax: lax}
+		if strings.TrimSpace(key) == GlobalKey {
+			if file.Global != nil {
+				return nil, fmt.Errorf("duplicate %s section", GlobalKey)
+			}
+			file.Global = section
+			continue
+		}
+		for _, portStr := range strings.Split(key, ",") {
+			port, err := strconv.Atoi(strings.TrimSpace(portStr))
+			if err != nil || port <= 0 || port > 65535 {
+				return nil, fmt.Errorf("invalid port %q", portStr)
+			}
+			section.Ports = append(section.Ports, port)
+		}
+		file.Sections = append(file.Sections, section)
+	}
+	sort.Slice(file.Sections, func(i, j int) bool { return file.Sections[i].Key < file.Sections[j].Key })
+	return file, nil
+}
+
+// Decode unmarshals the section into out. Fields of out missing from the section keep their values.
+func (s *PortSection) Decode(out interface{}) error {
+	data, err := yaml.Marshal(s.value)
+	if err != nil {
+		return err
+	}
+	if s.lax {
+		return yaml.Unmarshal(data, out)
+	}
+	return yaml.UnmarshalStrict(data, out)
+}
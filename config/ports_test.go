@@ -0,0 +1,47 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePortFile(t *testing.T) {
+	file, err := ParsePortFile([]byte("'4242':\n  a: 2\nglobal:\n  a: 1\n  b: 1\n'2878, 2879':\n  b: 3\n"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Global == nil || len(file.Sections) != 2 {
+		t.Fatalf("unexpected sections %+v", file)
+	}
+	if ports := file.Sections[0].Ports; !reflect.DeepEqual(ports, []int{2878, 2879}) {
+		t.Errorf("expected the 2878 section first, found ports %v", ports)
+	}
+
+	var settings struct{ A, B int }
+	for _, section := range []*PortSection{file.Global, file.Sections[1]} {
+		if err := section.Decode(&settings); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if settings.A != 2 || settings.B != 1 {
+		t.Errorf("expected the port section to override the global one, found %+v", settings)
+	}
+
+	var other struct{ C int }
+	if err := file.Global.Decode(&other); err == nil {
+		t.Error("expected an error for unknown fields")
+	}
+	if file, err = ParsePortFile([]byte("global:\n  a: 1\n"), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Global.Decode(&other); err != nil {
+		t.Errorf("expected unknown fields to be ignored, found %v", err)
+	}
+
+	for _, invalid := range []string{"'abc':\n  a: 1\n", "'0':\n  a: 1\n", "'65536':\n  a: 1\n", "'2878,':\n  a: 1\n",
+		"global:\n  a: 1\n' global':\n  a: 2\n", "- a\n"} {
+		if _, err := ParsePortFile([]byte(invalid), false); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
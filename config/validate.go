@@ -0,0 +1,248 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wavefronthq/go-proxy/logging"
+)
+
+const (
+	// Upper limit for flushThreads, larger values fall back to DefaultFlushThreads.
+	MaxFlushThreads = 16
+	// Lower limit for pushFlushInterval, smaller values are raised to it.
+	MinFlushInterval = 1000
+)
+
+// Problem with a configuration setting.
+type ValidationError struct {
+	Key     string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Key, e.Message)
+}
+
+// Validate checks the configuration and returns every problem found.
+func Validate(cfg *ProxyConfig) []*ValidationError {
+	v := &validator{}
+	v.checkServer(cfg.Server)
+	v.checkAuth(cfg)
+	v.checkPorts(cfg)
+
+	v.check(cfg.FlushThreads > 0 && cfg.FlushThreads <= MaxFlushThreads, "flushThreads",
+		"must be between 1 and %d, found %d", MaxFlushThreads, cfg.FlushThreads)
+	v.check(cfg.PushFlushInterval >= MinFlushInterval, "pushFlushInterval",
+		"must be at least %d milliseconds, found %d", MinFlushInterval, cfg.PushFlushInterval)
+	v.check(cfg.PushFlushMaxPoints > 0, "pushFlushMaxPoints",
+		"must be positive, found %d", cfg.PushFlushMaxPoints)
+	v.check(cfg.PushMemoryBufferLimit >= cfg.PushFlushMaxPoints, "pushMemoryBufferLimit",
+		"must be at least pushFlushMaxPoints (%d), found %d", cfg.PushFlushMaxPoints, cfg.PushMemoryBufferLimit)
+	v.check(cfg.PushListenerMaxReceivedLength > 0, "pushListenerMaxReceivedLength",
+		"must be positive, found %d", cfg.PushListenerMaxReceivedLength)
+	v.check(cfg.PushListenerMaxDecompressedSize >= 0, "pushListenerMaxDecompressedSize",
+		"must not be negative, found %d", cfg.PushListenerMaxDecompressedSize)
+	v.check(cfg.ShutdownGracePeriodSeconds >= 0, "shutdownGracePeriodSeconds",
+		"must not be negative, found %d", cfg.ShutdownGracePeriodSeconds)
+	v.check(cfg.ShutdownFlushSeconds >= 0, "shutdownFlushSeconds",
+		"must not be negative, found %d", cfg.ShutdownFlushSeconds)
+	v.check(cfg.DataBackfillCutoffHours >= 0, "dataBackfillCutoffHours",
+		"must not be negative, found %d", cfg.DataBackfillCutoffHours)
+	v.check(cfg.DataPrefillCutoffHours >= 0, "dataPrefillCutoffHours",
+		"must not be negative, found %d", cfg.DataPrefillCutoffHours)
+	v.check(cfg.DeltaCountersAggregationIntervalSeconds >= 0, "deltaCountersAggregationIntervalSeconds",
+		"must not be negative, found %d", cfg.DeltaCountersAggregationIntervalSeconds)
+	v.check(cfg.SelfMetricsIntervalSeconds >= 0, "selfMetricsIntervalSeconds",
+		"must not be negative, found %d", cfg.SelfMetricsIntervalSeconds)
+
+	if cfg.PreprocessorConfigFile != "" {
+		v.checkReadable("preprocessorConfigFile", cfg.PreprocessorConfigFile)
+	}
+	if cfg.ValidationPolicyFile != "" {
+		v.checkReadable("validationPolicyFile", cfg.ValidationPolicyFile)
+	}
+	if cfg.CumulativeCountersFile != "" {
+		v.checkReadable("cumulativeCountersFile", cfg.CumulativeCountersFile)
+	}
+	if cfg.CustomFormatsFile != "" {
+		v.checkReadable("customFormatsFile", cfg.CustomFormatsFile)
+	}
+	v.checkWritable("idFile", cfg.IdFile)
+	if cfg.LogFile != "" {
+		v.checkWritable("logFile", cfg.LogFile)
+	}
+	if _, err := logging.ParseLevel(cfg.LogLevel); err != nil {
+		v.addError("logLevel", "%v", err)
+	}
+	if _, err := logging.ParseFormat(cfg.LogFormat); err != nil {
+		v.addError("logFormat", "%v", err)
+	}
+	v.check(cfg.LogMaxSizeMB >= 0, "logMaxSizeMB", "must not be negative, found %d", cfg.LogMaxSizeMB)
+	v.check(cfg.LogMaxAgeHours >= 0, "logMaxAgeHours", "must not be negative, found %d", cfg.LogMaxAgeHours)
+	v.check(cfg.LogMaxBackups >= 0, "logMaxBackups", "must not be negative, found %d", cfg.LogMaxBackups)
+	if cfg.BlockedPointsLogFile != "" {
+		v.checkWritable("blockedPointsLogFile", cfg.BlockedPointsLogFile)
+	}
+	v.check(cfg.BlockedPointsLogRate >= 0, "blockedPointsLogRate",
+		"must not be negative, found %d", cfg.BlockedPointsLogRate)
+	v.check(cfg.BlockedPointsLogSamplePercent >= 0 && cfg.BlockedPointsLogSamplePercent <= 100,
+		"blockedPointsLogSamplePercent", "must be between 0 and 100, found %d", cfg.BlockedPointsLogSamplePercent)
+	return v.errors
+}
+
+type validator struct {
+	errors []*ValidationError
+}
+
+func (v *validator) addError(key, format string, args ...interface{}) {
+	v.errors = append(v.errors, &ValidationError{Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) check(ok bool, key, format string, args ...interface{}) {
+	if !ok {
+		v.addError(key, format, args...)
+	}
+}
+
+func (v *validator) checkServer(server string) {
+	if server == "" {
+		v.addError("server", "missing server")
+		return
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		v.addError("server", "invalid URL: %v", err)
+		return
+	}
+	v.check(u.Scheme == "http" || u.Scheme == "https", "server", "URL scheme must be http or https, found %q", u.Scheme)
+	v.check(u.Host != "", "server", "URL %q has no host", server)
+}
+
+// checkAuth checks that exactly one way of authenticating with the Wavefront API is configured.
+func (v *validator) checkAuth(cfg *ProxyConfig) {
+	var keys []string
+	for key, value := range map[string]string{
+		"token":         cfg.Token,
+		"tokenFile":     cfg.TokenFile,
+		"oauthTokenUrl": cfg.OAuthTokenURL,
+	} {
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	switch {
+	case len(keys) == 0:
+		v.addError("token", "missing token, set one of token, tokenFile or oauthTokenUrl")
+	case len(keys) > 1:
+		v.addError(keys[1], "only one of token, tokenFile and oauthTokenUrl may be set, found %s", strings.Join(keys, " and "))
+	}
+
+	if cfg.TokenFile != "" {
+		v.checkReadable("tokenFile", cfg.TokenFile)
+	}
+	if cfg.OAuthTokenURL != "" {
+		if u, err := url.Parse(cfg.OAuthTokenURL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			v.addError("oauthTokenUrl", "invalid URL %q", cfg.OAuthTokenURL)
+		}
+		v.check(cfg.OAuthClientID != "", "oauthClientId", "required with oauthTokenUrl")
+		v.check(cfg.OAuthClientSecret != "", "oauthClientSecret", "required with oauthTokenUrl")
+	}
+}
+
+// checkPorts checks the syntax of the listener ports and that no port is used twice.
+func (v *validator) checkPorts(cfg *ProxyConfig) {
+	used := make(map[int]string)
+	use := func(key string, port int) {
+		if other, ok := used[port]; ok {
+			v.addError(key, "port %d is also used by %s", port, other)
+			return
+		}
+		used[port] = key
+	}
+
+	for _, key := range []string{"pushListenerPorts", "opentsdbPorts"} {
+		portsList := cfg.PushListenerPorts
+		if key == "opentsdbPorts" {
+			portsList = cfg.OpenTSDBPorts
+		}
+		if portsList == "" {
+			continue
+		}
+		for _, portStr := range strings.Split(portsList, ",") {
+			port, err := strconv.Atoi(portStr)
+			if err != nil || port <= 0 || port > 65535 {
+				v.addError(key, "invalid port %q", portStr)
+				continue
+			}
+			use(key, port)
+		}
+	}
+
+	for _, key := range []string{"pprofAddr", "adminAddr"} {
+		addr := cfg.PprofAddr
+		if key == "adminAddr" {
+			addr = cfg.AdminAddr
+		}
+		if addr == "" {
+			continue
+		}
+		_, portStr, err := net.SplitHostPort(addr)
+		if err != nil {
+			v.addError(key, "invalid address %q: %v", addr, err)
+			continue
+		}
+		if port, err := strconv.Atoi(portStr); err == nil {
+			use(key, port)
+		}
+	}
+}
+
+func (v *validator) checkReadable(key, filename string) {
+	f, err := os.Open(filename)
+	if err != nil {
+		v.addError(key, "cannot read %s: %v", filename, err)
+		return
+	}
+	f.Close()
+}
+
+// checkWritable checks that an existing file can be opened for writing, or else that it can be created.
+func (v *validator) checkWritable(key, filename string) {
+	info, err := os.Stat(filename)
+	if err == nil {
+		if info.IsDir() {
+			v.addError(key, "%s is a directory", filename)
+			return
+		}
+		f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			v.addError(key, "cannot write %s: %v", filename, err)
+			return
+		}
+		f.Close()
+		return
+	}
+	if !os.IsNotExist(err) {
+		v.addError(key, "cannot access %s: %v", filename, err)
+		return
+	}
+
+	dir := filepath.Dir(filename)
+	f, err := ioutil.TempFile(dir, ".wavefront-proxy-validate")
+	if err != nil {
+		v.addError(key, "cannot create %s: %v", filename, err)
+		return
+	}
+	f.Close()
+	os.Remove(f.Name())
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func validConfig(dir string) *ProxyConfig {
+	cfg := Default()
+	cfg.Server = "https://foo.wavefront.com/api"
+	cfg.Token = "token"
+	cfg.IdFile = filepath.Join(dir, ".wavefront_id")
+	return cfg
+}
+
+func problemKeys(problems []*ValidationError) map[string]bool {
+	keys := make(map[string]bool)
+	for _, problem := range problems {
+		keys[problem.Key] = true
+	}
+	return keys
+}
+
+func TestValidateDefaults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if problems := Validate(validConfig(dir)); len(problems) != 0 {
+		t.Errorf("expected no problems, found %v", problems)
+	}
+}
+
+func TestValidateProblems(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := validConfig(dir)
+	cfg.Server = "foo.wavefront.com/api"
+	cfg.Token = ""
+	cfg.PushListenerPorts = "2878,abc"
+	cfg.OpenTSDBPorts = "2878"
+	cfg.FlushThreads = 32
+	cfg.PushFlushInterval = 10
+	cfg.PushMemoryBufferLimit = 10
+	cfg.PreprocessorConfigFile = filepath.Join(dir, "missing.yaml")
+	cfg.LogFile = filepath.Join(dir, "missing", "proxy.log")
+	cfg.LogMaxBackups = -1
+
+	problems := Validate(cfg)
+	keys := problemKeys(problems)
+	for _, key := range []string{"server", "token", "pushListenerPorts", "opentsdbPorts", "flushThreads",
+		"pushFlushInterval", "pushMemoryBufferLimit", "preprocessorConfigFile", "logFile", "logMaxBackups"} {
+		if !keys[key] {
+			t.Errorf("expected a problem with %s, found %v", key, problems)
+		}
+	}
+	if keys["idFile"] || keys["pushFlushMaxPoints"] {
+		t.Errorf("unexpected problems %v", problems)
+	}
+}
+
+func TestUnknownKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := writeConfigFile(t, dir, "wavefront.conf", "server=https://foo/api\nflushThread=8\nPushFlushInterval=2000\n")
+	unknown, err := UnknownKeys(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unknown) != 1 || unknown[0] != "flushthread" {
+		t.Errorf("expected [flushthread], found %v", unknown)
+	}
+}
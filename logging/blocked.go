@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBlockedPointsRate          = 10
+	DefaultBlockedPointsSamplePercent = 100
+)
+
+// Logs blocked points to a dedicated output. A sample of the blocked points is logged, limited to a
+// number of lines per second, so that a misbehaving client cannot flood the log.
+type BlockedLogger struct {
+	logger        *Logger
+	mtx           sync.Mutex
+	samplePercent int
+	limiter       *rateLimiter
+}
+
+// NewBlockedLogger returns a logger writing at most perSecond lines per second (0 disables it)
+// for samplePercent percent of the blocked points.
+func NewBlockedLogger(out io.Writer, format Format, perSecond, samplePercent int) *BlockedLogger {
+	return &BlockedLogger{
+		logger:        New(out, format, LevelInfo),
+		samplePercent: samplePercent,
+		limiter:       newRateLimiter(float64(perSecond)),
+	}
+}
+
+// Log records a blocked point line received by a listener port from a client.
+// Returns true if the point was logged, false if it was sampled out or rate limited, or b is nil.
+func (b *BlockedLogger) Log(port, client, line string, reason error) bool {
+	if b == nil {
+		return false
+	}
+	b.mtx.Lock()
+	if b.samplePercent < 100 && rand.Intn(100) >= b.samplePercent {
+		b.mtx.Unlock()
+		return false
+	}
+	allowed := b.limiter.allow(time.Now())
+	b.mtx.Unlock()
+	if !allowed {
+		return false
+	}
+	b.logger.Info("blocked point", blockedFields(port, client, line, reason)...)
+	return true
+}
+
+// blockedFields marks the offset of the problem in the line if the reason has a position, such as a
+// parse error.
+func blockedFields(port, client, line string, reason error) []interface{} {
+	fields := []interface{}{"port", port, "client", client, "reason", reason}
+	if pos, ok := reason.(interface{ Position() int }); ok {
+		offset := pos.Position()
+		return append(fields, "offset", offset, "line", MarkedLine{Line: line, Offset: offset})
+	}
+	return append(fields, "line", line)
+}
+
+// Token bucket allowing rate events per second, with bursts of up to one second worth of events.
+type rateLimiter struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	return &rateLimiter{rate: rate, tokens: rate}
+}
+
+func (r *rateLimiter) allow(now time.Time) bool {
+	if r.rate <= 0 {
+		return false
+	}
+	if !r.last.IsZero() {
+		r.tokens += now.Sub(r.last).Seconds() * r.rate
+		if r.tokens > r.rate {
+			r.tokens = r.rate
+		}
+	}
+	r.last = now
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
+
+// blocked points are not logged until SetBlockedPoints is called
+var blocked *BlockedLogger
+
+// SetBlockedPoints replaces the logger used by LogBlockedPoint, nil turns blocked point logging off.
+func SetBlockedPoints(b *BlockedLogger) {
+	blocked = b
+}
+
+// LogBlockedPoint logs a blocked point with the logger set by SetBlockedPoints.
+func LogBlockedPoint(port, client, line string, reason error) bool {
+	return blocked.Log(port, client, line, reason)
+}
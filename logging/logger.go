@@ -0,0 +1,267 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Severity of a log record.
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l >= LevelDebug && int(l) < len(levelNames) {
+		return levelNames[l]
+	}
+	return strconv.Itoa(int(l))
+}
+
+// ParseLevel parses a level name: debug, info, warn or error.
+func ParseLevel(s string) (Level, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	if name == "warning" {
+		name = "warn"
+	}
+	for i, levelName := range levelNames {
+		if name == levelName {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("invalid log level %q, expected one of %s", s, strings.Join(levelNames, ", "))
+}
+
+// Output format of log records.
+type Format string
+
+const (
+	// 2006/01/02 15:04:05 INFO message key=value, similar to the standard log package
+	FormatText Format = "text"
+	// time=... level=info msg="message" key=value
+	FormatLogfmt Format = "logfmt"
+	// {"time": ..., "level": "info", "msg": "message", "key": "value"}
+	FormatJSON Format = "json"
+)
+
+// ParseFormat parses a format name: text, logfmt or json.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case FormatText, FormatLogfmt, FormatJSON:
+		return f, nil
+	case "":
+		return FormatText, nil
+	}
+	return FormatText, fmt.Errorf("invalid log format %q, expected text, logfmt or json", s)
+}
+
+// Leveled logger writing records with key/value fields. The level can be changed at any time.
+type Logger struct {
+	level  int32
+	mtx    sync.Mutex
+	out    io.Writer
+	format Format
+}
+
+func New(out io.Writer, format Format, level Level) *Logger {
+	return &Logger{out: out, format: format, level: int32(level)}
+}
+
+func (l *Logger) SetLevel(level Level) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+func (l *Logger) Level() Level {
+	return Level(atomic.LoadInt32(&l.level))
+}
+
+// Enabled returns true if records of the given level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.Level()
+}
+
+func (l *Logger) SetOutput(out io.Writer) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.out = out
+}
+
+func (l *Logger) SetFormat(format Format) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.format = format
+}
+
+func (l *Logger) Debug(msg string, keyvals ...interface{}) { l.Log(LevelDebug, msg, keyvals...) }
+func (l *Logger) Info(msg string, keyvals ...interface{})  { l.Log(LevelInfo, msg, keyvals...) }
+func (l *Logger) Warn(msg string, keyvals ...interface{})  { l.Log(LevelWarn, msg, keyvals...) }
+func (l *Logger) Error(msg string, keyvals ...interface{}) { l.Log(LevelError, msg, keyvals...) }
+
+// Log writes a record if the level is enabled. keyvals are alternating keys and values.
+func (l *Logger) Log(level Level, msg string, keyvals ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	now := time.Now()
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	var buf bytes.Buffer
+	switch l.format {
+	case FormatJSON:
+		writeJSON(&buf, now, level, msg, keyvals)
+	case FormatLogfmt:
+		writeLogfmt(&buf, now, level, msg, keyvals)
+	default:
+		writeText(&buf, now, level, msg, keyvals)
+	}
+	l.out.Write(buf.Bytes())
+}
+
+func writeText(buf *bytes.Buffer, now time.Time, level Level, msg string, keyvals []interface{}) {
+	buf.WriteString(now.Format("2006/01/02 15:04:05 "))
+	buf.WriteString(strings.ToUpper(level.String()))
+	buf.WriteByte(' ')
+	buf.WriteString(msg)
+	column := writeFields(buf, keyvals)
+	buf.WriteByte('\n')
+	if column >= 0 {
+		buf.WriteString(strings.Repeat(" ", column))
+		buf.WriteString("^\n")
+	}
+}
+
+func writeLogfmt(buf *bytes.Buffer, now time.Time, level Level, msg string, keyvals []interface{}) {
+	buf.WriteString("time=")
+	buf.WriteString(now.Format(time.RFC3339Nano))
+	buf.WriteString(" level=")
+	buf.WriteString(level.String())
+	buf.WriteString(" msg=")
+	buf.WriteString(logfmtValue(msg))
+	writeFields(buf, keyvals)
+	buf.WriteByte('\n')
+}
+
+// writeFields returns the column of the mark of the first MarkedLine value, or -1 if there is none.
+func writeFields(buf *bytes.Buffer, keyvals []interface{}) int {
+	column := -1
+	for i := 0; i < len(keyvals); i += 2 {
+		buf.WriteByte(' ')
+		buf.WriteString(fieldKey(keyvals, i))
+		buf.WriteByte('=')
+		if i+1 < len(keyvals) {
+			if m, ok := keyvals[i+1].(MarkedLine); ok && column < 0 {
+				column = utf8.RuneCount(buf.Bytes()) + m.column()
+			}
+		}
+		buf.WriteString(logfmtValue(fieldValue(keyvals, i)))
+	}
+	return column
+}
+
+// Line logged with a caret under the byte at Offset by the text format. The other formats log the
+// line only.
+type MarkedLine struct {
+	Line   string
+	Offset int
+}
+
+func (m MarkedLine) String() string {
+	return m.Line
+}
+
+// column returns the column of the marked byte in the line formatted by logfmtValue.
+func (m MarkedLine) column() int {
+	offset := m.Offset
+	if offset < 0 {
+		offset = 0
+	} else if offset > len(m.Line) {
+		offset = len(m.Line)
+	}
+	if logfmtValue(m.Line) == m.Line {
+		return utf8.RuneCountInString(m.Line[:offset])
+	}
+	// the opening quote and the escaped prefix, without the closing quote
+	return utf8.RuneCountInString(strconv.Quote(m.Line[:offset])) - 1
+}
+
+func writeJSON(buf *bytes.Buffer, now time.Time, level Level, msg string, keyvals []interface{}) {
+	record := make(map[string]interface{}, 3+len(keyvals)/2)
+	record["time"] = now.Format(time.RFC3339Nano)
+	record["level"] = level.String()
+	record["msg"] = msg
+	for i := 0; i < len(keyvals); i += 2 {
+		value := keyvals[i+1:]
+		if len(value) == 0 {
+			record[fieldKey(keyvals, i)] = nil
+			continue
+		}
+		switch v := value[0].(type) {
+		case error:
+			record[fieldKey(keyvals, i)] = v.Error()
+		case fmt.Stringer:
+			record[fieldKey(keyvals, i)] = v.String()
+		default:
+			record[fieldKey(keyvals, i)] = v
+		}
+	}
+	// encoding/json sorts the keys, which keeps records stable
+	if err := json.NewEncoder(buf).Encode(record); err != nil {
+		fmt.Fprintf(buf, `{"level":%q,"msg":%q,"error":%q}`+"\n", level.String(), msg, err.Error())
+	}
+}
+
+func fieldKey(keyvals []interface{}, i int) string {
+	return fmt.Sprint(keyvals[i])
+}
+
+func fieldValue(keyvals []interface{}, i int) string {
+	if i+1 >= len(keyvals) {
+		return ""
+	}
+	return fmt.Sprint(keyvals[i+1])
+}
+
+// logfmtValue quotes a value containing spaces, quotes, equals signs or control characters.
+func logfmtValue(s string) string {
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if r == ' ' || r == '=' || r == '"' || !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+// the default logger, used by the package level functions
+var std = New(os.Stderr, FormatText, LevelInfo)
+
+// Default returns the default logger.
+func Default() *Logger { return std }
+
+func SetLevel(level Level)    { std.SetLevel(level) }
+func SetOutput(out io.Writer) { std.SetOutput(out) }
+func SetFormat(format Format) { std.SetFormat(format) }
+
+func Debug(msg string, keyvals ...interface{}) { std.Log(LevelDebug, msg, keyvals...) }
+func Info(msg string, keyvals ...interface{})  { std.Log(LevelInfo, msg, keyvals...) }
+func Warn(msg string, keyvals ...interface{})  { std.Log(LevelWarn, msg, keyvals...) }
+func Error(msg string, keyvals ...interface{}) { std.Log(LevelError, msg, keyvals...) }
@@ -0,0 +1,137 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLevels(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, FormatLogfmt, LevelWarn)
+	logger.Info("hidden")
+	logger.Warn("shown")
+	logger.SetLevel(LevelDebug)
+	logger.Debug("debug shown")
+
+	out := buf.String()
+	if strings.Contains(out, "hidden") || !strings.Contains(out, "level=warn msg=shown") ||
+		!strings.Contains(out, `level=debug msg="debug shown"`) {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if level, err := ParseLevel(" WARNING "); err != nil || level != LevelWarn {
+		t.Errorf("expected warn, found %v %v", level, err)
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestFormats(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, FormatLogfmt, LevelInfo)
+	logger.Info("blocked point", "port", 2878, "reason", errors.New("bad point"), "line", `a.b 1 x="y"`)
+	if line := buf.String(); !strings.HasSuffix(line,
+		`level=info msg="blocked point" port=2878 reason="bad point" line="a.b 1 x=\"y\""`+"\n") {
+		t.Errorf("unexpected logfmt output %s", line)
+	}
+
+	buf.Reset()
+	logger.SetFormat(FormatJSON)
+	logger.Error("failed", "error", errors.New("timeout"), "count", 3)
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["level"] != "error" || record["msg"] != "failed" || record["error"] != "timeout" || record["count"] != 3.0 {
+		t.Errorf("unexpected json output %s", buf.String())
+	}
+
+	buf.Reset()
+	logger.SetFormat(FormatText)
+	logger.Info("started", "port", 2878)
+	if line := buf.String(); !strings.HasSuffix(line, " INFO started port=2878\n") {
+		t.Errorf("unexpected text output %s", line)
+	}
+}
+
+func TestBlockedLoggerRateLimit(t *testing.T) {
+	var buf bytes.Buffer
+	b := NewBlockedLogger(&buf, FormatLogfmt, 2, 100)
+	logged := 0
+	for i := 0; i < 10; i++ {
+		if b.Log("2878", "127.0.0.1:1234", "bad", errors.New("invalid")) {
+			logged++
+		}
+	}
+	if logged != 2 || strings.Count(buf.String(), "\n") != 2 {
+		t.Errorf("expected 2 lines logged, found %d:\n%s", logged, buf.String())
+	}
+	if !strings.Contains(buf.String(), "port=2878 client=127.0.0.1:1234 reason=invalid line=bad") {
+		t.Errorf("unexpected output %s", buf.String())
+	}
+
+	if b := NewBlockedLogger(&buf, FormatLogfmt, 10, 0); b.Log("2878", "", "bad", errors.New("invalid")) {
+		t.Error("expected a 0% sample to log nothing")
+	}
+	if (*BlockedLogger)(nil).Log("2878", "", "bad", errors.New("invalid")) {
+		t.Error("expected a nil logger to log nothing")
+	}
+}
+
+// error with a position, like a parse error
+type positionError int
+
+func (e positionError) Error() string { return "bad character" }
+func (e positionError) Position() int { return int(e) }
+
+func TestBlockedLoggerCaret(t *testing.T) {
+	for _, test := range []struct {
+		line   string
+		offset int
+		marked string
+	}{
+		{"a.b#c", 3, "#"},
+		// quoted lines are marked after the opening quote and escapes
+		{`a"b x#=y`, 5, "#"},
+		// the end of the line is marked before the closing quote
+		{"a.b 1 ", 6, `"`},
+	} {
+		var buf bytes.Buffer
+		NewBlockedLogger(&buf, FormatText, 10, 100).Log("2878", "", test.line, positionError(test.offset))
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		if len(lines) != 2 || !strings.Contains(lines[0], fmt.Sprintf("offset=%d ", test.offset)) {
+			t.Errorf("expected the offset and a caret line, found %s", buf.String())
+			continue
+		}
+		column := strings.Index(lines[1], "^")
+		if column < 0 || strings.TrimSpace(lines[1]) != "^" || string([]rune(lines[0])[column]) != test.marked {
+			t.Errorf("expected a caret under %s, found\n%s", test.marked, buf.String())
+		}
+	}
+
+	// other formats log the line only
+	var buf bytes.Buffer
+	NewBlockedLogger(&buf, FormatLogfmt, 10, 100).Log("2878", "", "a.b#c 1", positionError(3))
+	if !strings.HasSuffix(buf.String(), `offset=3 line="a.b#c 1"`+"\n") {
+		t.Errorf("unexpected output %s", buf.String())
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	r := newRateLimiter(1)
+	now := time.Now()
+	if !r.allow(now) || r.allow(now) {
+		t.Error("expected a burst of 1")
+	}
+	if !r.allow(now.Add(time.Second)) {
+		t.Error("expected a token after 1 second")
+	}
+}
@@ -0,0 +1,275 @@
+package logging
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultLogMaxSizeMB   = 100
+	DefaultLogMaxAgeHours = 24
+	DefaultLogMaxBackups  = 7
+
+	backupTimeFormat = "20060102-150405.000"
+	compressSuffix   = ".gz"
+	// suffix of the file holding the creation time of the log, which is not a backup
+	createdSuffix = ".created"
+)
+
+// Log file opened in append mode, rotated when it grows past a size or an age. Rotated files are
+// renamed to <filename>.<timestamp>, optionally gzipped, and pruned down to a number of backups.
+type RotatingFile struct {
+	filename   string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	compress   bool
+
+	mtx     sync.Mutex
+	file    *os.File
+	size    int64
+	created time.Time
+
+	// serializes the compression and pruning of backups, which run in the background
+	cleanupMtx sync.Mutex
+	cleanupWg  sync.WaitGroup
+}
+
+// OpenRotatingFile opens filename for appending. A maxSize or maxAge of 0 disables that trigger,
+// a maxBackups of 0 keeps every backup.
+func OpenRotatingFile(filename string, maxSize int64, maxAge time.Duration, maxBackups int, compress bool) (*RotatingFile, error) {
+	r := &RotatingFile{
+		filename:   filename,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+		compress:   compress,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens the file, keeping the current handle if that fails.
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file = f
+	r.size = info.Size()
+	r.created = r.creationTime(info)
+	return nil
+}
+
+// creationTime returns when the file was created, so that restarts do not postpone its rotation. A new
+// file records its creation time in <filename>.created. Without a valid record, such as for a file
+// created by an older version, that is the time of the last rotation, which names the newest backup,
+// or else the file's modification time. The latter only postpones the next age based rotation.
+func (r *RotatingFile) creationTime(info os.FileInfo) time.Time {
+	if info.Size() == 0 {
+		now := time.Now()
+		// the age is only kept across restarts if this succeeds
+		ioutil.WriteFile(r.filename+createdSuffix, []byte(now.Format(time.RFC3339Nano)), 0644)
+		return now
+	}
+	// a file modified before its recorded creation or the last rotation was replaced by something else.
+	// File times come from a coarser clock, so a record may be slightly after the first write.
+	if data, err := ioutil.ReadFile(r.filename + createdSuffix); err == nil {
+		created, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+		if err == nil && !created.After(info.ModTime().Add(time.Second)) {
+			return created
+		}
+	}
+	if backups := r.backups(); len(backups) > 0 {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(backups[len(backups)-1], r.filename+"."), compressSuffix)
+		rotated, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err == nil && !rotated.After(info.ModTime()) {
+			return rotated
+		}
+	}
+	return info.ModTime()
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	if r.shouldRotate(int64(len(p)), time.Now()) {
+		if err := r.rotate(); err != nil {
+			// keep logging to the current file rather than losing the record
+			fmt.Fprintf(os.Stderr, "Error rotating log file %s: %v\n", r.filename, err)
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) shouldRotate(pending int64, now time.Time) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.maxSize > 0 && r.size+pending > r.maxSize {
+		return true
+	}
+	return r.maxAge > 0 && now.Sub(r.created) >= r.maxAge
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := os.Rename(r.filename, r.backupName(time.Now())); err != nil {
+		return err
+	}
+	old := r.file
+	if err := r.open(); err != nil {
+		// the old handle keeps writing to the backup, try again at the next trigger
+		r.size = 0
+		r.created = time.Now()
+		return err
+	}
+	old.Close()
+	r.cleanupWg.Add(1)
+	go r.cleanup()
+	return nil
+}
+
+// backupName returns an unused name for a backup rotated at now.
+func (r *RotatingFile) backupName(now time.Time) string {
+	for {
+		name := r.filename + "." + now.Format(backupTimeFormat)
+		if !exists(name) && !exists(name+compressSuffix) {
+			return name
+		}
+		now = now.Add(time.Millisecond)
+	}
+}
+
+func exists(filename string) bool {
+	_, err := os.Lstat(filename)
+	return err == nil
+}
+
+// Rotate rotates the file now.
+func (r *RotatingFile) Rotate() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.file == nil {
+		return os.ErrClosed
+	}
+	return r.rotate()
+}
+
+// Reopen closes and reopens the file, for use after an external tool such as logrotate
+// has moved or truncated it. If the file cannot be reopened, logging continues to the old one.
+func (r *RotatingFile) Reopen() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	old := r.file
+	if err := r.open(); err != nil {
+		return err
+	}
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// Close closes the file and waits for the backups to be compressed and pruned.
+func (r *RotatingFile) Close() error {
+	r.mtx.Lock()
+	var err error
+	if r.file != nil {
+		err = r.file.Close()
+		r.file = nil
+	}
+	r.mtx.Unlock()
+	r.cleanupWg.Wait()
+	return err
+}
+
+func (r *RotatingFile) Name() string {
+	return r.filename
+}
+
+// cleanup removes the oldest backups past maxBackups and compresses the remaining ones.
+func (r *RotatingFile) cleanup() {
+	defer r.cleanupWg.Done()
+	r.cleanupMtx.Lock()
+	defer r.cleanupMtx.Unlock()
+	backups := r.backups()
+	if r.maxBackups > 0 {
+		for len(backups) > r.maxBackups {
+			if err := os.Remove(backups[0]); err != nil && !os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "Error removing log file %s: %v\n", backups[0], err)
+			}
+			backups = backups[1:]
+		}
+	}
+	if !r.compress {
+		return
+	}
+	for _, backup := range backups {
+		if strings.HasSuffix(backup, compressSuffix) {
+			continue
+		}
+		if err := compressFile(backup); err != nil {
+			fmt.Fprintf(os.Stderr, "Error compressing log file %s: %v\n", backup, err)
+		}
+	}
+}
+
+// backups returns the rotated files, oldest first. The timestamp suffix sorts chronologically.
+func (r *RotatingFile) backups() []string {
+	matches, _ := filepath.Glob(r.filename + ".*")
+	var backups []string
+	for _, m := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(m, r.filename+"."), compressSuffix)
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return strings.TrimSuffix(backups[i], compressSuffix) < strings.TrimSuffix(backups[j], compressSuffix)
+	})
+	return backups
+}
+
+func compressFile(filename string) error {
+	in, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(filename+compressSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err = io.Copy(gz, in); err == nil {
+		err = gz.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filename + compressSuffix)
+		return err
+	}
+	return os.Remove(filename)
+}
@@ -0,0 +1,183 @@
+package logging
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileAppends(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "proxy.log")
+	ioutil.WriteFile(filename, []byte("previous\n"), 0644)
+
+	r, err := OpenRotatingFile(filename, 0, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("next\n"))
+	r.Close()
+	if data, _ := ioutil.ReadFile(filename); string(data) != "previous\nnext\n" {
+		t.Errorf("expected the previous log to be kept, found %q", data)
+	}
+}
+
+func TestRotatingFileSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "proxy.log")
+
+	r, err := OpenRotatingFile(filename, 10, 0, 2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"line 1\n", "line 2\n", "line 3\n", "line 4\n"} {
+		r.Write([]byte(line))
+	}
+	r.Close()
+
+	if data, _ := ioutil.ReadFile(filename); string(data) != "line 4\n" {
+		t.Errorf("unexpected current log %q", data)
+	}
+	backups := r.backups()
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups, found %v", backups)
+	}
+	for i, backup := range backups {
+		if !strings.HasSuffix(backup, compressSuffix) {
+			t.Errorf("expected a compressed backup, found %s", backup)
+			continue
+		}
+		f, _ := os.Open(backup)
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(gz)
+		f.Close()
+		if expected := []string{"line 2\n", "line 3\n"}[i]; string(data) != expected {
+			t.Errorf("expected backup %s to hold %q, found %q", backup, expected, data)
+		}
+	}
+}
+
+func TestRotatingFileAge(t *testing.T) {
+	r := &RotatingFile{maxAge: time.Hour, size: 1, created: time.Now().Add(-2 * time.Hour)}
+	if !r.shouldRotate(1, time.Now()) {
+		t.Error("expected an old file to be rotated")
+	}
+	if r.size = 0; r.shouldRotate(1, time.Now()) {
+		t.Error("expected an empty file not to be rotated")
+	}
+}
+
+func TestRotatingFileCreationTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "proxy.log")
+	ioutil.WriteFile(filename, []byte("previous\n"), 0644)
+	modified := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(filename, modified, modified)
+
+	// reopening an old file after a restart keeps its age
+	r, err := OpenRotatingFile(filename, 0, time.Hour, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if !r.created.Equal(modified) {
+		t.Errorf("expected the modification time %v, found %v", modified, r.created)
+	}
+
+	// a file written since the last rotation was created by it
+	rotated := time.Now().Add(-3 * time.Hour).Truncate(time.Millisecond)
+	ioutil.WriteFile(filename+"."+rotated.Format(backupTimeFormat)+compressSuffix, nil, 0644)
+	if r, err = OpenRotatingFile(filename, 0, time.Hour, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if !r.created.Equal(rotated) {
+		t.Errorf("expected the rotation time %v, found %v", rotated, r.created)
+	}
+}
+
+func TestRotatingFileCreationRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "proxy.log")
+
+	r, err := OpenRotatingFile(filename, 0, time.Hour, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := r.created
+	r.Write([]byte("line\n"))
+	r.Close()
+
+	// the recorded time is kept after a restart, although the file was just modified
+	if r, err = OpenRotatingFile(filename, 0, time.Hour, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if !r.created.Equal(created) {
+		t.Errorf("expected the recorded creation time %v, found %v", created, r.created)
+	}
+	if backups := r.backups(); len(backups) != 0 {
+		t.Errorf("expected the creation record not to be a backup, found %v", backups)
+	}
+}
+
+func TestRotatingFileReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "proxy.log")
+
+	r, err := OpenRotatingFile(filename, 0, 0, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.Write([]byte("before\n"))
+	// logrotate create mode: the file is moved away and the proxy is told to reopen it
+	os.Rename(filename, filename+".1")
+	if err := r.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("after\n"))
+	if data, _ := ioutil.ReadFile(filename); string(data) != "after\n" {
+		t.Errorf("unexpected log after reopen %q", data)
+	}
+
+	// the directory is gone, so logging continues to the open file
+	os.Rename(dir, dir+".moved")
+	defer os.RemoveAll(dir + ".moved")
+	if err := r.Reopen(); err == nil {
+		t.Fatal("expected an error reopening a file in a missing directory")
+	}
+	if _, err := r.Write([]byte("still\n")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dir+".moved", "proxy.log")); string(data) != "after\nstill\n" {
+		t.Errorf("expected logging to continue after a failed reopen, found %q", data)
+	}
+}
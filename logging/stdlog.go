@@ -0,0 +1,20 @@
+package logging
+
+import (
+	"log"
+	"strings"
+)
+
+// RedirectStdLog sends the output of the standard log package to the default logger at info level,
+// so that code still using log.Printf shares its level, format and output.
+func RedirectStdLog() {
+	log.SetFlags(0)
+	log.SetOutput(stdLogWriter{})
+}
+
+type stdLogWriter struct{}
+
+func (stdLogWriter) Write(p []byte) (int, error) {
+	std.Info(strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
@@ -1,6 +1,6 @@
 #!/usr/bin/env bash
 
-PKG=cmd/wavefront-proxy/proxy.go
+PKG=./cmd/wavefront-proxy
 PKG_NAME=wavefront-proxy
 CURR_DIR=$(pwd)
 OUT_DIR=$CURR_DIR/build
@@ -0,0 +1,259 @@
+package points
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/wavefronthq/go-proxy/logging"
+)
+
+const (
+	// interval at which the go-metrics EWMA rates expect to be ticked
+	clientTickInterval = 5 * time.Second
+	clientSummaryTicks = int(time.Minute / clientTickInterval)
+	// clients without open connections are forgotten after clientExpiry
+	clientExpiry = time.Hour
+	// distinct clients tracked per listener, others are counted together
+	maxClients   = 10000
+	otherClients = "other"
+	// clients logged in the periodic summary
+	topTalkers = 5
+)
+
+// Ingestion statistics of a remote address, totalled over its connections.
+type ClientStats struct {
+	Client      string `json:"client"`
+	Connections int    `json:"connections"`
+	Received    int64  `json:"received"`
+	Blocked     int64  `json:"blocked"`
+	// size of the received lines, without line endings
+	Bytes     int64     `json:"bytes"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	// points per second, averaged over the last minute
+	Rate float64 `json:"rate"`
+}
+
+// Ingestion statistics of an open connection or HTTP request.
+type ConnectionStats struct {
+	Client     string    `json:"client"`
+	Opened     time.Time `json:"opened"`
+	AgeSeconds float64   `json:"ageSeconds"`
+	Received   int64     `json:"received"`
+	Blocked    int64     `json:"blocked"`
+	Bytes      int64     `json:"bytes"`
+	LastSeen   time.Time `json:"lastSeen"`
+	Rate       float64   `json:"rate"`
+}
+
+// Clients and open connections of a listener, ordered by decreasing rate.
+type ClientsStatus struct {
+	Port        int               `json:"port"`
+	Clients     []ClientStats     `json:"clients"`
+	Connections []ConnectionStats `json:"connections"`
+}
+
+// Counts of one connection, updated by its goroutine without locking.
+type connStats struct {
+	// first for 64-bit alignment of the atomic counters
+	received int64
+	blocked  int64
+	bytes    int64
+	lastSeen int64
+	client   *clientStats
+	addr     string
+	opened   time.Time
+	rate     metrics.EWMA
+}
+
+// line counts a received line of size bytes.
+func (c *connStats) line(size int) {
+	atomic.AddInt64(&c.received, 1)
+	atomic.AddInt64(&c.bytes, int64(size))
+	atomic.StoreInt64(&c.lastSeen, time.Now().UnixNano())
+	c.rate.Update(1)
+	c.client.rate.Update(1)
+}
+
+func (c *connStats) block() {
+	atomic.AddInt64(&c.blocked, 1)
+}
+
+func (c *connStats) stats(now time.Time) ConnectionStats {
+	return ConnectionStats{
+		Client:     c.addr,
+		Opened:     c.opened,
+		AgeSeconds: now.Sub(c.opened).Seconds(),
+		Received:   atomic.LoadInt64(&c.received),
+		Blocked:    atomic.LoadInt64(&c.blocked),
+		Bytes:      atomic.LoadInt64(&c.bytes),
+		LastSeen:   time.Unix(0, atomic.LoadInt64(&c.lastSeen)),
+		Rate:       c.rate.Rate(),
+	}
+}
+
+// Totals of a remote address, the counts of open connections are added when they close.
+type clientStats struct {
+	host      string
+	firstSeen time.Time
+	lastSeen  time.Time
+	received  int64
+	blocked   int64
+	bytes     int64
+	conns     map[*connStats]struct{}
+	rate      metrics.EWMA
+}
+
+func (c *clientStats) stats(now time.Time) ClientStats {
+	s := ClientStats{
+		Client:      c.host,
+		Connections: len(c.conns),
+		Received:    c.received,
+		Blocked:     c.blocked,
+		Bytes:       c.bytes,
+		FirstSeen:   c.firstSeen,
+		LastSeen:    c.lastSeen,
+		Rate:        c.rate.Rate(),
+	}
+	for conn := range c.conns {
+		cs := conn.stats(now)
+		s.Received += cs.Received
+		s.Blocked += cs.Blocked
+		s.Bytes += cs.Bytes
+		if cs.LastSeen.After(s.LastSeen) {
+			s.LastSeen = cs.LastSeen
+		}
+	}
+	return s
+}
+
+// Tracks the clients and connections of a listener.
+type clientTracker struct {
+	port    int
+	mtx     sync.Mutex
+	clients map[string]*clientStats
+}
+
+func newClientTracker(port int) *clientTracker {
+	return &clientTracker{port: port, clients: make(map[string]*clientStats)}
+}
+
+// open starts tracking a connection from addr, a host:port remote address.
+func (t *clientTracker) open(addr string) *connStats {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	now := time.Now()
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	client, ok := t.clients[host]
+	if !ok {
+		if len(t.clients) >= maxClients {
+			host = otherClients
+			client = t.clients[host]
+		}
+		if client == nil {
+			client = &clientStats{host: host, firstSeen: now, conns: make(map[*connStats]struct{}), rate: metrics.NewEWMA1()}
+			t.clients[host] = client
+		}
+	}
+	conn := &connStats{client: client, addr: addr, opened: now, lastSeen: now.UnixNano(), rate: metrics.NewEWMA1()}
+	client.conns[conn] = struct{}{}
+	client.lastSeen = now
+	return conn
+}
+
+// close adds the counts of a closed connection to the totals of its client.
+func (t *clientTracker) close(conn *connStats) {
+	s := conn.stats(time.Now())
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	client := conn.client
+	delete(client.conns, conn)
+	client.received += s.Received
+	client.blocked += s.Blocked
+	client.bytes += s.Bytes
+	if s.LastSeen.After(client.lastSeen) {
+		client.lastSeen = s.LastSeen
+	}
+}
+
+// tick updates the rates and forgets the clients which have been idle for longer than clientExpiry.
+func (t *clientTracker) tick(now time.Time) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	for host, client := range t.clients {
+		client.rate.Tick()
+		for conn := range client.conns {
+			conn.rate.Tick()
+		}
+		if len(client.conns) == 0 && now.Sub(client.lastSeen) > clientExpiry {
+			delete(t.clients, host)
+		}
+	}
+}
+
+// status returns the clients and open connections ordered by decreasing rate.
+func (t *clientTracker) status() ClientsStatus {
+	now := time.Now()
+	s := ClientsStatus{Port: t.port, Clients: []ClientStats{}, Connections: []ConnectionStats{}}
+	t.mtx.Lock()
+	for _, client := range t.clients {
+		s.Clients = append(s.Clients, client.stats(now))
+		for conn := range client.conns {
+			s.Connections = append(s.Connections, conn.stats(now))
+		}
+	}
+	t.mtx.Unlock()
+
+	sort.Slice(s.Clients, func(i, j int) bool {
+		if s.Clients[i].Rate != s.Clients[j].Rate {
+			return s.Clients[i].Rate > s.Clients[j].Rate
+		}
+		return s.Clients[i].Received > s.Clients[j].Received
+	})
+	sort.Slice(s.Connections, func(i, j int) bool {
+		if s.Connections[i].Rate != s.Connections[j].Rate {
+			return s.Connections[i].Rate > s.Connections[j].Rate
+		}
+		return s.Connections[i].Received > s.Connections[j].Received
+	})
+	return s
+}
+
+// logTopTalkers logs the clients sending the most points.
+func (t *clientTracker) logTopTalkers() {
+	clients := t.status().Clients
+	for i, client := range clients {
+		if i == topTalkers || client.Rate == 0 {
+			break
+		}
+		logging.Info("top talker", "port", t.port, "client", client.Client,
+			"rate", strconv.FormatFloat(client.Rate, 'f', 1, 64), "received", client.Received,
+			"blocked", client.Blocked, "bytes", client.Bytes, "connections", client.Connections)
+	}
+}
+
+// run ticks the rates and logs the top talkers every minute until done is closed.
+func (t *clientTracker) run(done <-chan struct{}) {
+	ticker := time.NewTicker(clientTickInterval)
+	defer ticker.Stop()
+	for ticks := 1; ; ticks++ {
+		select {
+		case now := <-ticker.C:
+			t.tick(now)
+			if ticks%clientSummaryTicks == 0 {
+				t.logTopTalkers()
+			}
+		case <-done:
+			return
+		}
+	}
+}
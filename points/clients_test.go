@@ -0,0 +1,69 @@
+package points
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/wavefronthq/go-proxy/points/decoder"
+	"github.com/wavefronthq/go-proxy/points/preprocessor"
+)
+
+// newTestListener returns a listener which can process lines without being started.
+func newTestListener(pp *preprocessor.Preprocessor) *DefaultPointListener {
+	l := &DefaultPointListener{
+		Port:         2878,
+		Builder:      decoder.GraphiteBuilder{},
+		Preprocessor: pp,
+		clients:      newClientTracker(2878),
+		parseLatency: metrics.NewTimer(),
+		lineSize:     metrics.NewHistogram(metrics.NewUniformSample(100)),
+	}
+	l.handler = &DefaultPointHandler{name: "test"}
+	l.handler.init(1, 1000, 100, 100, "", "", &testAPI{})
+	l.deltas = newDeltaAggregator(l.Port, l.handler, 0)
+	l.events = newEventHandler("test", &testAPI{})
+	l.sources = newSourceHandler("test", &testAPI{})
+	return l
+}
+
+func TestClientStats(t *testing.T) {
+	l := newTestListener(nil)
+	defer l.handler.stop()
+
+	l.processLines(strings.NewReader("a.b 1 source=x\nbad\n"), "10.0.0.1:5000")
+	l.processLines(strings.NewReader("a.b 1 source=x\n"), "10.0.0.1:5001")
+	l.processLines(strings.NewReader("a.b 1 source=x\n"), "10.0.0.2:5000")
+
+	open := l.clients.open("10.0.0.2:5002")
+	open.line(10)
+	l.clients.tick(time.Now())
+
+	status := l.Clients()
+	if len(status.Clients) != 2 || len(status.Connections) != 1 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	clients := make(map[string]ClientStats)
+	for _, client := range status.Clients {
+		clients[client.Client] = client
+	}
+	if c := clients["10.0.0.1"]; c.Received != 3 || c.Blocked != 1 || c.Bytes != 31 || c.Connections != 0 {
+		t.Errorf("unexpected stats %+v", c)
+	}
+	if c := clients["10.0.0.2"]; c.Received != 2 || c.Connections != 1 || c.Rate <= 0 {
+		t.Errorf("unexpected stats %+v", c)
+	}
+	if conn := status.Connections[0]; conn.Client != "10.0.0.2:5002" || conn.Received != 1 || conn.Bytes != 10 {
+		t.Errorf("unexpected connection %+v", conn)
+	}
+	if l.lineSize.Count() != 4 || l.parseLatency.Count() != 4 {
+		t.Errorf("expected 4 lines in the histograms, found %d and %d", l.lineSize.Count(), l.parseLatency.Count())
+	}
+
+	l.clients.close(open)
+	l.clients.tick(time.Now().Add(2 * clientExpiry))
+	if clients := l.Clients().Clients; len(clients) != 0 {
+		t.Errorf("expected idle clients to expire, found %+v", clients)
+	}
+}
@@ -0,0 +1,115 @@
+package points
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	encodingIdentity = "identity"
+	encodingGzip     = "gzip"
+	encodingZstd     = "zstd"
+
+	// number of leading bytes needed to detect the encoding of a stream
+	magicLength = 4
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+	ErrDecompressedSizeExceeded = errors.New("decompressed size limit exceeded")
+	ErrUnsupportedEncoding      = errors.New("unsupported content encoding")
+)
+
+// detectEncoding returns the encoding of a stream based on its leading magic number.
+func detectEncoding(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return encodingGzip
+	case bytes.HasPrefix(head, zstdMagic):
+		return encodingZstd
+	}
+	return encodingIdentity
+}
+
+// newDecompressor wraps r with a decompressor for the given encoding.
+// At most maxSize decompressed bytes are read before ErrDecompressedSizeExceeded is returned,
+// a maxSize <= 0 disables the limit.
+func newDecompressor(r io.Reader, encoding string, maxSize int64) (io.ReadCloser, error) {
+	switch encoding {
+	case "", encodingIdentity:
+		return ioutil.NopCloser(r), nil
+	case encodingGzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return &limitedReadCloser{r: zr, c: zr, remaining: maxSize, limited: maxSize > 0}, nil
+	case encodingZstd:
+		// frames needing a larger window than the decompressed size limit are rejected before
+		// allocating it
+		window := uint64(zstd.MaxWindowSize)
+		if maxSize > 0 && uint64(maxSize) < window {
+			window = uint64(maxSize)
+			if window < zstd.MinWindowSize {
+				window = zstd.MinWindowSize
+			}
+		}
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(window),
+			zstd.WithDecoderMaxMemory(window))
+		if err != nil {
+			return nil, err
+		}
+		closer := closerFunc(func() error {
+			zr.Close()
+			return nil
+		})
+		return &limitedReadCloser{r: zr, c: closer, remaining: maxSize, limited: maxSize > 0}, nil
+	}
+	return nil, ErrUnsupportedEncoding
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+// Fails reads once more than the allowed number of bytes have been read,
+// protecting against compression bombs.
+type limitedReadCloser struct {
+	r         io.Reader
+	c         io.Closer
+	remaining int64
+	limited   bool
+}
+
+func (l *limitedReadCloser) Read(p []byte) (int, error) {
+	if !l.limited {
+		return l.r.Read(p)
+	}
+	if l.remaining <= 0 {
+		// the limit is only exceeded if there is more data to read
+		var probe [1]byte
+		if n, err := l.r.Read(probe[:]); n == 0 && err != nil {
+			return 0, err
+		}
+		return 0, ErrDecompressedSizeExceeded
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+func (l *limitedReadCloser) Close() error {
+	return l.c.Close()
+}
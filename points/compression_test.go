@@ -0,0 +1,117 @@
+package points
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const testLines = "foo.metric 1 source=a\nfoo.metric 2 source=b\n"
+
+func gzipBytes(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(s))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	w, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(s))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectEncoding(t *testing.T) {
+	cases := map[string][]byte{
+		encodingGzip:     gzipBytes(t, testLines),
+		encodingZstd:     zstdBytes(t, testLines),
+		encodingIdentity: []byte(testLines),
+	}
+	for expected, data := range cases {
+		if encoding := detectEncoding(data[:magicLength]); encoding != expected {
+			t.Errorf("expected %s, found %s", expected, encoding)
+		}
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	cases := map[string][]byte{
+		encodingGzip: gzipBytes(t, testLines),
+		encodingZstd: zstdBytes(t, testLines),
+	}
+	for encoding, data := range cases {
+		r, err := newDecompressor(bytes.NewReader(data), encoding, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Errorf("%s: %v", encoding, err)
+		}
+		if string(out) != testLines {
+			t.Errorf("%s: expected %q, found %q", encoding, testLines, out)
+		}
+	}
+}
+
+func TestDecompressedSizeLimit(t *testing.T) {
+	bomb := gzipBytes(t, strings.Repeat("a", 1<<20))
+	r, err := newDecompressor(bytes.NewReader(bomb), encodingGzip, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	out, err := ioutil.ReadAll(r)
+	if err != ErrDecompressedSizeExceeded {
+		t.Errorf("expected %v, found %v", ErrDecompressedSizeExceeded, err)
+	}
+	if len(out) != 1024 {
+		t.Errorf("expected 1024 bytes, found %d", len(out))
+	}
+
+	// a stream of exactly the limit is allowed
+	r, _ = newDecompressor(bytes.NewReader(gzipBytes(t, testLines)), encodingGzip, int64(len(testLines)))
+	defer r.Close()
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestZstdWindowLimit(t *testing.T) {
+	// the frame declares a window larger than the decompressed size limit
+	frame := zstdBytes(t, strings.Repeat("a", 1<<20))
+	r, err := newDecompressor(bytes.NewReader(frame), encodingZstd, 64*1024)
+	if err == nil {
+		defer r.Close()
+		var out []byte
+		out, err = ioutil.ReadAll(r)
+		if len(out) != 0 {
+			t.Errorf("expected no output, found %d bytes", len(out))
+		}
+	}
+	if err != zstd.ErrWindowSizeExceeded {
+		t.Errorf("expected %v, found %v", zstd.ErrWindowSizeExceeded, err)
+	}
+}
+
+func TestUnsupportedEncoding(t *testing.T) {
+	if _, err := newDecompressor(strings.NewReader(testLines), "br", 0); err != ErrUnsupportedEncoding {
+		t.Errorf("expected %v, found %v", ErrUnsupportedEncoding, err)
+	}
+}
@@ -0,0 +1,327 @@
+package cumulative
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/wavefronthq/go-proxy/common"
+	"github.com/wavefronthq/go-proxy/config"
+)
+
+const (
+	OutputRate  = "rate"
+	OutputDelta = "delta"
+
+	DefaultTTL = time.Hour
+	// interval at which idle series are expired
+	expiryInterval = time.Minute
+)
+
+// characters allowed in a metric name, so a suffix cannot make a valid name invalid
+var validSuffix = regexp.MustCompile(`^[a-zA-Z0-9._,/-]+$`)
+
+// Configuration of a conversion rule.
+type RuleConfig struct {
+	Rule string `yaml:"rule"`
+	// regex which must match the entire metric name
+	Match string `yaml:"match"`
+	// rate (per second) or delta
+	Output string `yaml:"output"`
+	// appended to the metric name of the derived points, defaults to .rate or .delta. Delta points
+	// are also named with the delta counter prefix.
+	Suffix string `yaml:"suffix"`
+	// also forward the counter itself
+	ForwardRaw bool `yaml:"forwardRaw"`
+	// state of series without points for longer than this is dropped, defaults to 1h
+	TTL time.Duration `yaml:"ttl"`
+	// largest value of a counter which wraps around, e.g. 4294967295 for 32-bit counters.
+	// 0 treats every decrease as a reset.
+	MaxValue float64 `yaml:"maxValue"`
+}
+
+// Converts the cumulative counters received on a port into rate or delta points.
+type Converter struct {
+	rules []*rule
+}
+
+// Last value of a counter series.
+type series struct {
+	value     float64
+	timestamp int64
+	lastSeen  time.Time
+}
+
+type rule struct {
+	match      *regexp.Regexp
+	output     string
+	suffix     string
+	forwardRaw bool
+	ttl        time.Duration
+	maxValue   float64
+
+	mtx    sync.Mutex
+	series map[string]*series
+
+	derived metrics.Counter
+	resets  metrics.Counter
+	wraps   metrics.Counter
+	expired metrics.Counter
+}
+
+// Convert updates the state of the counter series of a point matching a rule. Returns the derived
+// point if the series had an earlier value, and whether the point itself should be forwarded.
+// Points not matching any rule are forwarded unchanged.
+func (c *Converter) Convert(pt *common.Point) (*common.Point, bool) {
+	if c == nil || common.HasDeltaPrefix(pt.Name) {
+		return nil, true
+	}
+	for _, r := range c.rules {
+		if r.match.MatchString(pt.Name) {
+			return r.convert(pt, time.Now()), r.forwardRaw
+		}
+	}
+	return nil, true
+}
+
+// Run expires the idle series every minute until done is closed.
+func (c *Converter) Run(done <-chan struct{}) {
+	if c == nil {
+		return
+	}
+	ticker := time.NewTicker(expiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, r := range c.rules {
+				r.expire(now)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// convert stores the value of a point received at now and derives a point from the previous value.
+func (r *rule) convert(pt *common.Point, now time.Time) *common.Point {
+	value, err := strconv.ParseFloat(pt.Value, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil
+	}
+	key := common.SeriesKey(pt)
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	last, ok := r.series[key]
+	if !ok {
+		r.series[key] = &series{value: value, timestamp: pt.Timestamp, lastSeen: now}
+		return nil
+	}
+	// duplicate or out of order points are ignored
+	elapsed := pt.Timestamp - last.timestamp
+	if elapsed <= 0 {
+		return nil
+	}
+
+	delta := value - last.value
+	if delta < 0 {
+		delta = r.decrease(last.value, value)
+	}
+	last.value, last.timestamp, last.lastSeen = value, pt.Timestamp, now
+
+	if r.output == OutputRate {
+		delta /= float64(elapsed)
+	}
+	r.derived.Inc(1)
+	derived := *pt
+	derived.Name = pt.Name + r.suffix
+	if r.output == OutputDelta {
+		derived.Name = common.DeltaPrefix + derived.Name
+	}
+	derived.Value = strconv.FormatFloat(delta, 'f', -1, 64)
+	// the derived point is validated and aggregated apart from the counter
+	derived.Tags = make(map[string]string, len(pt.Tags))
+	for k, v := range pt.Tags {
+		derived.Tags[k] = v
+	}
+	return &derived
+}
+
+// decrease returns the increase of a counter which went down from last to value. A counter with a
+// maximum value wrapped around if that is less than half its range away, otherwise it was reset to 0.
+func (r *rule) decrease(last, value float64) float64 {
+	if r.maxValue > 0 && last <= r.maxValue {
+		if wrapped := r.maxValue - last + value + 1; wrapped < (r.maxValue+1)/2 {
+			r.wraps.Inc(1)
+			return wrapped
+		}
+	}
+	r.resets.Inc(1)
+	return value
+}
+
+// expire drops the series without points since before now minus the TTL.
+func (r *rule) expire(now time.Time) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for key, s := range r.series {
+		if now.Sub(s.lastSeen) > r.ttl {
+			delete(r.series, key)
+			r.expired.Inc(1)
+		}
+	}
+}
+
+// Converters of the listener ports. Ports without rules of their own apply the global rules.
+type Converters struct {
+	mtx    sync.Mutex
+	ports  map[int]*Converter
+	global []RuleConfig
+}
+
+// For returns the converter of a port, or nil if no rules apply to the port.
+func (c *Converters) For(port int) (*Converter, error) {
+	if c == nil {
+		return nil, nil
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if converter, ok := c.ports[port]; ok {
+		return converter, nil
+	}
+	if len(c.global) == 0 {
+		return nil, nil
+	}
+	converter, err := New(strconv.Itoa(port), c.global)
+	if err != nil {
+		return nil, err
+	}
+	c.ports[port] = converter
+	return converter, nil
+}
+
+// LoadFile reads a counter conversion file.
+func LoadFile(filename string) (*Converters, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Load(data)
+}
+
+// Load parses conversion rules keyed by comma separated port lists, like preprocessor rules.
+// Rules under the "global" key are applied to every port ahead of the port specific rules, and a
+// point is converted by the first rule matching its name.
+func Load(data []byte) (*Converters, error) {
+	file, err := config.ParsePortFile(data, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var globalRules []RuleConfig
+	if file.Global != nil {
+		if err := file.Global.Decode(&globalRules); err != nil {
+			return nil, fmt.Errorf("%s: %v", config.GlobalKey, err)
+		}
+	}
+	if _, err := build(globalRules, func(string) metrics.Counter { return metrics.NilCounter{} }); err != nil {
+		return nil, fmt.Errorf("%s: %v", config.GlobalKey, err)
+	}
+
+	portRules := make(map[int][]RuleConfig)
+	for _, section := range file.Sections {
+		var rules []RuleConfig
+		if err := section.Decode(&rules); err != nil {
+			return nil, fmt.Errorf("%s: %v", section.Key, err)
+		}
+		for _, port := range section.Ports {
+			portRules[port] = append(portRules[port], rules...)
+		}
+	}
+
+	converters := &Converters{ports: make(map[int]*Converter), global: globalRules}
+	for port, rules := range portRules {
+		c, err := New(strconv.Itoa(port), append(globalRules[:len(globalRules):len(globalRules)], rules...))
+		if err != nil {
+			return nil, fmt.Errorf("port %d: %v", port, err)
+		}
+		converters.ports[port] = c
+	}
+	return converters, nil
+}
+
+// New creates a Converter from an ordered list of rules.
+// The prefix (typically the port) is used to name the per rule counters.
+func New(prefix string, rules []RuleConfig) (*Converter, error) {
+	return build(rules, func(name string) metrics.Counter {
+		return metrics.GetOrRegisterCounter("cumulative."+prefix+"."+name, nil)
+	})
+}
+
+func build(rules []RuleConfig, counter func(name string) metrics.Counter) (*Converter, error) {
+	c := &Converter{}
+	names := make(map[string]bool)
+	for _, cfg := range rules {
+		if cfg.Rule == "" {
+			return nil, errors.New("missing rule name")
+		}
+		if names[cfg.Rule] {
+			return nil, fmt.Errorf("duplicate rule name %q", cfg.Rule)
+		}
+		names[cfg.Rule] = true
+
+		r, err := newRule(cfg, counter)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %v", cfg.Rule, err)
+		}
+		c.rules = append(c.rules, r)
+	}
+	return c, nil
+}
+
+func newRule(cfg RuleConfig, counter func(name string) metrics.Counter) (*rule, error) {
+	if cfg.Match == "" {
+		return nil, errors.New("missing match")
+	}
+	match, err := regexp.Compile("^(?:" + cfg.Match + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid match regex: %v", err)
+	}
+	if cfg.Output != OutputRate && cfg.Output != OutputDelta {
+		return nil, fmt.Errorf("invalid output %q, expected rate or delta", cfg.Output)
+	}
+	suffix := cfg.Suffix
+	if suffix == "" {
+		suffix = "." + cfg.Output
+	} else if !validSuffix.MatchString(suffix) {
+		return nil, fmt.Errorf("invalid suffix %q, expected metric name characters", suffix)
+	}
+	ttl := cfg.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	if ttl < 0 || cfg.MaxValue < 0 {
+		return nil, errors.New("ttl and maxValue must not be negative")
+	}
+
+	return &rule{
+		match:      match,
+		output:     cfg.Output,
+		suffix:     suffix,
+		forwardRaw: cfg.ForwardRaw,
+		ttl:        ttl,
+		maxValue:   cfg.MaxValue,
+		series:     make(map[string]*series),
+		derived:    counter(cfg.Rule + ".derived"),
+		resets:     counter(cfg.Rule + ".resets"),
+		wraps:      counter(cfg.Rule + ".wraps"),
+		expired:    counter(cfg.Rule + ".expired"),
+	}, nil
+}
@@ -0,0 +1,165 @@
+package cumulative
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wavefronthq/go-proxy/common"
+)
+
+const testRules = `
+global:
+  - rule   : rates
+    match  : 'node\..*_total'
+    output : rate
+
+'2878':
+  - rule       : snmp
+    match      : 'snmp\..*'
+    output     : delta
+    suffix     : .increase
+    maxValue   : 1000
+    forwardRaw : true
+    ttl        : 10m
+`
+
+func TestLoad(t *testing.T) {
+	converters, err := Load([]byte(testRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := converters.ports[2878]
+	if c == nil || len(c.rules) != 2 {
+		t.Fatalf("expected 2 rules for port 2878, found %+v", c)
+	}
+	if r := c.rules[0]; r.output != OutputRate || r.suffix != ".rate" || r.ttl != DefaultTTL || r.forwardRaw {
+		t.Errorf("unexpected rule %+v", r)
+	}
+	if r := c.rules[1]; r.output != OutputDelta || r.suffix != ".increase" || r.ttl != 10*time.Minute || r.maxValue != 1000 {
+		t.Errorf("unexpected rule %+v", r)
+	}
+
+	for _, invalid := range []string{
+		"'2878':\n  - rule: a\n    output: rate\n",
+		"'2878':\n  - rule: a\n    match: a\n    output: sum\n",
+		"'2878':\n  - rule: a\n    match: '('\n    output: rate\n",
+		"'2878':\n  - match: a\n    output: rate\n",
+		"'2878':\n  - rule: a\n    match: a\n    output: rate\n    ttl: -1m\n",
+		"'2878':\n  - rule: a\n    match: a\n    output: rate\n    unknown: 1\n",
+		"'abc':\n  - rule: a\n    match: a\n    output: rate\n",
+		"global:\n  - rule: a\n    output: rate\n",
+		"'2878':\n  - rule: a\n    match: a\n    output: rate\n    suffix: ' per sec'\n",
+	} {
+		if _, err := Load([]byte(invalid)); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestLoadGlobalOnly(t *testing.T) {
+	converters, err := Load([]byte("global:\n  - rule: rates\n    match: 'node\\..*_total'\n    output: rate\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := converters.For(2003)
+	if err != nil || c == nil || len(c.rules) != 1 {
+		t.Fatalf("expected the global rule for port 2003, found %+v, %v", c, err)
+	}
+	if again, _ := converters.For(2003); again != c {
+		t.Error("expected the same converter for the port")
+	}
+
+	if c, err := (*Converters)(nil).For(2003); c != nil || err != nil {
+		t.Errorf("expected no converter without rules, found %+v, %v", c, err)
+	}
+}
+
+func newTestConverter(t *testing.T, cfg RuleConfig) *Converter {
+	// counters are registered globally, so each test has its own
+	c, err := New(t.Name(), []RuleConfig{cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func point(name, value string, ts int64) *common.Point {
+	return &common.Point{Name: name, Value: value, Timestamp: ts, Source: "host", Tags: map[string]string{"if": "eth0"}}
+}
+
+func TestRate(t *testing.T) {
+	c := newTestConverter(t, RuleConfig{Rule: "rate", Match: "requests", Output: OutputRate})
+
+	for i, tc := range []struct {
+		value    string
+		ts       int64
+		expected string
+	}{
+		{"100", 1000, ""},
+		{"160", 1060, "1"},
+		{"160", 1060, ""}, // duplicate
+		{"400", 1120, "4"},
+		{"30", 1150, "1"}, // reset
+	} {
+		derived, forward := c.Convert(point("requests", tc.value, tc.ts))
+		if forward {
+			t.Errorf("%d: expected the counter not to be forwarded", i)
+		}
+		if tc.expected == "" {
+			if derived != nil {
+				t.Errorf("%d: expected no derived point, found %+v", i, derived)
+			}
+			continue
+		}
+		if derived == nil || derived.Name != "requests.rate" || derived.Value != tc.expected ||
+			derived.Timestamp != tc.ts || derived.Source != "host" || derived.Tags["if"] != "eth0" {
+			t.Errorf("%d: expected a rate of %s, found %+v", i, tc.expected, derived)
+		}
+	}
+	if count := c.rules[0].resets.Count(); count != 1 {
+		t.Errorf("expected 1 reset, found %d", count)
+	}
+
+	if derived, forward := c.Convert(point("other", "1", 1000)); derived != nil || !forward {
+		t.Error("expected other metrics to be forwarded unchanged")
+	}
+	if derived, forward := c.Convert(point("∆requests", "1", 1000)); derived != nil || !forward {
+		t.Error("expected delta counters to be forwarded unchanged")
+	}
+}
+
+func TestDeltaWraparound(t *testing.T) {
+	c := newTestConverter(t, RuleConfig{Rule: "delta", Match: "octets", Output: OutputDelta, MaxValue: 999, ForwardRaw: true})
+
+	c.Convert(point("octets", "900", 1000))
+	derived, forward := c.Convert(point("octets", "50", 1010))
+	if !forward || derived == nil || derived.Name != "∆octets.delta" || derived.Value != "150" {
+		t.Errorf("expected a wraparound delta of 150, found %+v", derived)
+	}
+	// far from the maximum, so a reset
+	derived, _ = c.Convert(point("octets", "20", 1020))
+	if derived == nil || derived.Value != "20" {
+		t.Errorf("expected a reset delta of 20, found %+v", derived)
+	}
+	if r := c.rules[0]; r.wraps.Count() != 1 || r.resets.Count() != 1 {
+		t.Errorf("expected 1 wraparound and 1 reset, found %d and %d", r.wraps.Count(), r.resets.Count())
+	}
+}
+
+func TestExpire(t *testing.T) {
+	c := newTestConverter(t, RuleConfig{Rule: "expire", Match: "requests", Output: OutputDelta, TTL: time.Minute})
+	r := c.rules[0]
+	now := time.Now()
+	r.convert(point("requests", "1", 1000), now)
+	r.expire(now.Add(30 * time.Second))
+	if len(r.series) != 1 {
+		t.Fatalf("expected the series to be kept, found %d", len(r.series))
+	}
+	r.expire(now.Add(2 * time.Minute))
+	if len(r.series) != 0 || r.expired.Count() != 1 {
+		t.Errorf("expected the series to expire, found %d", len(r.series))
+	}
+	if derived := r.convert(point("requests", "5", 1010), now); derived != nil {
+		t.Errorf("expected an expired series to start over, found %+v", derived)
+	}
+}
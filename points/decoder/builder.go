@@ -27,3 +27,22 @@ func (OpenTSDBBuilder) Build() PointDecoder {
 	decoder.parser = &parser.PointParser{Elements: openTSDBElements}
 	return decoder
 }
+
+// Builds decoders validating points with a policy.
+type policyBuilder struct {
+	builder DecoderBuilder
+	policy  *ValidationPolicy
+}
+
+// WithPolicy returns a builder of the decoders of b which validate points with policy.
+func WithPolicy(b DecoderBuilder, policy *ValidationPolicy) DecoderBuilder {
+	return policyBuilder{builder: b, policy: policy}
+}
+
+func (b policyBuilder) Build() PointDecoder {
+	decoder := b.builder.Build()
+	if d, ok := decoder.(*DefaultDecoder); ok {
+		d.policy = b.policy
+	}
+	return decoder
+}
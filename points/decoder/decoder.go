@@ -1,8 +1,9 @@
 package decoder
 
 import (
+	"bytes"
 	"errors"
-	"strings"
+	"fmt"
 
 	"github.com/wavefronthq/go-proxy/common"
 	"github.com/wavefronthq/go-proxy/points/parser"
@@ -15,10 +16,14 @@ var (
 // Interface for decoding a point line
 type PointDecoder interface {
 	Decode(b []byte) (*common.Point, error)
+	// Validate checks a point changed after decoding, such as by preprocessor rules, like Decode does
+	Validate(point *common.Point) error
 }
 
 type DefaultDecoder struct {
 	parser *parser.PointParser
+	// validates the decoded points, the default policy if nil
+	policy *ValidationPolicy
 }
 
 func (d *DefaultDecoder) Decode(b []byte) (*common.Point, error) {
@@ -26,9 +31,7 @@ func (d *DefaultDecoder) Decode(b []byte) (*common.Point, error) {
 		return &common.Point{}, ErrInvalidPoint
 	}
 
-	pointLine := string(b)
-	pointLine = strings.TrimSpace(pointLine)
-	if pointLine == "" {
+	if len(bytes.TrimSpace(b)) == 0 {
 		return &common.Point{}, ErrInvalidPoint
 	}
 
@@ -40,5 +43,56 @@ func (d *DefaultDecoder) Decode(b []byte) (*common.Point, error) {
 	if err != nil {
 		return point, err
 	}
-	return point, validate(point)
+	err = d.Validate(point)
+	if charErr, ok := err.(*CharError); ok {
+		return point, d.locate(b, charErr)
+	}
+	return point, err
+}
+
+func (d *DefaultDecoder) Validate(point *common.Point) error {
+	if d.policy != nil {
+		return d.policy.Validate(point)
+	}
+	return validate(point)
+}
+
+// locate returns a parse error at the offset of a character rejected by validation, found by parsing
+// the line again. Returns the character error if it cannot be located.
+func (d *DefaultDecoder) locate(b []byte, charErr *CharError) error {
+	element, offset := "", -1
+	tag := 0
+	for _, sp := range d.parser.Locate(b) {
+		if sp.Element == parser.ElementTag {
+			tag++
+		}
+		switch {
+		case charErr.Violation == ViolationNameChars && sp.Element == parser.ElementName:
+			element, offset = parser.ElementName, sp.Start
+		case charErr.Violation == ViolationSourceChars && sp.Element != parser.ElementName &&
+			(sp.Key == sourceKey || sp.Key == hostKey && element == ""):
+			element, offset = parser.ElementSource, sp.ValueStart
+		case charErr.Key != "" && sp.Key == charErr.Key:
+			element, offset = fmt.Sprintf("%s %d", parser.ElementTag, tag), sp.Start
+			if charErr.Violation == ViolationTagValueChars {
+				offset = sp.ValueStart
+			}
+		}
+	}
+	if offset < 0 {
+		return charErr
+	}
+
+	pe := &parser.ParseError{Offset: offset + charErr.Index, Element: element, Found: string(charErr.Char),
+		Category: parser.CategoryInvalidCharacter, Err: charErr}
+	switch {
+	case charErr.InvalidUTF8:
+		pe.Expected, pe.Category = "valid UTF-8", parser.CategoryInvalidUTF8
+		pe.Found = string(b[pe.Offset : pe.Offset+1])
+	case charErr.Violation == ViolationTagValueChars:
+		pe.Expected = "a printable character"
+	default:
+		pe.Expected = `letters, digits, "-", "_", ".", "," or "/"`
+	}
+	return pe
 }
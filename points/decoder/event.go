@@ -0,0 +1,97 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/wavefronthq/go-proxy/common"
+	"github.com/wavefronthq/go-proxy/points/parser"
+)
+
+const (
+	// event start times before this (September 2001) look like seconds, and are rejected since the
+	// times must be in milliseconds
+	minEventMillis = 1e12
+	// most annotations of an event, counting hosts, tags and dimension values
+	maxEventAnnotations = 100
+)
+
+// Decodes and validates event lines, see parser.EventParser for the format.
+type EventDecoder struct {
+	parser *parser.EventParser
+}
+
+func NewEventDecoder() *EventDecoder {
+	return &EventDecoder{parser: parser.NewEventParser()}
+}
+
+func (d *EventDecoder) Decode(b []byte) (*common.Event, error) {
+	event, err := d.parser.Parse(b)
+	if err != nil {
+		return nil, err
+	}
+	return event, validateEvent(event)
+}
+
+// validateEvent checks the times and the annotations of an event. Event names, annotation values,
+// hosts and tags follow the tag value rules, annotation keys the tag key rules.
+func validateEvent(event *common.Event) error {
+	if event.StartTime < minEventMillis {
+		return fmt.Errorf("Expected the start time in milliseconds, found %d", event.StartTime)
+	}
+	if event.EndTime < event.StartTime {
+		return fmt.Errorf("End time %d is before start time %d", event.EndTime, event.StartTime)
+	}
+	if event.Name == "" {
+		return errors.New("Missing event name")
+	}
+	if len(event.Name) > DefaultMaxNameLength {
+		return fmt.Errorf(lengthErrStr, DefaultMaxNameLength+1, len(event.Name))
+	}
+	if err := validateValueRunes(event.Name); err != nil {
+		return err
+	}
+
+	count := len(event.Hosts) + len(event.Tags)
+	for k, v := range event.Annotations {
+		if err := validateAnnotation(k, v); err != nil {
+			return err
+		}
+		count++
+	}
+	for k, values := range event.Dimensions {
+		for _, v := range values {
+			if err := validateAnnotation(k, v); err != nil {
+				return err
+			}
+		}
+		count += len(values)
+	}
+	for _, values := range [][]string{event.Hosts, event.Tags} {
+		for _, v := range values {
+			if v == "" {
+				return errors.New("Empty event host or tag")
+			}
+			if err := validateValueRunes(v); err != nil {
+				return err
+			}
+		}
+	}
+	if count > maxEventAnnotations {
+		return fmt.Errorf("Expected at most %d annotations, found %d", maxEventAnnotations, count)
+	}
+	return nil
+}
+
+func validateAnnotation(k, v string) error {
+	if k == "" {
+		return errors.New("Empty annotation key")
+	}
+	if err := validateRunes(k); err != nil {
+		return err
+	}
+	if err := validateValueRunes(v); err != nil {
+		return err
+	}
+	return nil
+}
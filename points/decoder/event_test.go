@@ -0,0 +1,42 @@
+package decoder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeEvent(t *testing.T) {
+	d := NewEventDecoder()
+	event, err := d.Decode([]byte(`@Event 1569423200123 "Deploy web" severity=INFO host=app1 tag=zürich`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Name != "Deploy web" || event.Annotations["severity"] != "INFO" || event.Hosts[0] != "app1" {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	for _, line := range []string{
+		"@Event 1569423200 seconds",
+		"@Event 1569423200123 1569423100123 ends-before-start",
+		`@Event 1569423200123 ""`,
+		`@Event 1569423200123 name "bad key"=value`,
+		"@Event 1569423200123 name details=\"a\tb\"",
+		`@Event 1569423200123 name host=""`,
+	} {
+		if _, err := d.Decode([]byte(line)); err == nil {
+			t.Errorf("expected an error for %q", line)
+		}
+	}
+}
+
+func TestEventStartSeconds(t *testing.T) {
+	d := NewEventDecoder()
+	_, err := d.Decode([]byte("@Event 1569423200 deploy"))
+	if err == nil || !strings.Contains(err.Error(), "milliseconds") {
+		t.Errorf("expected a start time in seconds to be rejected, found %v", err)
+	}
+	// the earliest start time taken to be in milliseconds
+	if _, err := d.Decode([]byte("@Event 1000000000000 deploy")); err != nil {
+		t.Errorf("expected a start time in milliseconds, found %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/wavefronthq/go-proxy/config"
+	"github.com/wavefronthq/go-proxy/points/parser"
+)
+
+// Line format of a listener, as an ordered list of elements separated by whitespace.
+type FormatConfig struct {
+	Elements []parser.ElementSpec `yaml:"elements"`
+}
+
+// Builds decoders of a custom line format.
+type FormatBuilder struct {
+	elements []parser.ElementParser
+}
+
+// NewFormatBuilder checks a format and returns a builder of its decoders.
+func NewFormatBuilder(cfg FormatConfig) (*FormatBuilder, error) {
+	if len(cfg.Elements) == 0 {
+		return nil, errors.New("missing elements")
+	}
+	elements, err := parser.NewElements(cfg.Elements)
+	if err != nil {
+		return nil, err
+	}
+	return &FormatBuilder{elements: elements}, nil
+}
+
+func (b *FormatBuilder) Build() PointDecoder {
+	decoder := &DefaultDecoder{}
+	decoder.parser = &parser.PointParser{Elements: b.elements}
+	return decoder
+}
+
+// LoadFormatFile reads a custom formats file and returns a decoder builder for each configured port.
+func LoadFormatFile(filename string) (map[int]*FormatBuilder, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return LoadFormats(data)
+}
+
+// LoadFormats parses formats keyed by comma separated port lists. A port has a single format.
+func LoadFormats(data []byte) (map[int]*FormatBuilder, error) {
+	file, err := config.ParsePortFile(data, false)
+	if err != nil {
+		return nil, err
+	}
+	if file.Global != nil {
+		return nil, fmt.Errorf("a %s format is not supported, list the ports of each format", config.GlobalKey)
+	}
+
+	builders := make(map[int]*FormatBuilder)
+	for _, section := range file.Sections {
+		var cfg FormatConfig
+		if err := section.Decode(&cfg); err != nil {
+			return nil, fmt.Errorf("format of %s: %v", section.Key, err)
+		}
+		builder, err := NewFormatBuilder(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("format of %s: %v", section.Key, err)
+		}
+		for _, port := range section.Ports {
+			if _, ok := builders[port]; ok {
+				return nil, fmt.Errorf("port %d has more than one format", port)
+			}
+			builders[port] = builder
+		}
+	}
+	return builders, nil
+}
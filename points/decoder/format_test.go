@@ -0,0 +1,50 @@
+package decoder
+
+import (
+	"testing"
+
+	"github.com/wavefronthq/go-proxy/points/parser"
+)
+
+func TestLoadFormats(t *testing.T) {
+	builders, err := LoadFormats([]byte(`
+"5878, 5879":
+  elements: [timestamp, value, name, tags]
+"5880":
+  elements: [{literal: metric}, name, source, value]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(builders) != 3 || builders[5878] != builders[5879] {
+		t.Fatalf("unexpected builders %v", builders)
+	}
+
+	pt, err := builders[5878].Build().Decode([]byte("1505454047 1.5 foo.metric source=a env=dev"))
+	if err != nil || pt.Name != "foo.metric" || pt.Source != "a" || pt.Timestamp != 1505454047 || len(pt.Tags) != 1 {
+		t.Errorf("unexpected point %+v: %v", pt, err)
+	}
+	pt, err = builders[5880].Build().Decode([]byte("metric foo.metric host1 2"))
+	if err != nil || pt.Source != "host1" || pt.Value != "2" || len(pt.Tags) != 0 {
+		t.Errorf("unexpected point %+v: %v", pt, err)
+	}
+
+	// validation errors are located in the fixed source
+	_, err = builders[5880].Build().Decode([]byte(`metric foo.metric "host 1" 2`))
+	if pe, ok := err.(*parser.ParseError); !ok || pe.Element != parser.ElementSource || pe.Offset != 23 {
+		t.Errorf("expected an invalid character in the source at offset 23, found %v", err)
+	}
+
+	for _, invalid := range []string{
+		"x:\n  elements: [name, value, tags]",
+		"5878:\n  elements: []",
+		"5878:\n  elements: [name, value]",
+		"5878:\n  elements: [name, value, tags]\n  format: graphite",
+		"5878:\n  elements: [name, value, tags]\n5878,5879:\n  elements: [value, name, tags]",
+		"global:\n  elements: [name, value, tags]",
+	} {
+		if _, err := LoadFormats([]byte(invalid)); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
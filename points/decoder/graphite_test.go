@@ -2,9 +2,41 @@ package decoder
 
 import (
 	"testing"
+
+	"github.com/wavefronthq/go-proxy/points/parser"
 )
 
+func TestDecodeErrorOffsets(t *testing.T) {
+	d := GraphiteBuilder{}.Build()
+	for _, test := range []struct {
+		line    string
+		offset  int
+		element string
+	}{
+		{"föo.bar 1 source=s", 1, parser.ElementName},
+		{"∆föo 1 source=s", 4, parser.ElementName},
+		{`"foo bar" 1 source=s`, 4, parser.ElementName},
+		{`foo 1 source="a#b"`, 15, parser.ElementSource},
+		{"foo 1 source=s env=dev kéy=v", 24, "tag 3"},
+		{"foo 1 source=s \"k\"=\"a\tb\"", 21, "tag 2"},
+	} {
+		_, err := d.Decode([]byte(test.line))
+		pe, ok := err.(*parser.ParseError)
+		if !ok {
+			t.Errorf("%q: expected a parse error, found %v", test.line, err)
+			continue
+		}
+		if pe.Offset != test.offset || pe.Element != test.element || pe.Category != parser.CategoryInvalidCharacter {
+			t.Errorf("%q: expected an invalid character in %s at offset %d, found %+v", test.line, test.element, test.offset, pe)
+		}
+		if _, ok := pe.Err.(*CharError); !ok {
+			t.Errorf("%q: expected the character error, found %v", test.line, pe.Err)
+		}
+	}
+}
+
 func BenchmarkDecodeBase(b *testing.B) {
+	b.ReportAllocs()
 	var builder DecoderBuilder = GraphiteBuilder{}
 	decoder := builder.Build()
 	p := []byte("\"foo.metric\" 1.5 source=foo-linux \"env\"=\"dev\"")
@@ -16,6 +48,7 @@ func BenchmarkDecodeBase(b *testing.B) {
 }
 
 func BenchmarkDecodeComplex(b *testing.B) {
+	b.ReportAllocs()
 	var builder DecoderBuilder = GraphiteBuilder{}
 	decoder := builder.Build()
 	p := []byte("\"mac.disk.total\" 4.9895440384E11 1504118031 source=\"Vikrams-MacBook-Pro.local\" \"path\"=\"/\" \"os\"=\"Mac\" \"device\"=\"disk1\" \"fstype\"=\"hfs\"")
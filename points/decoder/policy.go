@@ -0,0 +1,509 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/wavefronthq/go-proxy/common"
+	"github.com/wavefronthq/go-proxy/config"
+)
+
+// Problem found by a validation policy, also the name of its counter.
+type Violation string
+
+const (
+	ViolationNameLength     Violation = "name_length"
+	ViolationNameChars      Violation = "name_chars"
+	ViolationSourceLength   Violation = "source_length"
+	ViolationSourceChars    Violation = "source_chars"
+	ViolationTagKeyLength   Violation = "tag_key_length"
+	ViolationTagKeyChars    Violation = "tag_key_chars"
+	ViolationTagValueLength Violation = "tag_value_length"
+	ViolationTagValueChars  Violation = "tag_value_chars"
+	ViolationTagLength      Violation = "tag_length"
+	ViolationTagCount       Violation = "tag_count"
+	ViolationTooOld         Violation = "too_old"
+	ViolationTooFarInFuture Violation = "too_far_in_future"
+)
+
+var violations = []Violation{ViolationNameLength, ViolationNameChars, ViolationSourceLength, ViolationSourceChars,
+	ViolationTagKeyLength, ViolationTagKeyChars, ViolationTagValueLength, ViolationTagValueChars, ViolationTagLength,
+	ViolationTagCount,
+	ViolationTooOld, ViolationTooFarInFuture}
+
+func (v Violation) isTag() bool {
+	return strings.HasPrefix(string(v), "tag_")
+}
+
+func (v Violation) isTime() bool {
+	return v == ViolationTooOld || v == ViolationTooFarInFuture
+}
+
+// How a violation is handled.
+type Action string
+
+const (
+	// block the point
+	ActionReject Action = "reject"
+	// replace illegal characters with _, truncate over-long values and drop the tags past the limit
+	ActionSanitize Action = "sanitize"
+	// drop the offending tag, only for tag violations
+	ActionDropTag Action = "drop_tag"
+	// set the timestamp to the receive time, only for time violations
+	ActionClamp Action = "clamp"
+)
+
+const (
+	DefaultMaxNameLength   = 1023
+	DefaultMaxSourceLength = 1023
+	// key and value combined
+	DefaultMaxTagLength = 254
+
+	sanitizedChar = '_'
+)
+
+// Limits and actions of a validation policy. A limit of 0 disables the check.
+type PolicyConfig struct {
+	MaxNameLength     int `yaml:"maxNameLength"`
+	MaxSourceLength   int `yaml:"maxSourceLength"`
+	MaxTagKeyLength   int `yaml:"maxTagKeyLength"`
+	MaxTagValueLength int `yaml:"maxTagValueLength"`
+	MaxTagLength      int `yaml:"maxTagLength"`
+	MaxTags           int `yaml:"maxTags"`
+	// points with timestamps further than these before or after the receive time are too old or
+	// too far in the future, e.g. 48h
+	BackfillCutoff time.Duration `yaml:"backfillCutoff"`
+	PrefillCutoff  time.Duration `yaml:"prefillCutoff"`
+	// action for the violations not listed in Actions
+	Action  Action               `yaml:"action"`
+	Actions map[Violation]Action `yaml:"actions"`
+}
+
+// DefaultPolicyConfig returns the limits the proxy has always enforced, rejecting invalid points.
+func DefaultPolicyConfig() PolicyConfig {
+	return PolicyConfig{
+		MaxNameLength:   DefaultMaxNameLength,
+		MaxSourceLength: DefaultMaxSourceLength,
+		MaxTagLength:    DefaultMaxTagLength,
+		Action:          ActionReject,
+	}
+}
+
+func (c *PolicyConfig) action(v Violation) Action {
+	if action, ok := c.Actions[v]; ok {
+		return action
+	}
+	if v.isTime() {
+		// the default action fixes a point by clamping its timestamp, or rejects it
+		if c.Action == ActionSanitize || c.Action == ActionClamp {
+			return ActionClamp
+		}
+		return ActionReject
+	}
+	if c.Action == ActionClamp {
+		return ActionReject
+	}
+	return c.Action
+}
+
+func (c *PolicyConfig) check() error {
+	for name, limit := range map[string]int{"maxNameLength": c.MaxNameLength, "maxSourceLength": c.MaxSourceLength,
+		"maxTagKeyLength": c.MaxTagKeyLength, "maxTagValueLength": c.MaxTagValueLength,
+		"maxTagLength": c.MaxTagLength, "maxTags": c.MaxTags} {
+		if limit < 0 {
+			return fmt.Errorf("%s must not be negative, found %d", name, limit)
+		}
+	}
+	if c.BackfillCutoff < 0 || c.PrefillCutoff < 0 {
+		return errors.New("cutoffs must not be negative")
+	}
+	// the default action applies to the violations it can handle, the others are rejected
+	if err := checkAction(c.Action, ""); err != nil {
+		return err
+	}
+	for v, action := range c.Actions {
+		known := false
+		for _, violation := range violations {
+			known = known || v == violation
+		}
+		if !known {
+			return fmt.Errorf("unknown violation %q", v)
+		}
+		if err := checkAction(action, v); err != nil {
+			return fmt.Errorf("%s: %v", v, err)
+		}
+	}
+	return nil
+}
+
+// checkAction checks the action of a violation, or the default action if v is empty.
+func checkAction(action Action, v Violation) error {
+	switch {
+	case action == ActionReject:
+		return nil
+	case v == "":
+		if action == ActionSanitize || action == ActionDropTag || action == ActionClamp {
+			return nil
+		}
+	case v.isTime():
+		if action == ActionClamp {
+			return nil
+		}
+		return fmt.Errorf("unknown action %q, expected reject or clamp", action)
+	case action == ActionSanitize:
+		return nil
+	case action == ActionDropTag:
+		if v.isTag() {
+			return nil
+		}
+		return errors.New("drop_tag only applies to tag violations")
+	}
+	return fmt.Errorf("unknown action %q, expected reject, sanitize, drop_tag or clamp", action)
+}
+
+// Checks the name, source and tags of decoded points against limits, rejecting or fixing the points
+// which violate them. Violations are counted per type.
+type ValidationPolicy struct {
+	config   PolicyConfig
+	counters map[Violation]metrics.Counter
+}
+
+// NewValidationPolicy creates a policy counting violations as validation.<prefix>.<violation>,
+// where the prefix is typically the port.
+func NewValidationPolicy(prefix string, cfg PolicyConfig) (*ValidationPolicy, error) {
+	if err := cfg.check(); err != nil {
+		return nil, err
+	}
+	p := &ValidationPolicy{config: cfg, counters: make(map[Violation]metrics.Counter)}
+	for _, v := range violations {
+		p.counters[v] = metrics.GetOrRegisterCounter("validation."+prefix+"."+string(v), nil)
+	}
+	return p, nil
+}
+
+// without counters, used by decoders built without a policy
+var defaultPolicy = &ValidationPolicy{config: DefaultPolicyConfig()}
+
+func (p *ValidationPolicy) count(v Violation) {
+	if counter, ok := p.counters[v]; ok {
+		counter.Inc(1)
+	}
+}
+
+// Validate checks a point, fixing it in place if the policy sanitizes or drops tags.
+// Returns an error if the point is rejected.
+func (p *ValidationPolicy) Validate(point *common.Point) error {
+	// the name of a delta counter is checked without its prefix, which is always reported as ∆
+	name, delta := common.TrimDeltaPrefix(point.Name)
+	name, err := p.validateStr(name, p.config.MaxNameLength, ViolationNameLength, ViolationNameChars)
+	if err != nil {
+		return err
+	}
+	if delta {
+		name = common.DeltaPrefix + name
+	}
+	point.Name = name
+	if point.Source, err = p.validateStr(point.Source, p.config.MaxSourceLength, ViolationSourceLength, ViolationSourceChars); err != nil {
+		return err
+	}
+	if err := p.validateTags(point); err != nil {
+		return err
+	}
+	if p.config.BackfillCutoff == 0 && p.config.PrefillCutoff == 0 {
+		return nil
+	}
+	return p.validateTimestamp(point, time.Now())
+}
+
+// Timestamp of a point outside the accepted window, the skew is the distance to the receive time.
+type TimestampError struct {
+	Violation Violation
+	Timestamp int64
+	Skew      time.Duration
+	Cutoff    time.Duration
+}
+
+func (e *TimestampError) Error() string {
+	if e.Violation == ViolationTooOld {
+		return fmt.Sprintf("Timestamp %d is %v in the past, beyond the backfill cutoff of %v", e.Timestamp, e.Skew, e.Cutoff)
+	}
+	return fmt.Sprintf("Timestamp %d is %v in the future, beyond the prefill cutoff of %v", e.Timestamp, e.Skew, e.Cutoff)
+}
+
+// Summary leaves out the timestamp and skew, so blocked points are summarized by cutoff.
+func (e *TimestampError) Summary() string {
+	if e.Violation == ViolationTooOld {
+		return fmt.Sprintf("Timestamp beyond the backfill cutoff of %v", e.Cutoff)
+	}
+	return fmt.Sprintf("Timestamp beyond the prefill cutoff of %v", e.Cutoff)
+}
+
+// validateTimestamp checks the timestamp of a point received at now against the cutoffs.
+func (p *ValidationPolicy) validateTimestamp(point *common.Point, now time.Time) error {
+	skew := now.Sub(time.Unix(point.Timestamp, 0)).Truncate(time.Second)
+	var err *TimestampError
+	switch {
+	case p.config.BackfillCutoff > 0 && skew > p.config.BackfillCutoff:
+		err = &TimestampError{Violation: ViolationTooOld, Timestamp: point.Timestamp, Skew: skew, Cutoff: p.config.BackfillCutoff}
+	case p.config.PrefillCutoff > 0 && -skew > p.config.PrefillCutoff:
+		err = &TimestampError{Violation: ViolationTooFarInFuture, Timestamp: point.Timestamp, Skew: -skew, Cutoff: p.config.PrefillCutoff}
+	default:
+		return nil
+	}
+	p.count(err.Violation)
+	if p.config.action(err.Violation) == ActionClamp {
+		point.Timestamp = now.Unix()
+		return nil
+	}
+	return err
+}
+
+// validateStr checks a name or source, which are never dropped.
+func (p *ValidationPolicy) validateStr(s string, maxLen int, lengthViolation, charsViolation Violation) (string, error) {
+	if s == "" {
+		p.count(lengthViolation)
+		return s, fmt.Errorf(lengthErrStr, maxLen+1, 0)
+	}
+	if maxLen > 0 && len(s) > maxLen {
+		p.count(lengthViolation)
+		if p.config.action(lengthViolation) != ActionSanitize {
+			return s, fmt.Errorf(lengthErrStr, maxLen+1, len(s))
+		}
+		s = common.Truncate(s, maxLen)
+	}
+	if err := validateRunes(s); err != nil {
+		err.Violation = charsViolation
+		p.count(charsViolation)
+		if p.config.action(charsViolation) != ActionSanitize {
+			return s, err
+		}
+		s = sanitize(s)
+	}
+	return s, nil
+}
+
+// Change to a tag made while checking the tags, applied once all of them are checked.
+type tagChange struct {
+	key, newKey, value string
+	drop               bool
+}
+
+func (p *ValidationPolicy) validateTags(point *common.Point) error {
+	var changes []tagChange
+	for k, v := range point.Tags {
+		change, err := p.validateTag(k, v)
+		if err != nil {
+			return err
+		}
+		if change != nil {
+			changes = append(changes, *change)
+		}
+	}
+
+	for _, change := range changes {
+		delete(point.Tags, change.key)
+	}
+	// keys sanitized to the same key keep the value of the first one in sorted order
+	sort.Slice(changes, func(i, j int) bool { return changes[i].key < changes[j].key })
+	for _, change := range changes {
+		if change.drop {
+			continue
+		}
+		// a sanitized key must not replace another tag
+		if _, exists := point.Tags[change.newKey]; !exists {
+			point.Tags[change.newKey] = change.value
+		}
+	}
+
+	if maxTags := p.config.MaxTags; maxTags > 0 && len(point.Tags) > maxTags {
+		p.count(ViolationTagCount)
+		if p.config.action(ViolationTagCount) == ActionReject {
+			return fmt.Errorf("Expected at most %d tags, found %d", maxTags, len(point.Tags))
+		}
+		keys := make([]string, 0, len(point.Tags))
+		for k := range point.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys[maxTags:] {
+			delete(point.Tags, k)
+		}
+	}
+	return nil
+}
+
+// validateTag checks a tag, returning the change to apply if it is sanitized or dropped.
+func (p *ValidationPolicy) validateTag(k, v string) (*tagChange, error) {
+	key, value := k, v
+	// violated returns true if the tag is dropped, or an error if the point is rejected
+	violated := func(violation Violation, err error) (bool, error) {
+		p.count(violation)
+		switch p.config.action(violation) {
+		case ActionSanitize:
+			return false, nil
+		case ActionDropTag:
+			return true, nil
+		}
+		return false, err
+	}
+	if err := validateRunes(key); err != nil {
+		err.Violation, err.Key = ViolationTagKeyChars, k
+		if dropped, err := violated(ViolationTagKeyChars, err); err != nil || dropped {
+			return dropTag(k), err
+		}
+		key = sanitize(key)
+	}
+	if maxLen := p.config.MaxTagKeyLength; maxLen > 0 && len(key) > maxLen {
+		if dropped, err := violated(ViolationTagKeyLength, fmt.Errorf(lengthErrStr, maxLen+1, len(key))); err != nil || dropped {
+			return dropTag(k), err
+		}
+		key = common.Truncate(key, maxLen)
+	}
+	if err := validateValueRunes(value); err != nil {
+		err.Key = k
+		if dropped, err := violated(ViolationTagValueChars, err); err != nil || dropped {
+			return dropTag(k), err
+		}
+		value = sanitizeValue(value)
+	}
+	if maxLen := p.config.MaxTagValueLength; maxLen > 0 && len(value) > maxLen {
+		if dropped, err := violated(ViolationTagValueLength, fmt.Errorf(lengthErrStr, maxLen+1, len(value))); err != nil || dropped {
+			return dropTag(k), err
+		}
+		value = common.Truncate(value, maxLen)
+	}
+	if maxLen := p.config.MaxTagLength; maxLen > 0 && len(key)+len(value) > maxLen {
+		if dropped, err := violated(ViolationTagLength, fmt.Errorf(lengthErrStr, maxLen+1, len(key)+len(value))); err != nil || dropped {
+			return dropTag(k), err
+		}
+		if len(key) >= maxLen {
+			return dropTag(k), nil
+		}
+		value = common.Truncate(value, maxLen-len(key))
+	}
+
+	if key == k && value == v {
+		return nil, nil
+	}
+	return &tagChange{key: k, newKey: key, value: value}, nil
+}
+
+func dropTag(k string) *tagChange {
+	return &tagChange{key: k, drop: true}
+}
+
+// sanitize replaces the characters rejected by validateRunes with _.
+func sanitize(s string) string {
+	first := true
+	return strings.Map(func(r rune) rune {
+		valid := validRune(r) || (first && r == '~')
+		first = false
+		if valid {
+			return r
+		}
+		return sanitizedChar
+	}, s)
+}
+
+// sanitizeValue replaces the characters rejected by validateValueRunes with _.
+func sanitizeValue(s string) string {
+	return strings.Map(func(r rune) rune {
+		if validValueRune(r) {
+			return r
+		}
+		return sanitizedChar
+	}, s)
+}
+
+// Validation policies of the listener ports. Ports without settings of their own use the global settings.
+type Policies struct {
+	mtx    sync.Mutex
+	ports  map[int]*ValidationPolicy
+	global PolicyConfig
+}
+
+// For returns the validation policy of a port, or nil if no policy file was loaded.
+func (p *Policies) For(port int) (*ValidationPolicy, error) {
+	if p == nil {
+		return nil, nil
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if policy, ok := p.ports[port]; ok {
+		return policy, nil
+	}
+	policy, err := NewValidationPolicy(strconv.Itoa(port), p.global)
+	if err != nil {
+		return nil, err
+	}
+	p.ports[port] = policy
+	return policy, nil
+}
+
+// LoadPolicyFile reads a validation policy file.
+func LoadPolicyFile(filename string, base PolicyConfig) (*Policies, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return LoadPolicies(data, base)
+}
+
+// LoadPolicies parses policies keyed by comma separated port lists. The settings under the "global" key
+// apply to every port, the port settings override them, and both override the base settings.
+func LoadPolicies(data []byte, base PolicyConfig) (*Policies, error) {
+	file, err := config.ParsePortFile(data, false)
+	if err != nil {
+		return nil, err
+	}
+
+	global := *copyConfig(base)
+	if file.Global != nil {
+		if err := file.Global.Decode(&global); err != nil {
+			return nil, fmt.Errorf("%s: %v", config.GlobalKey, err)
+		}
+		if err := global.check(); err != nil {
+			return nil, fmt.Errorf("%s: %v", config.GlobalKey, err)
+		}
+	}
+
+	configs := make(map[int]*PolicyConfig)
+	for _, section := range file.Sections {
+		for _, port := range section.Ports {
+			cfg, ok := configs[port]
+			if !ok {
+				cfg = copyConfig(global)
+				configs[port] = cfg
+			}
+			if err := section.Decode(cfg); err != nil {
+				return nil, fmt.Errorf("port %d: %v", port, err)
+			}
+		}
+	}
+
+	policies := &Policies{ports: make(map[int]*ValidationPolicy), global: global}
+	for port, cfg := range configs {
+		policy, err := NewValidationPolicy(strconv.Itoa(port), *cfg)
+		if err != nil {
+			return nil, fmt.Errorf("port %d: %v", port, err)
+		}
+		policies.ports[port] = policy
+	}
+	return policies, nil
+}
+
+func copyConfig(cfg PolicyConfig) *PolicyConfig {
+	actions := make(map[Violation]Action, len(cfg.Actions))
+	for v, action := range cfg.Actions {
+		actions[v] = action
+	}
+	cfg.Actions = actions
+	return &cfg
+}
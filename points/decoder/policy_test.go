@@ -0,0 +1,288 @@
+package decoder
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wavefronthq/go-proxy/common"
+)
+
+const testPolicies = `
+global:
+  maxTags: 3
+  actions:
+    tag_count: drop_tag
+
+'2878,2879':
+  maxNameLength: 10
+  maxTagValueLength: 5
+  action: sanitize
+  actions:
+    tag_value_length: drop_tag
+
+'4242':
+  maxTagKeyLength: 3
+`
+
+func TestLoadPolicies(t *testing.T) {
+	policies, err := LoadPolicies([]byte(testPolicies), DefaultPolicyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies.ports) != 3 {
+		t.Fatalf("expected 3 policies, found %d", len(policies.ports))
+	}
+	cfg := policies.ports[2878].config
+	if cfg.MaxNameLength != 10 || cfg.MaxSourceLength != DefaultMaxSourceLength || cfg.MaxTags != 3 ||
+		cfg.Action != ActionSanitize || cfg.action(ViolationTagCount) != ActionDropTag ||
+		cfg.action(ViolationTagValueLength) != ActionDropTag || cfg.action(ViolationNameChars) != ActionSanitize {
+		t.Errorf("unexpected policy %+v", cfg)
+	}
+	cfg = policies.ports[4242].config
+	if cfg.MaxTagKeyLength != 3 || cfg.MaxNameLength != DefaultMaxNameLength || cfg.action(ViolationTagValueLength) != ActionReject {
+		t.Errorf("unexpected policy %+v", cfg)
+	}
+
+	for _, invalid := range []string{
+		"'2878':\n  maxTags: -1\n",
+		"'2878':\n  actions:\n    name_chars: drop_tag\n",
+		"'2878':\n  actions:\n    bad_violation: reject\n",
+		"'2878':\n  action: ignore\n",
+		"'2878':\n  actions:\n    too_old: sanitize\n",
+		"'2878':\n  actions:\n    name_length: clamp\n",
+		"'2878':\n  backfillCutoff: -1h\n",
+		"'2878':\n  maxTag: 1\n",
+		"'abc':\n  maxTags: 1\n",
+	} {
+		if _, err := LoadPolicies([]byte(invalid), DefaultPolicyConfig()); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestLoadPolicyCutoffs(t *testing.T) {
+	base := DefaultPolicyConfig()
+	base.BackfillCutoff = 48 * time.Hour
+	policies, err := LoadPolicies([]byte("'2878':\n  prefillCutoff: 15m\n  action: sanitize\n"), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := policies.ports[2878].config
+	if cfg.BackfillCutoff != 48*time.Hour || cfg.PrefillCutoff != 15*time.Minute {
+		t.Errorf("unexpected cutoffs %v and %v", cfg.BackfillCutoff, cfg.PrefillCutoff)
+	}
+	if cfg.action(ViolationTooOld) != ActionClamp || cfg.action(ViolationNameChars) != ActionSanitize {
+		t.Errorf("unexpected actions %+v", cfg)
+	}
+}
+
+func TestGlobalOnlyPolicy(t *testing.T) {
+	policies, err := LoadPolicies([]byte("global:\n  maxTags: 2\n  action: sanitize\n"), DefaultPolicyConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := policies.For(2003)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := policy.config
+	if cfg.MaxTags != 2 || cfg.MaxNameLength != DefaultMaxNameLength || cfg.action(ViolationNameChars) != ActionSanitize {
+		t.Errorf("unexpected policy %+v", cfg)
+	}
+	if again, _ := policies.For(2003); again != policy {
+		t.Error("expected the same policy for the port")
+	}
+
+	if policy, err := (*Policies)(nil).For(2003); policy != nil || err != nil {
+		t.Errorf("expected no policy without a policy file, found %v, %v", policy, err)
+	}
+}
+
+func newTestPolicy(t *testing.T, cfg PolicyConfig) *ValidationPolicy {
+	// counters are registered globally, so each test has its own
+	policy, err := NewValidationPolicy(t.Name(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+func TestSanitizePolicy(t *testing.T) {
+	cfg := DefaultPolicyConfig()
+	cfg.MaxNameLength = 10
+	cfg.MaxTagValueLength = 4
+	cfg.Action = ActionSanitize
+	policy := newTestPolicy(t, cfg)
+
+	point := &common.Point{Name: "~cpu load#1 extra", Source: "host 1",
+		Tags: map[string]string{"env": "production", "bad key": "v", "bad_key": "kept"}}
+	if err := policy.Validate(point); err != nil {
+		t.Fatal(err)
+	}
+	if point.Name != "~cpu_load_" || point.Source != "host_1" {
+		t.Errorf("unexpected name %q and source %q", point.Name, point.Source)
+	}
+	if len(point.Tags) != 2 || point.Tags["env"] != "prod" || point.Tags["bad_key"] != "kept" {
+		t.Errorf("unexpected tags %v", point.Tags)
+	}
+	if count := policy.counters[ViolationNameLength].Count(); count != 1 {
+		t.Errorf("expected 1 name length violation, found %d", count)
+	}
+	if count := policy.counters[ViolationTagKeyChars].Count(); count != 1 {
+		t.Errorf("expected 1 tag key violation, found %d", count)
+	}
+}
+
+func TestSanitizedKeyCollision(t *testing.T) {
+	cfg := DefaultPolicyConfig()
+	cfg.Action = ActionSanitize
+	policy := newTestPolicy(t, cfg)
+
+	// map order varies between runs, the first key in sorted order must always win
+	for i := 0; i < 20; i++ {
+		point := &common.Point{Name: "cpu", Source: "host",
+			Tags: map[string]string{"a#b": "2", "a b": "1", "a%b": "3"}}
+		if err := policy.Validate(point); err != nil {
+			t.Fatal(err)
+		}
+		if len(point.Tags) != 1 || point.Tags["a_b"] != "1" {
+			t.Fatalf("expected the value of \"a b\", found %v", point.Tags)
+		}
+	}
+}
+
+func TestDropTagPolicy(t *testing.T) {
+	cfg := DefaultPolicyConfig()
+	cfg.MaxTags = 2
+	cfg.Action = ActionDropTag
+	policy := newTestPolicy(t, cfg)
+
+	point := &common.Point{Name: "cpu", Source: "host",
+		Tags: map[string]string{"a": "1", "b": "2", "c": "3", "bad#": "x", "long": strings.Repeat("v", 300)}}
+	if err := policy.Validate(point); err != nil {
+		t.Fatal(err)
+	}
+	if len(point.Tags) != 2 || point.Tags["a"] != "1" || point.Tags["b"] != "2" {
+		t.Errorf("unexpected tags %v", point.Tags)
+	}
+	for _, v := range []Violation{ViolationTagKeyChars, ViolationTagLength, ViolationTagCount} {
+		if count := policy.counters[v].Count(); count != 1 {
+			t.Errorf("expected 1 %s violation, found %d", v, count)
+		}
+	}
+
+	// names cannot be dropped
+	if err := policy.Validate(&common.Point{Name: "cpu load", Source: "host"}); err == nil {
+		t.Error("expected an invalid name to be rejected")
+	}
+}
+
+func TestRejectPolicy(t *testing.T) {
+	policy := newTestPolicy(t, DefaultPolicyConfig())
+	point := &common.Point{Name: "cpu", Source: "host", Tags: map[string]string{"k": strings.Repeat("v", 254)}}
+	if err := policy.Validate(point); err == nil {
+		t.Error("expected a long tag to be rejected")
+	}
+	if count := policy.counters[ViolationTagLength].Count(); count != 1 {
+		t.Errorf("expected 1 tag length violation, found %d", count)
+	}
+}
+
+func TestWithPolicy(t *testing.T) {
+	cfg := DefaultPolicyConfig()
+	cfg.Action = ActionSanitize
+	d := WithPolicy(GraphiteBuilder{}, newTestPolicy(t, cfg)).Build()
+	point, err := d.Decode([]byte("\"cpu load\" 1 source=host"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if point.Name != "cpu_load" {
+		t.Errorf("expected a sanitized name, found %q", point.Name)
+	}
+	d = GraphiteBuilder{}.Build()
+	if _, err := d.Decode([]byte("\"cpu load\" 1 source=host")); err == nil {
+		t.Error("expected the default policy to reject the point")
+	}
+}
+
+func TestTimestampPolicy(t *testing.T) {
+	cfg := DefaultPolicyConfig()
+	cfg.BackfillCutoff = time.Hour
+	cfg.PrefillCutoff = 10 * time.Minute
+	cfg.Actions = map[Violation]Action{ViolationTooFarInFuture: ActionClamp}
+	policy := newTestPolicy(t, cfg)
+	now := time.Unix(1500000000, 0)
+
+	point := &common.Point{Timestamp: now.Add(-3 * time.Hour).Unix()}
+	err := policy.validateTimestamp(point, now)
+	if tsErr, ok := err.(*TimestampError); !ok || tsErr.Violation != ViolationTooOld || tsErr.Skew != 3*time.Hour {
+		t.Errorf("expected a point 3h old to be rejected, found %v", err)
+	} else if !strings.Contains(err.Error(), "3h0m0s in the past") {
+		t.Errorf("expected the skew in %q", err)
+	}
+
+	point = &common.Point{Timestamp: now.Add(time.Hour).Unix()}
+	if err := policy.validateTimestamp(point, now); err != nil || point.Timestamp != now.Unix() {
+		t.Errorf("expected a point 1h ahead to be clamped, found %d: %v", point.Timestamp, err)
+	}
+
+	for _, ts := range []time.Time{now, now.Add(-59 * time.Minute), now.Add(9 * time.Minute)} {
+		point = &common.Point{Timestamp: ts.Unix()}
+		if err := policy.validateTimestamp(point, now); err != nil || point.Timestamp != ts.Unix() {
+			t.Errorf("expected %v to be accepted, found %d: %v", ts, point.Timestamp, err)
+		}
+	}
+
+	if count := policy.counters[ViolationTooOld].Count(); count != 1 {
+		t.Errorf("expected 1 too old point, found %d", count)
+	}
+	if count := policy.counters[ViolationTooFarInFuture].Count(); count != 1 {
+		t.Errorf("expected 1 point too far in future, found %d", count)
+	}
+}
+
+func TestTagValuePolicy(t *testing.T) {
+	policy := newTestPolicy(t, DefaultPolicyConfig())
+	for _, value := range []string{"zürich", "東京", "ok ✓", "a/b,c=d"} {
+		point := &common.Point{Name: "cpu", Source: "host", Tags: map[string]string{"k": value}}
+		if err := policy.Validate(point); err != nil {
+			t.Errorf("expected %q to be valid, found %v", value, err)
+		}
+	}
+	for _, value := range []string{"a\tb", "a\x00b", "a\u200bb", "z\xfcrich"} {
+		point := &common.Point{Name: "cpu", Source: "host", Tags: map[string]string{"k": value}}
+		if err := policy.Validate(point); err == nil {
+			t.Errorf("expected %q to be rejected", value)
+		}
+	}
+	if count := policy.counters[ViolationTagValueChars].Count(); count != 4 {
+		t.Errorf("expected 4 tag value violations, found %d", count)
+	}
+
+	cfg := DefaultPolicyConfig()
+	cfg.Action = ActionSanitize
+	policy = newTestPolicy(t, cfg)
+	point := &common.Point{Name: "cpu", Source: "host", Tags: map[string]string{"k": "z\xfcrich\tzürich"}}
+	if err := policy.Validate(point); err != nil {
+		t.Fatal(err)
+	}
+	if point.Tags["k"] != "z_rich_zürich" {
+		t.Errorf("unexpected sanitized value %q", point.Tags["k"])
+	}
+}
+
+func TestDeltaPolicy(t *testing.T) {
+	policy := newTestPolicy(t, DefaultPolicyConfig())
+	for _, name := range []string{"∆req.count", "Δreq.count"} {
+		point := &common.Point{Name: name, Source: "host"}
+		if err := policy.Validate(point); err != nil || point.Name != "∆req.count" {
+			t.Errorf("expected %q to be reported as ∆req.count, found %q: %v", name, point.Name, err)
+		}
+	}
+	for _, name := range []string{"∆", "∆∆req.count", "req.∆count"} {
+		if err := policy.Validate(&common.Point{Name: name, Source: "host"}); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/wavefronthq/go-proxy/common"
+	"github.com/wavefronthq/go-proxy/points/parser"
+)
+
+// longest source description
+const maxDescriptionLength = 1024
+
+// Decodes and validates source metadata lines, see parser.SourceParser for the format.
+type SourceDecoder struct {
+	parser *parser.SourceParser
+}
+
+func NewSourceDecoder() *SourceDecoder {
+	return &SourceDecoder{parser: parser.NewSourceParser()}
+}
+
+func (d *SourceDecoder) Decode(b []byte) (*common.SourceOperation, error) {
+	op, err := d.parser.Parse(b)
+	if err != nil {
+		return nil, err
+	}
+	return op, validateSourceOperation(op)
+}
+
+// validateSourceOperation checks the action of an operation and its source, tags and description.
+// Sources follow the point source rules, tags and descriptions the tag value rules.
+func validateSourceOperation(op *common.SourceOperation) error {
+	if op.Source == "" {
+		return errors.New("Missing source")
+	}
+	if len(op.Source) > DefaultMaxSourceLength {
+		return fmt.Errorf(lengthErrStr, DefaultMaxSourceLength+1, len(op.Source))
+	}
+	if err := validateRunes(op.Source); err != nil {
+		return err
+	}
+
+	switch op.Type {
+	case common.SourceTagType:
+		switch op.Action {
+		case common.SourceActionAdd, common.SourceActionDelete:
+			if len(op.Tags) == 0 {
+				return fmt.Errorf("Expected at least one tag to %s", op.Action)
+			}
+		case common.SourceActionSave:
+		default:
+			return fmt.Errorf("Invalid action %q, expected add, delete or save", op.Action)
+		}
+		for _, tag := range op.Tags {
+			if len(tag) > DefaultMaxTagLength {
+				return fmt.Errorf(lengthErrStr, DefaultMaxTagLength+1, len(tag))
+			}
+			if err := validateValueRunes(tag); err != nil {
+				return err
+			}
+		}
+	case common.SourceDescriptionType:
+		switch op.Action {
+		case common.SourceActionSave:
+			if op.Description == "" {
+				return errors.New("Missing description, use action=delete to remove it")
+			}
+		case common.SourceActionDelete:
+			if op.Description != "" {
+				return errors.New("Unexpected description for action=delete")
+			}
+		default:
+			return fmt.Errorf("Invalid action %q, expected save or delete", op.Action)
+		}
+		if len(op.Description) > maxDescriptionLength {
+			return fmt.Errorf(lengthErrStr, maxDescriptionLength+1, len(op.Description))
+		}
+		if err := validateValueRunes(op.Description); err != nil {
+			return err
+		}
+	}
+	return nil
+}
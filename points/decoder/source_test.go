@@ -0,0 +1,32 @@
+package decoder
+
+import "testing"
+
+func TestDecodeSourceOperation(t *testing.T) {
+	d := NewSourceDecoder()
+	for _, line := range []string{
+		"@SourceTag action=add source=app1 web zürich",
+		"@SourceTag action=save source=app1",
+		`@SourceDescription action=save source=app1 description="Web server"`,
+		"@SourceDescription action=delete source=app1",
+	} {
+		if _, err := d.Decode([]byte(line)); err != nil {
+			t.Errorf("%q: %v", line, err)
+		}
+	}
+
+	for _, line := range []string{
+		"@SourceTag action=add web",
+		"@SourceTag action=remove source=app1 web",
+		"@SourceTag action=delete source=app1",
+		`@SourceTag action=add source="app 1" web`,
+		"@SourceTag action=add source=app1 \"a\tb\"",
+		"@SourceDescription source=app1 description=x",
+		"@SourceDescription action=save source=app1",
+		"@SourceDescription action=delete source=app1 description=x",
+	} {
+		if _, err := d.Decode([]byte(line)); err == nil {
+			t.Errorf("expected an error for %q", line)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package decoder
 import (
 	"errors"
 	"fmt"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/wavefronthq/go-proxy/common"
 )
@@ -12,57 +14,110 @@ const (
 	hostKey      = "host"
 	lengthErrStr = "Expected length less than %d, found %d"
 	charErrStr   = "Invalid character: %s"
+	valueErrStr  = "Invalid character in tag value: %q"
 )
 
+// ASCII characters valid in names, sources and tag keys, and in tag values
+var validBytes, validValueBytes [utf8.RuneSelf]bool
+
+func init() {
+	for ch := range validBytes {
+		validBytes[ch] = validRune(rune(ch))
+		validValueBytes[ch] = validValueRune(rune(ch))
+	}
+}
+
 var (
 	ErrMissingSource = errors.New("Missing source tag")
+	ErrInvalidUTF8   = errors.New("Invalid UTF-8 in tag value")
 )
 
+// validate checks a point against the default policy.
 func validate(point *common.Point) error {
-	err := validateStr(point.Name, 1024)
-	if err != nil {
-		return err
-	}
+	return defaultPolicy.Validate(point)
+}
 
-	err = validateStr(point.Source, 1024)
-	if err != nil {
-		return err
-	}
+// Character rejected by validation. The policy sets the violation, and the key of a tag.
+type CharError struct {
+	Violation Violation
+	Key       string
+	// byte index of the character in the name, source, tag key or tag value
+	Index int
+	Char  rune
+	// the value contains invalid UTF-8 at the index
+	InvalidUTF8 bool
+}
 
-	for k, v := range point.Tags {
-		totalLen := len(k) + len(v)
-		if totalLen >= 255 {
-			return fmt.Errorf(lengthErrStr, 254, totalLen)
-		}
-		err = validateRunes(k)
-		if err != nil {
-			return err
-		}
+func (e *CharError) Error() string {
+	switch {
+	case e.InvalidUTF8:
+		return ErrInvalidUTF8.Error()
+	case e.Violation == ViolationTagValueChars:
+		return fmt.Sprintf(valueErrStr, e.Char)
 	}
-	return nil
+	return fmt.Sprintf(charErrStr, string(e.Char))
 }
 
-func validateStr(s string, maxLen int) error {
-	strLen := len(s)
-	if strLen <= 0 || strLen >= maxLen {
-		return fmt.Errorf(lengthErrStr, maxLen, strLen)
+func (e *CharError) Unwrap() error {
+	if e.InvalidUTF8 {
+		return ErrInvalidUTF8
 	}
-	return validateRunes(s)
+	return nil
 }
 
-func validateRunes(s string) error {
+func validateRunes(s string) *CharError {
+	if validASCII(s, &validBytes) {
+		return nil
+	}
 	for idx, r := range s {
-		// Legal characters are 44-57 (,-./ and numbers), 65-90 (upper), 97-122 (lower), 95 (_)
-		if !(44 <= r && r <= 57) && !(65 <= r && r <= 90) && !(97 <= r && r <= 122) && r != 95 {
+		if !validRune(r) {
 			if idx != 0 || r != 126 {
 				// first character can be 126 (~)
-				return fmt.Errorf(charErrStr, string(r))
+				return &CharError{Index: idx, Char: r}
 			}
 		}
 	}
 	return nil
 }
 
+// Legal characters are 44-57 (,-./ and numbers), 65-90 (upper), 97-122 (lower), 95 (_)
+func validRune(r rune) bool {
+	return (44 <= r && r <= 57) || (65 <= r && r <= 90) || (97 <= r && r <= 122) || r == 95
+}
+
+// validateValueRunes checks a tag value. Unlike names, sources and tag keys, tag values may contain any
+// Unicode letter, mark, number, punctuation, symbol or space, but no control or format characters.
+func validateValueRunes(s string) *CharError {
+	if validASCII(s, &validValueBytes) {
+		return nil
+	}
+	for idx, r := range s {
+		if !validValueRune(r) {
+			_, size := utf8.DecodeRuneInString(s[idx:])
+			return &CharError{Violation: ViolationTagValueChars, Index: idx, Char: r,
+				InvalidUTF8: r == utf8.RuneError && size == 1}
+		}
+	}
+	return nil
+}
+
+// validASCII returns true if s is ASCII and every character is valid, without decoding runes.
+// A leading "~" is always valid.
+func validASCII(s string, valid *[utf8.RuneSelf]bool) bool {
+	for i := 0; i < len(s); i++ {
+		if ch := s[i]; ch >= utf8.RuneSelf || !valid[ch] && (i != 0 || ch != '~') {
+			return false
+		}
+	}
+	return true
+}
+
+// Legal tag value characters are the graphic Unicode characters (categories L, M, N, P, S and Zs)
+// except the replacement character, which stands in for invalid UTF-8.
+func validValueRune(r rune) bool {
+	return r != utf8.RuneError && unicode.IsGraphic(r)
+}
+
 func handleSource(point *common.Point) error {
 	if source, ok := point.Tags[sourceKey]; ok {
 		delete(point.Tags, sourceKey)
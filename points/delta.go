@@ -0,0 +1,101 @@
+package points
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/wavefronthq/go-proxy/common"
+)
+
+// Sum of the delta counter points of a series received during the current interval.
+type deltaSeries struct {
+	point *common.Point
+	sum   float64
+}
+
+// Sums the delta counter points received by a listener per series, reporting one point per series
+// every interval so that many small increments are sent as a single point.
+type deltaAggregator struct {
+	handler  PointHandler
+	interval time.Duration
+	mtx      sync.Mutex
+	series   map[string]*deltaSeries
+	// delta points received and sums reported
+	received metrics.Counter
+	reported metrics.Counter
+}
+
+func newDeltaAggregator(port int, handler PointHandler, interval time.Duration) *deltaAggregator {
+	return &deltaAggregator{
+		handler:  handler,
+		interval: interval,
+		series:   make(map[string]*deltaSeries),
+		received: metrics.GetOrRegisterCounter(fmt.Sprintf("points.%d.delta.received", port), nil),
+		reported: metrics.GetOrRegisterCounter(fmt.Sprintf("points.%d.delta.reported", port), nil),
+	}
+}
+
+// add adds a delta counter point to the sum of its series, or reports it right away if the
+// aggregation is disabled. Returns an error if the value is not a finite number.
+func (a *deltaAggregator) add(point *common.Point) error {
+	value, err := strconv.ParseFloat(point.Value, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return fmt.Errorf("Invalid delta counter value %s", point.Value)
+	}
+	a.received.Inc(1)
+	if a.interval <= 0 {
+		a.reported.Inc(1)
+		a.handler.reportPoint(point)
+		return nil
+	}
+
+	key := common.SeriesKey(point)
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if s, ok := a.series[key]; ok {
+		s.sum += value
+	} else {
+		// a copy, the point is still used by the listener
+		first := *point
+		a.series[key] = &deltaSeries{point: &first, sum: value}
+	}
+	return nil
+}
+
+// flush reports the sums of the current interval, timestamped with the flush time.
+func (a *deltaAggregator) flush() {
+	a.mtx.Lock()
+	series := a.series
+	a.series = make(map[string]*deltaSeries)
+	a.mtx.Unlock()
+
+	now := time.Now().Unix()
+	for _, s := range series {
+		s.point.Value = strconv.FormatFloat(s.sum, 'f', -1, 64)
+		s.point.Timestamp = now
+		a.handler.reportPoint(s.point)
+	}
+	a.reported.Inc(int64(len(series)))
+}
+
+// run flushes the sums every interval until done is closed. The sums received after that are
+// flushed by the listener once its connections are closed.
+func (a *deltaAggregator) run(done <-chan struct{}) {
+	if a.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.flush()
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package points
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wavefronthq/go-proxy/common"
+)
+
+// Records the reported points instead of forwarding them.
+type recordingHandler struct {
+	*DefaultPointHandler
+	points []*common.Point
+}
+
+func (h *recordingHandler) reportPoint(point *common.Point) {
+	h.points = append(h.points, point)
+}
+
+func TestDeltaAggregation(t *testing.T) {
+	l := newTestListener(nil)
+	defer l.handler.stop()
+	handler := &recordingHandler{DefaultPointHandler: l.handler.(*DefaultPointHandler)}
+	l.handler = handler
+	l.deltas = newDeltaAggregator(l.Port, handler, time.Minute)
+
+	blocked, _ := l.processLines(strings.NewReader("∆req.count 1 source=a\nΔreq.count 2.5 source=a\n"+
+		"∆req.count 5 source=b\n\"∆req.count\" 1 source=a env=x\nreq.count 1 source=a\n∆req.count NaN source=a\n"), "")
+	if blocked != 1 {
+		t.Errorf("expected the NaN delta to be blocked, found %d blocked", blocked)
+	}
+	if len(handler.points) != 1 || handler.points[0].Name != "req.count" {
+		t.Fatalf("expected only the plain counter to be reported, found %v", handler.points)
+	}
+
+	l.deltas.flush()
+	sums := make(map[string]string)
+	for _, point := range handler.points[1:] {
+		if point.Name != "∆req.count" || point.Timestamp == 0 {
+			t.Errorf("unexpected delta point %+v", point)
+		}
+		sums[point.Source+" "+point.Tags["env"]] = point.Value
+	}
+	if len(sums) != 3 || sums["a "] != "3.5" || sums["b "] != "5" || sums["a x"] != "1" {
+		t.Errorf("unexpected sums %v", sums)
+	}
+
+	l.deltas.flush()
+	if len(handler.points) != 4 {
+		t.Errorf("expected the sums to be reset, found %d points", len(handler.points))
+	}
+}
@@ -0,0 +1,77 @@
+package points
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/wavefronthq/go-proxy/api"
+	"github.com/wavefronthq/go-proxy/common"
+	"github.com/wavefronthq/go-proxy/logging"
+)
+
+const (
+	// events posted per request
+	eventBatchSize = 100
+	// events buffered per listener, the oldest are dropped when posts keep failing
+	eventBufferSize = 10000
+)
+
+// Counts the events received by a listener and hands them to its forwarder, which posts them to the
+// Wavefront event API.
+type eventHandler struct {
+	name      string
+	api       api.WavefrontAPI
+	forwarder *queuedForwarder
+	received  metrics.Counter
+	blocked   metrics.Counter
+}
+
+func newEventHandler(name string, service api.WavefrontAPI) *eventHandler {
+	h := &eventHandler{
+		name:     name,
+		api:      service,
+		received: metrics.GetOrRegisterCounter("events."+name+".received", nil),
+		blocked:  metrics.GetOrRegisterCounter("events."+name+".blocked", nil),
+	}
+	h.forwarder = newQueuedForwarder("events."+name, eventBatchSize, eventBufferSize, h.post)
+	return h
+}
+
+func (h *eventHandler) reportEvent(event *common.Event) {
+	h.received.Inc(1)
+	h.forwarder.add(event)
+}
+
+// handleBlockedEvent counts a blocked event and logs it to the sampled blocked points log.
+func (h *eventHandler) handleBlockedEvent(eventLine, client string, reason error) {
+	logging.LogBlockedPoint(h.name, client, eventLine, reason)
+	h.blocked.Inc(1)
+}
+
+func (h *eventHandler) stop() {
+	h.forwarder.stop()
+}
+
+func (h *eventHandler) drain(deadline time.Time) (flushed, dropped int64) {
+	return h.forwarder.drain(deadline)
+}
+
+// post sends a batch of events in a single request.
+func (h *eventHandler) post(events []interface{}) postResult {
+	data, err := json.Marshal(events)
+	if err != nil {
+		logging.Warn("error encoding events", "forwarder", h.name, "error", err)
+		return postRejected
+	}
+
+	resp, err := h.api.PostEvents(data)
+	result := postOutcome(resp, err)
+	switch {
+	case result == postRetry && err != nil:
+		logging.Warn("error posting events", "forwarder", h.name, "error", err)
+	case result == postRejected:
+		logging.Warn("events rejected", "forwarder", h.name, "status", resp.StatusCode, "events", len(events))
+	}
+	return result
+}
@@ -0,0 +1,58 @@
+package points
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wavefronthq/go-proxy/common"
+)
+
+func TestProcessEvents(t *testing.T) {
+	l := newTestListener(nil)
+	defer l.handler.stop()
+	service := &testAPI{}
+	l.events.stop()
+	l.events = newEventHandler(t.Name(), service)
+
+	blocked, err := l.processLines(strings.NewReader("@Event 1569423200123 deploy host=app1\n"+
+		"@Event 1569423200 deploy\n"+"a.b 1 source=x\n"), "10.0.0.1:5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocked != 1 || l.events.received.Count() != 1 || l.events.blocked.Count() != 1 {
+		t.Errorf("expected 1 event received and 1 blocked, found %d, %d and %d",
+			blocked, l.events.received.Count(), l.events.blocked.Count())
+	}
+
+	flushed, dropped := l.events.drain(time.Now().Add(time.Second))
+	if flushed != 1 || dropped != 0 || len(service.events) != 1 {
+		t.Fatalf("expected 1 event to be flushed, found %d flushed and %d dropped", flushed, dropped)
+	}
+	var events []common.Event
+	if err := json.Unmarshal([]byte(service.events[0]), &events); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Name != "deploy" || events[0].Hosts[0] != "app1" {
+		t.Errorf("unexpected events %+v", events)
+	}
+}
+
+func TestEventForwarderRetry(t *testing.T) {
+	service := &testAPI{failures: 1}
+	f := newEventHandler(t.Name(), service).forwarder
+	for i := 0; i < eventBatchSize+1; i++ {
+		f.add(&common.Event{Name: "e", StartTime: 1569423200123, EndTime: 1569423200124})
+	}
+	if sent, done := f.flush(); sent != 0 || done {
+		t.Errorf("expected the first post to fail, found %d sent", sent)
+	}
+	if sent, done := f.flush(); sent != eventBatchSize+1 || !done {
+		t.Errorf("expected all events to be sent in 2 posts, found %d sent", sent)
+	}
+	if len(service.events) != 2 || f.sent.Count() != eventBatchSize+1 {
+		t.Errorf("unexpected posts %d and sent count %d", len(service.events), f.sent.Count())
+	}
+	f.stop()
+}
@@ -1,13 +1,21 @@
 package points
 
 import (
-	"log"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/rcrowley/go-metrics"
 	"github.com/wavefronthq/go-proxy/api"
+	"github.com/wavefronthq/go-proxy/logging"
+)
+
+const (
+	// wait between retries of failed posts while draining the buffer
+	drainRetryInterval = time.Second
+	// a forwarder whose posts have failed for this long while holding points is considered stuck
+	stuckAfter = time.Minute
 )
 
 // Interface that forwards points to a Wavefront instance.
@@ -15,11 +23,15 @@ type PointForwarder interface {
 	init()
 	addPoint(point string)
 	checkOverflow()
+	update(flushInterval, maxBufferSize, maxFlushSize int)
+	drain(deadline time.Time) (flushed, dropped int64)
 	incrementBlockedPoint()
 	receivedPoints() int64
 	blockedPoints() int64
 	sentPoints() int64
 	queuedPoints() int64
+	bufferedPoints() int
+	lastResponse() (code int, at time.Time, failingSince time.Time)
 	stop()
 }
 
@@ -34,6 +46,15 @@ type DefaultPointForwarder struct {
 	mtx             sync.Mutex
 	api             api.WavefrontAPI
 	pushTicker      *time.Ticker
+	intervalUpdates chan time.Duration
+	done            chan struct{}
+	stopOnce        sync.Once
+	exited          chan struct{}
+	lastCode        int
+	lastPost        time.Time
+	failingSince    time.Time
+	// set while draining, when failed posts stay in the buffer instead of overflowing to the queue
+	draining        bool
 	pointsReceived  metrics.Counter
 	pointsBlocked   metrics.Counter
 	pointsQueued    metrics.Counter
@@ -47,20 +68,84 @@ func (f *DefaultPointForwarder) init() {
 	f.pointsQueued = metrics.GetOrRegisterCounter("points."+f.prefix+".queued", nil)
 	f.pointsSent = metrics.GetOrRegisterCounter("points."+f.prefix+".sent", nil)
 	f.pointsFlushTime = metrics.GetOrRegisterTimer("push."+f.prefix+".duration", nil)
+	f.intervalUpdates = make(chan time.Duration)
+	f.done = make(chan struct{})
+	f.exited = make(chan struct{})
 	go f.flushPoints()
 }
 
 func (f *DefaultPointForwarder) flushPoints() {
-	for range f.pushTicker.C {
-		f.pointsFlushTime.Time(func() {
-			f.post(f.getPointsBatch())
-		})
+	defer close(f.exited)
+	for {
+		select {
+		case <-f.pushTicker.C:
+			f.pointsFlushTime.Time(func() {
+				f.post(f.getPointsBatch())
+			})
+		case interval := <-f.intervalUpdates:
+			f.pushTicker.Stop()
+			f.pushTicker = time.NewTicker(interval)
+		case <-f.done:
+			f.pushTicker.Stop()
+			logging.Debug("exiting flushPoints", "forwarder", f.name)
+			return
+		}
 	}
-	log.Printf("%s: exiting flushPoints", f.name)
 }
 
+// stop stops the periodic flushes, it may be called more than once.
 func (f *DefaultPointForwarder) stop() {
-	f.pushTicker.Stop()
+	f.stopOnce.Do(func() {
+		close(f.done)
+	})
+}
+
+// drain stops the periodic flushes and then posts the buffered points until none are left or the
+// deadline has passed. Failed posts are retried until the deadline. Returns the number of points
+// sent and the number left in the buffer.
+func (f *DefaultPointForwarder) drain(deadline time.Time) (flushed, dropped int64) {
+	f.stop()
+	<-f.exited
+	f.mtx.Lock()
+	f.draining = true
+	f.mtx.Unlock()
+
+	for time.Now().Before(deadline) {
+		batch := f.getPointsBatch()
+		if len(batch) == 0 {
+			break
+		}
+		if f.post(batch) {
+			flushed += int64(len(batch))
+			continue
+		}
+		// retry after a short wait
+		wait := time.Until(deadline)
+		if wait > drainRetryInterval {
+			wait = drainRetryInterval
+		}
+		time.Sleep(wait)
+	}
+
+	f.mtx.Lock()
+	dropped = int64(len(f.points))
+	f.points = nil
+	f.mtx.Unlock()
+	return flushed, dropped
+}
+
+// update changes the flush interval (in milliseconds) and buffer limits of a running forwarder.
+func (f *DefaultPointForwarder) update(flushInterval, maxBufferSize, maxFlushSize int) {
+	f.mtx.Lock()
+	f.maxBufferSize = maxBufferSize
+	f.maxFlushSize = maxFlushSize
+	f.mtx.Unlock()
+
+	select {
+	case f.intervalUpdates <- time.Millisecond * time.Duration(flushInterval):
+	case <-f.done:
+	}
+	f.checkOverflow()
 }
 
 func min(x, y int) int {
@@ -97,8 +182,10 @@ func (f *DefaultPointForwarder) addPoint(point string) {
 }
 
 func (f *DefaultPointForwarder) checkOverflow() {
-	ptsLength := len(f.points)
-	if ptsLength > f.maxBufferSize {
+	f.mtx.Lock()
+	overflow := len(f.points) > f.maxBufferSize
+	f.mtx.Unlock()
+	if overflow {
 		f.drainToQueue()
 	}
 }
@@ -107,7 +194,7 @@ func (f *DefaultPointForwarder) drainToQueue() {
 	f.mtx.Lock()
 	ptsLength := len(f.points)
 	overflow := ptsLength - f.maxBufferSize
-	if overflow > 0 {
+	if overflow > 0 && !f.draining {
 		// provide headroom for arriving points
 		trimIdx := min(overflow+f.maxFlushSize, ptsLength)
 		pointsToQueue := f.points[:trimIdx]
@@ -145,21 +232,55 @@ func (f *DefaultPointForwarder) queuedPoints() int64 {
 	return f.pointsQueued.Count()
 }
 
-func (f *DefaultPointForwarder) post(points []string) {
+func (f *DefaultPointForwarder) bufferedPoints() int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return len(f.points)
+}
+
+// lastResponse returns the status code of the last post (0 if it failed without a response), when it
+// happened and since when posts have been failing (zero if the last post succeeded).
+func (f *DefaultPointForwarder) lastResponse() (code int, at time.Time, failingSince time.Time) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.lastCode, f.lastPost, f.failingSince
+}
+
+func (f *DefaultPointForwarder) recordResponse(resp *http.Response, err error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.lastPost = time.Now()
+	f.lastCode = 0
+	if resp != nil {
+		f.lastCode = resp.StatusCode
+	}
+	if err != nil || f.lastCode == api.NotAcceptableStatusCode {
+		if f.failingSince.IsZero() {
+			f.failingSince = f.lastPost
+		}
+	} else {
+		f.failingSince = time.Time{}
+	}
+}
+
+// post sends the points, putting them back in the buffer if that fails. Returns true if they were sent.
+func (f *DefaultPointForwarder) post(points []string) bool {
 	ptsLength := len(points)
 	if ptsLength == 0 {
-		return
+		return true
 	}
 
 	pointLines := strings.Join(points, "\n")
 	resp, err := f.api.PostData(f.workUnitId, f.dataFormat, pointLines)
+	f.recordResponse(resp, err)
 
 	if err != nil || (resp.StatusCode == api.NotAcceptableStatusCode) {
 		if err != nil {
-			log.Printf("%s: error posting data: %v\n", f.name, err)
+			logging.Warn("error posting data", "forwarder", f.name, "error", err)
 		}
 		f.buffer(points)
-		return
+		return false
 	}
 	f.pointsSent.Inc(int64(ptsLength))
+	return true
 }
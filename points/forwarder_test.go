@@ -0,0 +1,130 @@
+package points
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wavefronthq/go-proxy/common"
+	"github.com/wavefronthq/go-proxy/config"
+)
+
+// WavefrontAPI which records posted points and fails the given number of posts first.
+type testAPI struct {
+	mtx      sync.Mutex
+	failures int
+	posted   []string
+	events   []string
+	sources  []*common.SourceOperation
+}
+
+func (a *testAPI) GetConfig(currentMillis, bytesLeft, bytesPerMinute, currentQueueSize int64) (*config.AgentConfig, error) {
+	return &config.AgentConfig{}, nil
+}
+
+func (a *testAPI) Checkin(currentMillis int64, localAgent, pushAgent, ephemeral bool, agentMetrics []byte) (*config.AgentConfig, error) {
+	return &config.AgentConfig{}, nil
+}
+
+func (a *testAPI) PostData(workUnitId, format, pointLines string) (*http.Response, error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if a.failures > 0 {
+		a.failures--
+		return &http.Response{}, errors.New("unavailable")
+	}
+	a.posted = append(a.posted, strings.Split(pointLines, "\n")...)
+	return &http.Response{StatusCode: http.StatusAccepted}, nil
+}
+
+func (a *testAPI) PostEvents(events []byte) (*http.Response, error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if a.failures > 0 {
+		a.failures--
+		return &http.Response{}, errors.New("unavailable")
+	}
+	a.events = append(a.events, string(events))
+	return &http.Response{StatusCode: http.StatusAccepted}, nil
+}
+
+func (a *testAPI) UpdateSource(op *common.SourceOperation) (*http.Response, error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if a.failures > 0 {
+		a.failures--
+		return &http.Response{}, errors.New("unavailable")
+	}
+	a.sources = append(a.sources, op)
+	return &http.Response{StatusCode: http.StatusOK}, nil
+}
+
+func (a *testAPI) AgentError(details string) {}
+
+func (a *testAPI) AgentConfigProcessed() error {
+	return nil
+}
+
+func newTestForwarder(service *testAPI) *DefaultPointForwarder {
+	f := &DefaultPointForwarder{
+		name:          "test-forwarder",
+		prefix:        "test",
+		api:           service,
+		maxFlushSize:  2,
+		maxBufferSize: 100,
+		pushTicker:    time.NewTicker(time.Hour),
+	}
+	f.init()
+	return f
+}
+
+func TestForwarderDrain(t *testing.T) {
+	service := &testAPI{failures: 1}
+	f := newTestForwarder(service)
+	for _, point := range []string{"a", "b", "c", "d", "e"} {
+		f.addPoint(point)
+	}
+
+	flushed, dropped := f.drain(time.Now().Add(5 * time.Second))
+	if flushed != 5 || dropped != 0 {
+		t.Errorf("expected 5 flushed and 0 dropped, found %d and %d", flushed, dropped)
+	}
+	if strings.Join(service.posted, ",") != "a,b,c,d,e" {
+		t.Errorf("unexpected points posted: %v", service.posted)
+	}
+}
+
+func TestForwarderDrainDeadline(t *testing.T) {
+	service := &testAPI{failures: 100}
+	f := newTestForwarder(service)
+	for _, point := range []string{"a", "b", "c"} {
+		f.addPoint(point)
+	}
+
+	flushed, dropped := f.drain(time.Now().Add(100 * time.Millisecond))
+	if flushed != 0 || dropped != 3 {
+		t.Errorf("expected 0 flushed and 3 dropped, found %d and %d", flushed, dropped)
+	}
+}
+
+func TestForwarderDrainOverflow(t *testing.T) {
+	service := &testAPI{failures: 100}
+	f := newTestForwarder(service)
+	f.maxBufferSize = 2
+	for _, point := range []string{"a", "b", "c", "d", "e"} {
+		f.addPoint(point)
+	}
+	queued := f.queuedPoints()
+
+	// failed posts must not overflow to the queue, which is not running during shutdown
+	flushed, dropped := f.drain(time.Now().Add(100 * time.Millisecond))
+	if flushed != 0 || dropped != 5 {
+		t.Errorf("expected 0 flushed and 5 dropped, found %d and %d", flushed, dropped)
+	}
+	if f.queuedPoints() != queued {
+		t.Errorf("expected no points queued, found %d", f.queuedPoints()-queued)
+	}
+}
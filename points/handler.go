@@ -3,35 +3,52 @@ package points
 import (
 	"bytes"
 	"fmt"
-	"log"
 	"math/rand"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
 
+	"github.com/rcrowley/go-metrics"
 	"github.com/wavefronthq/go-proxy/api"
 	"github.com/wavefronthq/go-proxy/common"
+	"github.com/wavefronthq/go-proxy/config"
+	"github.com/wavefronthq/go-proxy/logging"
+	"github.com/wavefronthq/go-proxy/points/decoder"
+	"github.com/wavefronthq/go-proxy/points/parser"
+	"github.com/wavefronthq/go-proxy/points/preprocessor"
 )
 
 const (
-	minForwarders    = 4
-	maxForwarders    = 16
-	minFlushInterval = 1000
+	// distinct blocked reasons counted per summary, others are counted together
+	maxBlockedReasons  = 100
+	otherBlockedReason = "other"
+
+	minForwarders    = config.DefaultFlushThreads
+	maxForwarders    = config.MaxFlushThreads
+	minFlushInterval = config.MinFlushInterval
 )
 
 // Interface that handles the reporting of points.
 type PointHandler interface {
 	init(numTasks, interval, buffer, maxFlush int, dataFormat, workUnitId string, service api.WavefrontAPI)
 	stop()
+	drain(deadline time.Time) (flushed, dropped int64)
+	status(s *ListenerStatus)
+	update(flushInterval, maxBufferSize, maxFlushSize int)
 	reportPoint(point *common.Point)
 	reportPoints(points []*common.Point)
-	handleBlockedPoint(pointLine string)
+	handleBlockedPoint(pointLine, client string, reason error)
 }
 
 type DefaultPointHandler struct {
 	name            string
 	pointForwarders []PointForwarder
 	bufPool         sync.Pool
+	done            chan struct{}
+	stopOnce        sync.Once
+	blockedMtx      sync.Mutex
+	blockedReasons  map[string]int64
 }
 
 func (h *DefaultPointHandler) init(numForwarders, flushInterval, maxBufferSize, maxFlushSize int,
@@ -43,6 +60,7 @@ func (h *DefaultPointHandler) init(numForwarders, flushInterval, maxBufferSize,
 		},
 	}
 
+	h.done = make(chan struct{})
 	h.pointForwarders = make([]PointForwarder, numForwarders)
 	for i := 0; i < numForwarders; i++ {
 		pointForwarder := &DefaultPointForwarder{
@@ -59,9 +77,23 @@ func (h *DefaultPointHandler) init(numForwarders, flushInterval, maxBufferSize,
 		pointForwarder.init()
 	}
 
+	// replaces the gauge of a previous handler on the same port
+	bufferedName := "points." + h.name + ".buffered"
+	metrics.Unregister(bufferedName)
+	metrics.Register(bufferedName, metrics.NewFunctionalGauge(h.bufferedPoints))
+
 	go h.printSummary()
 }
 
+// bufferedPoints returns the number of points held in the buffers of all forwarders.
+func (h *DefaultPointHandler) bufferedPoints() int64 {
+	var buffered int64
+	for _, forwarder := range h.pointForwarders {
+		buffered += int64(forwarder.bufferedPoints())
+	}
+	return buffered
+}
+
 func (h *DefaultPointHandler) getForwarder() PointForwarder {
 	index := rand.Intn(len(h.pointForwarders))
 	return h.pointForwarders[index]
@@ -79,23 +111,159 @@ func (h *DefaultPointHandler) reportPoints(points []*common.Point) {
 	}
 }
 
-func (h *DefaultPointHandler) handleBlockedPoint(pointLine string) {
-	log.Printf("%s-handler: blocked point: %s", h.name, pointLine)
+// Blocked point reason with details varying from point to point, such as a timestamp skew, which
+// are left out of the summary.
+type summarizer interface {
+	Summary() string
+}
+
+// Categories of the blocked points which are not parse errors.
+const (
+	blockedLineTooLong   = "line_too_long"
+	blockedPreprocessor  = "preprocessor"
+	blockedMissingSource = "missing_source"
+	blockedInvalid       = "invalid"
+)
+
+// blockedCategory returns the category a blocked point is counted under: the category of a parse error,
+// the violation of a timestamp outside the cutoffs, or why other points were blocked.
+func blockedCategory(reason error) string {
+	switch err := reason.(type) {
+	case *parser.ParseError:
+		return string(err.Category)
+	case *decoder.CharError:
+		if err.InvalidUTF8 {
+			return string(parser.CategoryInvalidUTF8)
+		}
+		return string(parser.CategoryInvalidCharacter)
+	case *decoder.TimestampError:
+		return string(err.Violation)
+	case *preprocessor.RejectedError:
+		return blockedPreprocessor
+	}
+	switch reason {
+	case ErrLineTooLong:
+		return blockedLineTooLong
+	case decoder.ErrMissingSource:
+		return blockedMissingSource
+	}
+	return blockedInvalid
+}
+
+// handleBlockedPoint counts a blocked point by category and by reason for the summary, and logs it to
+// the sampled blocked points log.
+func (h *DefaultPointHandler) handleBlockedPoint(pointLine, client string, reason error) {
+	logging.LogBlockedPoint(h.name, client, pointLine, reason)
 	h.getForwarder().incrementBlockedPoint()
+	metrics.GetOrRegisterCounter("points."+h.name+".blocked."+blockedCategory(reason), nil).Inc(1)
+
+	key := reason.Error()
+	if s, ok := reason.(summarizer); ok {
+		key = s.Summary()
+	}
+	h.blockedMtx.Lock()
+	if h.blockedReasons == nil {
+		h.blockedReasons = make(map[string]int64)
+	}
+	if _, ok := h.blockedReasons[key]; !ok && len(h.blockedReasons) >= maxBlockedReasons {
+		key = otherBlockedReason
+	}
+	h.blockedReasons[key]++
+	h.blockedMtx.Unlock()
+}
+
+// logBlockedSummary logs the number of points blocked for each reason since the last summary.
+func (h *DefaultPointHandler) logBlockedSummary() {
+	h.blockedMtx.Lock()
+	reasons := h.blockedReasons
+	h.blockedReasons = nil
+	h.blockedMtx.Unlock()
+
+	keys := make([]string, 0, len(reasons))
+	for key := range reasons {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return reasons[keys[i]] > reasons[keys[j]] })
+	for _, key := range keys {
+		logging.Info("blocked points summary", "port", h.name, "reason", key, "count", reasons[key])
+	}
+}
+
+func (h *DefaultPointHandler) update(flushInterval, maxBufferSize, maxFlushSize int) {
+	for _, forwarder := range h.pointForwarders {
+		forwarder.update(flushInterval, maxBufferSize, maxFlushSize)
+	}
 }
 
 func (h *DefaultPointHandler) stop() {
+	h.closeDone()
 	for _, forwarder := range h.pointForwarders {
 		forwarder.stop()
 	}
 }
 
+// closeDone stops the periodic tasks of the handler, Stop may follow Shutdown.
+func (h *DefaultPointHandler) closeDone() {
+	h.stopOnce.Do(func() {
+		close(h.done)
+	})
+}
+
+// drain flushes the buffers of all forwarders in parallel until the deadline.
+// Returns the total number of points sent and dropped.
+func (h *DefaultPointHandler) drain(deadline time.Time) (flushed, dropped int64) {
+	h.closeDone()
+	var wg sync.WaitGroup
+	var mtx sync.Mutex
+	for _, forwarder := range h.pointForwarders {
+		wg.Add(1)
+		go func(forwarder PointForwarder) {
+			defer wg.Done()
+			f, d := forwarder.drain(deadline)
+			mtx.Lock()
+			flushed += f
+			dropped += d
+			mtx.Unlock()
+		}(forwarder)
+	}
+	wg.Wait()
+	return flushed, dropped
+}
+
+// status fills in the point counts, buffer depth and upstream state of a listener's status.
+func (h *DefaultPointHandler) status(s *ListenerStatus) {
+	// the counters are shared by all forwarders of a handler
+	f := h.pointForwarders[0]
+	s.Received, s.Sent, s.Blocked, s.Queued = f.receivedPoints(), f.sentPoints(), f.blockedPoints(), f.queuedPoints()
+
+	var lastPost time.Time
+	for _, forwarder := range h.pointForwarders {
+		buffered := forwarder.bufferedPoints()
+		s.Buffered += buffered
+		code, at, failingSince := forwarder.lastResponse()
+		if at.After(lastPost) {
+			lastPost = at
+			s.LastResponseCode = code
+		}
+		if buffered > 0 && !failingSince.IsZero() && time.Since(failingSince) > stuckAfter {
+			s.StuckForwarders++
+		}
+	}
+}
+
 func (h *DefaultPointHandler) printSummary() {
 	ticker := time.NewTicker(time.Minute * time.Duration(1))
-	for range ticker.C {
-		f := h.getForwarder()
-		log.Printf("[%s] (SUMMARY): points received: %d; sent: %d; blocked: %d; queued: %d", h.name,
-			f.receivedPoints(), f.sentPoints(), f.blockedPoints(), f.queuedPoints())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			f := h.getForwarder()
+			logging.Info("points summary", "port", h.name, "received", f.receivedPoints(), "sent", f.sentPoints(),
+				"blocked", f.blockedPoints(), "queued", f.queuedPoints())
+			h.logBlockedSummary()
+		case <-h.done:
+			return
+		}
 	}
 }
 
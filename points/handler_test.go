@@ -2,12 +2,38 @@ package points
 
 import (
 	"fmt"
+	"github.com/rcrowley/go-metrics"
 	"github.com/wavefronthq/go-proxy/api"
 	"github.com/wavefronthq/go-proxy/common"
+	"github.com/wavefronthq/go-proxy/points/decoder"
 	"testing"
 	"time"
 )
 
+func TestBlockedCategories(t *testing.T) {
+	h := &DefaultPointHandler{name: t.Name()}
+	h.init(1, 1000, 100, 100, "", "", &testAPI{})
+	defer h.stop()
+
+	d := decoder.GraphiteBuilder{}.Build()
+	for _, line := range []string{"a.b x source=s", "a.b 1.2.3 source=s", "a.b 1 source=\"s", "a.b 1", "a#b 1 source=s",
+		"a.b 1 env=dev"} {
+		_, err := d.Decode([]byte(line))
+		if err == nil {
+			t.Fatalf("expected %q to be blocked", line)
+		}
+		h.handleBlockedPoint(line, "", err)
+	}
+	h.handleBlockedPoint("a.b", "", ErrLineTooLong)
+
+	for category, expected := range map[string]int64{"invalid_value": 2, "unterminated_quote": 1, "unexpected_end": 1,
+		"invalid_character": 1, "missing_source": 1, "line_too_long": 1} {
+		if count := metrics.GetOrRegisterCounter("points."+t.Name()+".blocked."+category, nil).Count(); count != expected {
+			t.Errorf("expected %d %s points, found %d", expected, category, count)
+		}
+	}
+}
+
 func BenchmarkPointToStringBase(b *testing.B) {
 	p := getPoint(1)
 	h := &DefaultPointHandler{}
@@ -0,0 +1,120 @@
+package points
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/wavefronthq/go-proxy/logging"
+)
+
+const (
+	// length of the longest method in httpMethods
+	httpPeekLength = 5
+)
+
+var (
+	httpMethods = [][]byte{[]byte("POST "), []byte("PUT ")}
+
+	errListenerClosed = errors.New("listener closed")
+)
+
+// isHTTPRequest returns true if the leading bytes of a connection look like an HTTP request.
+func isHTTPRequest(head []byte) bool {
+	for _, method := range httpMethods {
+		if bytes.HasPrefix(head, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// A net.Conn whose leading bytes have already been buffered while detecting the protocol.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// A net.Listener that hands connections accepted by the TCP listener over to an http.Server.
+type connListener struct {
+	addr      net.Addr
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newConnListener(addr net.Addr) *connListener {
+	return &connListener{addr: addr, conns: make(chan net.Conn), closed: make(chan struct{})}
+}
+
+func (cl *connListener) serve(conn net.Conn) {
+	select {
+	case cl.conns <- conn:
+	case <-cl.closed:
+		conn.Close()
+	}
+}
+
+func (cl *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-cl.conns:
+		return conn, nil
+	case <-cl.closed:
+		return nil, errListenerClosed
+	}
+}
+
+func (cl *connListener) Close() error {
+	cl.closeOnce.Do(func() {
+		close(cl.closed)
+	})
+	return nil
+}
+
+func (cl *connListener) Addr() net.Addr {
+	return cl.addr
+}
+
+// Accepts newline delimited points POSTed to any path of a push listener port.
+type httpHandler struct {
+	listener *DefaultPointListener
+}
+
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost && req.Method != http.MethodPut {
+		w.Header().Set("Allow", "POST, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer req.Body.Close()
+
+	encoding := strings.ToLower(strings.TrimSpace(req.Header.Get("Content-Encoding")))
+	body, err := newDecompressor(req.Body, encoding, h.listener.MaxDecompressedSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	defer body.Close()
+
+	blocked, err := h.listener.processLines(body, req.RemoteAddr)
+	switch {
+	case err == ErrDecompressedSizeExceeded:
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case err != nil:
+		logging.Warn("error reading request body", "port", h.listener.Port, "client", req.RemoteAddr, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case blocked > 0:
+		http.Error(w, fmt.Sprintf("%d points blocked", blocked), http.StatusBadRequest)
+	default:
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
@@ -0,0 +1,64 @@
+package points
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wavefronthq/go-proxy/api"
+	"github.com/wavefronthq/go-proxy/points/decoder"
+)
+
+func TestIsHTTPRequest(t *testing.T) {
+	for head, expected := range map[string]bool{
+		"POST /": true,
+		"PUT /":  true,
+		"POSTG":  false,
+		"PUTS ":  false,
+		"GET /":  false,
+	} {
+		if isHTTPRequest([]byte(head)) != expected {
+			t.Errorf("expected %v for %q", expected, head)
+		}
+	}
+}
+
+func TestPlainLinesLikeMethods(t *testing.T) {
+	service := &testAPI{}
+	l := &DefaultPointListener{Builder: decoder.GraphiteBuilder{}}
+	if err := l.Start(1, 1000, 100, 100, api.FormatGraphiteV2, api.GraphiteBlockWorkUnit, service); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("tcp", l.tcpListener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("POSTGRES.connections 1 source=db\n")); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	// the shutdown would otherwise close the connection before it is read
+	for start := time.Now(); l.Status().Received == 0 && time.Since(start) < 5*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	if flushed, dropped := l.Shutdown(deadline, deadline); flushed != 1 || dropped != 0 {
+		t.Fatalf("expected 1 point flushed, found %d flushed and %d dropped", flushed, dropped)
+	}
+	if len(service.posted) != 1 || !strings.HasPrefix(service.posted[0], "\"POSTGRES.connections\" 1 ") {
+		t.Errorf("unexpected points %q", service.posted)
+	}
+}
+
+func TestStopAfterShutdown(t *testing.T) {
+	l := &DefaultPointListener{Builder: decoder.GraphiteBuilder{}}
+	if err := l.Start(1, 1000, 100, 100, api.FormatGraphiteV2, api.GraphiteBlockWorkUnit, &testAPI{}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	l.Shutdown(deadline, deadline)
+	l.Stop()
+}
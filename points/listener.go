@@ -2,55 +2,124 @@ package points
 
 import (
 	"bufio"
+	"context"
 	"fmt"
-	"log"
+	"io"
 	"net"
+	"net/http"
+	"sync"
+	"time"
 
+	"github.com/rcrowley/go-metrics"
 	"github.com/wavefronthq/go-proxy/api"
+	"github.com/wavefronthq/go-proxy/common"
+	"github.com/wavefronthq/go-proxy/logging"
+	"github.com/wavefronthq/go-proxy/points/cumulative"
 	"github.com/wavefronthq/go-proxy/points/decoder"
+	"github.com/wavefronthq/go-proxy/points/parser"
+	"github.com/wavefronthq/go-proxy/points/preprocessor"
 )
 
 // Interface that handles listening for points.
 type PointListener interface {
-	Start(numForwarders, flushInterval, bufferSize, maxFlushSize int, format, workUnitId string, service api.WavefrontAPI)
+	Start(numForwarders, flushInterval, bufferSize, maxFlushSize int, format, workUnitId string, service api.WavefrontAPI) error
+	Update(flushInterval, bufferSize, maxFlushSize int)
 	Stop()
+	Shutdown(connDeadline, flushDeadline time.Time) (flushed, dropped int64)
+	Status() ListenerStatus
+	Tap(filter *TapFilter) *Tap
+	Clients() ClientsStatus
+}
+
+// Point counts and connection state of a listener.
+type ListenerStatus struct {
+	Port              int   `json:"port"`
+	Received          int64 `json:"received"`
+	Sent              int64 `json:"sent"`
+	Blocked           int64 `json:"blocked"`
+	Queued            int64 `json:"queued"`
+	Buffered          int   `json:"buffered"`
+	ActiveConnections int   `json:"activeConnections"`
+	// status code of the most recent post to the Wavefront server, 0 if it failed without a response
+	LastResponseCode int `json:"lastResponseCode"`
+	// forwarders holding points whose posts have been failing or pushed back for over a minute
+	StuckForwarders int `json:"stuckForwarders"`
 }
 
 type DefaultPointListener struct {
-	Port    int
-	Builder decoder.DecoderBuilder
-	handler PointHandler
+	Port                int
+	Builder             decoder.DecoderBuilder
+	MaxLineLength       int
+	MaxDecompressedSize int64
+	Preprocessor        *preprocessor.Preprocessor
+	Counters            *cumulative.Converter
+	// interval over which delta counters are summed per series, 0 reports every delta point
+	DeltaAggregationInterval time.Duration
+	handler                  PointHandler
+	events                   *eventHandler
+	sources                  *sourceHandler
+	deltas                   *deltaAggregator
+	tcpListener              *net.TCPListener
+	httpListener             *connListener
+	httpServer               *http.Server
+	done                     chan struct{}
+	stopOnce                 sync.Once
+	connMtx                  sync.Mutex
+	conns                    map[net.Conn]struct{}
+	connWg                   sync.WaitGroup
+	closing                  bool
+	httpConns                int
+	taps                     tapSet
+	clients                  *clientTracker
+	parseLatency             metrics.Timer
+	lineSize                 metrics.Histogram
 }
 
 func (l *DefaultPointListener) Start(numForwarders, flushInterval, bufferSize, maxFlushSize int,
-	format, workUnitId string, service api.WavefrontAPI) {
+	format, workUnitId string, service api.WavefrontAPI) error {
 
-	log.Printf("Starting listener on port: %d\n", l.Port)
+	logging.Info("starting listener", "port", l.Port)
 
 	if numForwarders <= 0 || numForwarders > maxForwarders {
 		numForwarders = minForwarders
 	}
 
-	if flushInterval < minFlushInterval {
-		flushInterval = minFlushInterval
-	}
-
-	l.handler = &DefaultPointHandler{name: fmt.Sprintf("%d", l.Port)}
-	l.handler.init(numForwarders, flushInterval, bufferSize, maxFlushSize, format, workUnitId, service)
+	flushInterval = clampFlushInterval(flushInterval)
 
 	connStr := fmt.Sprintf(":%d", l.Port)
 	addr, err := net.ResolveTCPAddr("tcp", connStr)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	tcpListener, err := net.ListenTCP("tcp", addr)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	l.tcpListener = tcpListener
+	l.done = make(chan struct{})
+	l.conns = make(map[net.Conn]struct{})
+	l.clients = newClientTracker(l.Port)
+	go l.clients.run(l.done)
+	l.parseLatency = metrics.GetOrRegisterTimer(fmt.Sprintf("points.%d.parse.latency", l.Port), nil)
+	l.lineSize = metrics.GetOrRegisterHistogram(fmt.Sprintf("points.%d.line.size", l.Port), nil,
+		metrics.NewExpDecaySample(1028, 0.015))
+
+	l.handler = &DefaultPointHandler{name: fmt.Sprintf("%d", l.Port)}
+	l.handler.init(numForwarders, flushInterval, bufferSize, maxFlushSize, format, workUnitId, service)
+	l.events = newEventHandler(fmt.Sprintf("%d", l.Port), service)
+	l.sources = newSourceHandler(fmt.Sprintf("%d", l.Port), service)
+	l.deltas = newDeltaAggregator(l.Port, l.handler, l.DeltaAggregationInterval)
+	go l.deltas.run(l.done)
+	go l.Counters.Run(l.done)
+
+	l.httpListener = newConnListener(tcpListener.Addr())
+	l.httpServer = &http.Server{Handler: &httpHandler{listener: l}, ConnState: l.trackHTTPConn}
+	go l.httpServer.Serve(l.httpListener)
 
 	go l.startServer(tcpListener)
-	log.Printf("Configured %d forwarders for %s listener on port: %d\n", numForwarders, format, l.Port)
+	logging.Info("configured listener", "port", l.Port, "format", format, "forwarders", numForwarders)
+	return nil
 }
 
 func (l *DefaultPointListener) startServer(tcpListener *net.TCPListener) {
@@ -58,38 +127,389 @@ func (l *DefaultPointListener) startServer(tcpListener *net.TCPListener) {
 		// Listen for incoming connections
 		conn, err := tcpListener.Accept()
 		if err != nil || conn == nil {
-			log.Printf("%d-listener: error accepting connection: %v\n", l.Port, err.Error())
+			select {
+			case <-l.done:
+				return
+			default:
+			}
+			logging.Warn("error accepting connection", "port", l.Port, "error", err)
 			continue
 		}
 
 		// Handle connections in a new goroutine
-		go l.handleRequest(conn)
+		if l.trackConn(conn) {
+			go l.handleRequest(conn)
+		}
+	}
+}
+
+// trackConn registers an open connection, closing it instead if the listener is shutting down.
+func (l *DefaultPointListener) trackConn(conn net.Conn) bool {
+	l.connMtx.Lock()
+	defer l.connMtx.Unlock()
+	if l.closing {
+		conn.Close()
+		return false
+	}
+	l.conns[conn] = struct{}{}
+	l.connWg.Add(1)
+	return true
+}
+
+// trackHTTPConn counts the open connections handed over to the HTTP server.
+func (l *DefaultPointListener) trackHTTPConn(conn net.Conn, state http.ConnState) {
+	l.connMtx.Lock()
+	defer l.connMtx.Unlock()
+	switch state {
+	case http.StateNew:
+		l.httpConns++
+	case http.StateHijacked, http.StateClosed:
+		l.httpConns--
+	}
+}
+
+func (l *DefaultPointListener) isClosing() bool {
+	l.connMtx.Lock()
+	defer l.connMtx.Unlock()
+	return l.closing
+}
+
+func (l *DefaultPointListener) untrackConn(conn net.Conn) {
+	l.connMtx.Lock()
+	delete(l.conns, conn)
+	l.connMtx.Unlock()
+	l.connWg.Done()
+}
+
+// closeConns closes all open connections, interrupting any pending reads.
+func (l *DefaultPointListener) closeConns() {
+	l.connMtx.Lock()
+	defer l.connMtx.Unlock()
+	for conn := range l.conns {
+		conn.Close()
 	}
 }
 
 // Handles incoming requests.
+// Connections starting with an HTTP request are handed over to the HTTP server, all others are
+// read as a stream of points which may be gzip or zstd compressed.
 func (l *DefaultPointListener) handleRequest(conn net.Conn) {
+	defer l.untrackConn(conn)
+	br := bufio.NewReader(conn)
+	head, _ := br.Peek(httpPeekLength)
+	if isHTTPRequest(head) {
+		// tracked by the HTTP server from here on
+		l.httpListener.serve(&bufferedConn{Conn: conn, r: br})
+		return
+	}
+	defer conn.Close()
+
+	reader, err := newDecompressor(br, detectEncoding(head), l.MaxDecompressedSize)
+	if err != nil {
+		logging.Warn("error reading compressed stream", "port", l.Port, "client", conn.RemoteAddr(), "error", err)
+		return
+	}
+	defer reader.Close()
+
+	if _, err := l.processLines(reader, conn.RemoteAddr().String()); err != nil && !l.isClosing() {
+		logging.Warn("error reading points", "port", l.Port, "client", conn.RemoteAddr(), "error", err)
+	}
+}
+
+// processLines decodes and reports every line read from r, sent by the given client address.
+// Returns the number of blocked lines and the first read error other than io.EOF.
+func (l *DefaultPointListener) processLines(r io.Reader, client string) (int, error) {
 	var pd decoder.PointDecoder = l.Builder.Build()
-	scanner := bufio.NewScanner(conn)
-	for scanner.Scan() {
-		pointBytes := scanner.Bytes()
+	var ed *decoder.EventDecoder
+	var sd *decoder.SourceDecoder
+	reader := newLineReader(r, l.MaxLineLength)
+	conn := l.clients.open(client)
+	defer l.clients.close(conn)
+	blocked := 0
+	for {
+		pointBytes, err := reader.readLine()
+		if err == ErrLineTooLong {
+			blocked++
+			conn.line(reader.maxLen)
+			conn.block()
+			l.blockPoint(string(pointBytes), client, nil, err)
+			continue
+		}
+		if err == io.EOF {
+			return blocked, nil
+		}
+		if err != nil {
+			return blocked, err
+		}
+		conn.line(len(pointBytes))
+		l.lineSize.Update(int64(len(pointBytes)))
+
+		// events and source metadata skip the point pipeline
+		if parser.IsEvent(pointBytes) {
+			if ed == nil {
+				ed = decoder.NewEventDecoder()
+			}
+			if !l.processEvent(ed, pointBytes, client) {
+				blocked++
+				conn.block()
+			}
+			continue
+		}
+		if parser.IsSourceOperation(pointBytes) {
+			if sd == nil {
+				sd = decoder.NewSourceDecoder()
+			}
+			if !l.processSource(sd, pointBytes, client) {
+				blocked++
+				conn.block()
+			}
+			continue
+		}
+
+		// the original line and point are only kept while a tap is attached
+		tapped := l.taps.active()
+		var line, decoded string
+		if tapped {
+			line = string(pointBytes)
+		}
+
+		if l.Preprocessor.HasPointLineRules() {
+			pointLine, err := l.Preprocessor.ForPointLine(string(pointBytes))
+			if err != nil {
+				blocked++
+				conn.block()
+				l.blockPoint(pointLine, client, nil, err)
+				continue
+			}
+			pointBytes = []byte(pointLine)
+		}
+
+		parseStart := time.Now()
 		point, err := pd.Decode(pointBytes)
+		l.parseLatency.UpdateSince(parseStart)
 		if err != nil {
-			log.Println("Error decoding point", err)
-			l.handler.handleBlockedPoint(string(pointBytes))
+			blocked++
+			conn.block()
+			l.blockPoint(string(pointBytes), client, nil, err)
 			continue
 		}
-		l.handler.reportPoint(point)
+		if tapped {
+			decoded = formatTapPoint(point)
+		}
+		if l.Preprocessor.HasPointRules() {
+			// the rules may rename or add tags, so the result is validated again
+			err := l.Preprocessor.ForPoint(point)
+			if err == nil {
+				err = pd.Validate(point)
+			}
+			if err != nil {
+				blocked++
+				conn.block()
+				l.blockPoint(string(pointBytes), client, point, err)
+				continue
+			}
+		}
+		derived, forward := l.Counters.Convert(point)
+		if derived != nil {
+			l.reportDerived(pd, derived, string(pointBytes), client)
+		}
+		if forward {
+			if err := l.reportPoint(point); err != nil {
+				blocked++
+				conn.block()
+				l.blockPoint(string(pointBytes), client, point, err)
+				continue
+			}
+		}
+
+		if tapped {
+			event := TapEvent{Port: l.Port, Client: client, Status: TapAccepted, Line: line, Point: formatTapPoint(point)}
+			if event.Point != decoded || string(pointBytes) != line {
+				event.Status = TapRewritten
+			}
+			l.taps.publish(event, point)
+		}
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		log.Printf("%d-listener: error during scan: %v\n", l.Port, err)
+// processEvent decodes and reports an event line. Returns false if the event was blocked.
+func (l *DefaultPointListener) processEvent(ed *decoder.EventDecoder, line []byte, client string) bool {
+	event, err := ed.Decode(line)
+	if err != nil {
+		l.events.handleBlockedEvent(string(line), client, err)
+	} else {
+		l.events.reportEvent(event)
+	}
+	l.tapCommand(line, client, err)
+	return err == nil
+}
+
+// processSource decodes and reports a source tag or description line. Returns false if the line was
+// blocked.
+func (l *DefaultPointListener) processSource(sd *decoder.SourceDecoder, line []byte, client string) bool {
+	op, err := sd.Decode(line)
+	if err != nil {
+		l.sources.handleBlockedSource(string(line), client, err)
+	} else {
+		l.sources.reportSource(op)
+	}
+	l.tapCommand(line, client, err)
+	return err == nil
+}
+
+// tapCommand publishes an event or source line, blocked if err is not nil, to the attached taps.
+func (l *DefaultPointListener) tapCommand(line []byte, client string, err error) {
+	if !l.taps.active() {
+		return
+	}
+	tapEvent := TapEvent{Port: l.Port, Client: client, Status: TapAccepted, Line: string(line)}
+	if err != nil {
+		tapEvent.Status = TapBlocked
+		tapEvent.Reason = err.Error()
+	}
+	l.taps.publish(tapEvent, nil)
+}
+
+// reportPoint sends a point to the handler, or to the delta aggregator if it is a delta counter.
+func (l *DefaultPointListener) reportPoint(point *common.Point) error {
+	if common.HasDeltaPrefix(point.Name) {
+		return l.deltas.add(point)
+	}
+	l.handler.reportPoint(point)
+	return nil
+}
+
+// reportDerived validates and reports a point derived from a cumulative counter on the line. The
+// suffix may make the name invalid, such as too long, which only blocks the derived point.
+func (l *DefaultPointListener) reportDerived(pd decoder.PointDecoder, derived *common.Point, line, client string) {
+	err := pd.Validate(derived)
+	if err == nil {
+		err = l.reportPoint(derived)
+	}
+	if err != nil {
+		l.blockPoint(line, client, derived, err)
+		return
+	}
+	if l.taps.active() {
+		event := TapEvent{Port: l.Port, Client: client, Status: TapDerived, Line: line, Point: formatTapPoint(derived)}
+		l.taps.publish(event, derived)
 	}
-	conn.Close()
 }
 
+// blockPoint reports a blocked line to the handler and the attached taps. point is nil if the line
+// could not be decoded.
+func (l *DefaultPointListener) blockPoint(line, client string, point *common.Point, reason error) {
+	l.handler.handleBlockedPoint(line, client, reason)
+	if l.taps.active() {
+		l.taps.publish(TapEvent{Port: l.Port, Client: client, Status: TapBlocked, Reason: reason.Error(), Line: line}, point)
+	}
+}
+
+// Tap attaches a stream of the point lines matching filter, until the tap or the listener is closed.
+func (l *DefaultPointListener) Tap(filter *TapFilter) *Tap {
+	return l.taps.add(filter)
+}
+
+// Update changes the flush interval and buffer limits of a running listener.
+func (l *DefaultPointListener) Update(flushInterval, bufferSize, maxFlushSize int) {
+	logging.Info("updating listener", "port", l.Port)
+	l.handler.update(clampFlushInterval(flushInterval), bufferSize, maxFlushSize)
+}
+
+// Status returns the point counts and connection state of the listener.
+func (l *DefaultPointListener) Status() ListenerStatus {
+	s := ListenerStatus{Port: l.Port}
+	l.connMtx.Lock()
+	s.ActiveConnections = len(l.conns) + l.httpConns
+	l.connMtx.Unlock()
+	l.handler.status(&s)
+	return s
+}
+
+// Clients returns the ingestion statistics of the listener's clients and open connections.
+func (l *DefaultPointListener) Clients() ClientsStatus {
+	return l.clients.status()
+}
+
+// Stop closes the listener and its open connections immediately, discarding buffered points.
 func (l *DefaultPointListener) Stop() {
-	//TODO: gracefully shutdown TCP listener
-	log.Println("Stopping listener", l.Port)
+	logging.Info("stopping listener", "port", l.Port)
+	l.stopAccepting()
+	l.httpServer.Close()
+	l.closeConns()
 	l.handler.stop()
+	l.events.stop()
+	l.sources.stop()
+}
+
+// Shutdown stops accepting connections and waits until connDeadline for open connections to finish,
+// closing the remaining ones after that. The buffered points are then flushed until flushDeadline.
+// Returns the number of points flushed and the number dropped.
+func (l *DefaultPointListener) Shutdown(connDeadline, flushDeadline time.Time) (flushed, dropped int64) {
+	logging.Info("shutting down listener", "port", l.Port)
+	l.stopAccepting()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ctx, cancel := context.WithDeadline(context.Background(), connDeadline)
+		defer cancel()
+		if err := l.httpServer.Shutdown(ctx); err != nil {
+			logging.Warn("closing open HTTP connections", "port", l.Port, "error", err)
+			l.httpServer.Close()
+		}
+	}()
+
+	closed := make(chan struct{})
+	go func() {
+		l.connWg.Wait()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Until(connDeadline)):
+		logging.Warn("closing open connections after grace period", "port", l.Port)
+		l.closeConns()
+		<-closed
+	}
+	wg.Wait()
+
+	l.deltas.flush()
+	var drainWg sync.WaitGroup
+	drainWg.Add(2)
+	go func() {
+		defer drainWg.Done()
+		sent, dropped := l.events.drain(flushDeadline)
+		logging.Info("events flushed", "port", l.Port, "flushed", sent, "dropped", dropped)
+	}()
+	go func() {
+		defer drainWg.Done()
+		sent, dropped := l.sources.drain(flushDeadline)
+		logging.Info("source operations flushed", "port", l.Port, "flushed", sent, "dropped", dropped)
+	}()
+	flushed, dropped = l.handler.drain(flushDeadline)
+	drainWg.Wait()
+	logging.Info("listener shut down", "port", l.Port, "flushed", flushed, "dropped", dropped)
+	return flushed, dropped
+}
+
+// stopAccepting closes the listening sockets, Stop may follow Shutdown.
+func (l *DefaultPointListener) stopAccepting() {
+	l.stopOnce.Do(func() {
+		l.connMtx.Lock()
+		l.closing = true
+		l.connMtx.Unlock()
+		close(l.done)
+		l.tcpListener.Close()
+		l.httpListener.Close()
+		l.taps.closeAll()
+	})
+}
+
+func clampFlushInterval(flushInterval int) int {
+	if flushInterval < minFlushInterval {
+		return minFlushInterval
+	}
+	return flushInterval
 }
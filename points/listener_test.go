@@ -0,0 +1,90 @@
+package points
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/wavefronthq/go-proxy/points/cumulative"
+	"github.com/wavefronthq/go-proxy/points/decoder"
+	"github.com/wavefronthq/go-proxy/points/preprocessor"
+)
+
+func TestPreprocessedPointsValidated(t *testing.T) {
+	pp, err := preprocessor.New(t.Name(), []preprocessor.RuleConfig{
+		{Rule: "add-bad", Action: "addTag", Tag: "bad key", Value: "x"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newTestListener(pp)
+	defer l.handler.stop()
+	if blocked, _ := l.processLines(strings.NewReader("a.b 1 source=x\n"), "client"); blocked != 1 {
+		t.Errorf("expected the rewritten point to be blocked, found %d blocked", blocked)
+	}
+
+	// a sanitizing policy fixes the rewritten point instead
+	cfg := decoder.DefaultPolicyConfig()
+	cfg.Action = decoder.ActionSanitize
+	policy, err := decoder.NewValidationPolicy(t.Name(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Builder = decoder.WithPolicy(decoder.GraphiteBuilder{}, policy)
+	tap := l.Tap(&TapFilter{})
+	if blocked, _ := l.processLines(strings.NewReader("a.b 1 1533529977 source=x\n"), "client"); blocked != 0 {
+		t.Errorf("expected the rewritten point to be sanitized, found %d blocked", blocked)
+	}
+	tap.Close()
+	event := <-tap.Events()
+	if event.Point != `"a.b" 1 1533529977 source="x" "bad_key"="x"` {
+		t.Errorf("unexpected point %s", event.Point)
+	}
+}
+
+func TestDerivedPoints(t *testing.T) {
+	converter, err := cumulative.New(t.Name(), []cumulative.RuleConfig{
+		{Rule: "octets", Match: "octets", Output: cumulative.OutputDelta},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newTestListener(nil)
+	defer l.handler.stop()
+	l.Counters = converter
+	received := l.deltas.received.Count()
+
+	tap := l.Tap(&TapFilter{})
+	l.processLines(strings.NewReader("octets 900 1533529977 source=x\noctets 950 1533529987 source=x\n"), "client")
+	tap.Close()
+	if event := findTapEvent(tap, TapDerived); event.Point != `"∆octets.delta" 50 1533529987 source="x"` {
+		t.Errorf("expected the derived delta point, found %+v", event)
+	}
+	if count := l.deltas.received.Count() - received; count != 1 {
+		t.Errorf("expected the derived point to be aggregated as a delta counter, found %d", count)
+	}
+
+	// the suffix makes the derived name too long
+	cfg := decoder.DefaultPolicyConfig()
+	cfg.MaxNameLength = 10
+	policy, err := decoder.NewValidationPolicy(t.Name(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Builder = decoder.WithPolicy(decoder.GraphiteBuilder{}, policy)
+	tap = l.Tap(&TapFilter{})
+	l.processLines(strings.NewReader("octets 1000 1533529997 source=x\n"), "client")
+	tap.Close()
+	if event := findTapEvent(tap, TapBlocked); event.Line != "octets 1000 1533529997 source=x" {
+		t.Errorf("expected the derived point to be blocked, found %+v", event)
+	}
+}
+
+// findTapEvent returns the first event of a closed tap with the given status.
+func findTapEvent(tap *Tap, status string) TapEvent {
+	for event := range tap.Events() {
+		if event.Status == status {
+			return event
+		}
+	}
+	return TapEvent{}
+}
@@ -3,6 +3,7 @@ package parser
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 var (
 	ErrEOF              = errors.New("EOF")
 	ErrInvalidTimestamp = errors.New("Invalid timestamp")
+	ErrInvalidUTF8      = errors.New("Invalid UTF-8 sequence")
 )
 
 // Interface for parsing line elements.
@@ -29,6 +31,8 @@ type TagParser struct{}
 type LoopedParser struct {
 	wrappedParser ElementParser
 	wsPaser       *WhiteSpaceParser
+	// the line may end before the first element
+	optional bool
 }
 type LiteralParser struct {
 	literal string
@@ -37,68 +41,122 @@ type LiteralParser struct {
 func (ep *NameParser) parse(p *PointParser, pt *common.Point) error {
 	//Valid characters are: a-z, A-Z, 0-9, hyphen ("-"), underscore ("_"), dot (".").
 	// Forward slash ("/") and comma (",") are allowed if metricName is enclosed in double quotes.
-	name, err := parseLiteral(p)
+	// Unicode letters and digits are scanned too, the validation policy decides whether they are allowed.
+	// Delta counter names have a leading "∆" or "Δ".
+	start := p.mark()
+	if tok, prefix := p.scan(); tok == EOF || len(prefix) == 1 || !common.HasDeltaPrefix(string(prefix)) {
+		p.rewind(start)
+	}
+	prefixEnd := p.mark()
+	name, err := scanLiteral(p)
 	if err != nil {
-		return err
+		if pe, ok := err.(*ParseError); ok && pe.Category == CategoryUnexpectedEnd {
+			pe.Expected = "metric name"
+		}
+		return inElement(ElementName, err)
+	}
+	if name.start == name.end {
+		_, found := p.scan()
+		return &ParseError{Offset: p.last, Element: ElementName, Expected: "metric name", Found: string(found),
+			Category: CategoryUnexpectedToken}
+	}
+	switch {
+	case prefixEnd == start:
+		pt.Name = p.text(name)
+	case p.s.b[prefixEnd] == '"':
+		pt.Name = p.text(span{start, prefixEnd}) + p.text(name)
+	default:
+		// the prefix and an unquoted name are contiguous
+		pt.Name = p.text(p.since(start))
+		name.start = prefixEnd
+	}
+	if p.locating {
+		p.spans = append(p.spans, Span{Element: ElementName, Start: name.start, End: name.end})
 	}
-	pt.Name = name
 	return nil
 }
 
 func (ep *ValueParser) parse(p *PointParser, pt *common.Point) error {
+	start := p.mark()
 	tok, lit := p.scan()
 	if tok == EOF {
-		return fmt.Errorf("found %q, expected number", lit)
+		return &ParseError{Offset: p.last, Element: ElementValue, Expected: "number", Category: CategoryUnexpectedEnd}
+	} else if tok == INVALID_UTF8 {
+		return inElement(ElementValue, p.invalidUTF8(lit))
 	}
 
-	p.writeBuf.Reset()
 	if tok == MINUS_SIGN {
-		p.writeBuf.WriteString(lit)
-		tok, lit = p.scan()
+		tok, _ = p.scan()
 	}
-
 	for tok != EOF && (tok == LETTER || tok == NUMBER || tok == DOT ||
 		tok == MINUS_SIGN) {
-		p.writeBuf.WriteString(lit)
-		tok, lit = p.scan()
+		p.s.skip(valueBytes)
+		tok, _ = p.scan()
 	}
 	p.unscan()
 
-	pt.Value = p.writeBuf.String()
+	pt.Value = p.text(p.since(start))
 	_, err := strconv.ParseFloat(pt.Value, 64)
 	if err != nil {
-		return fmt.Errorf("invalid metric value %s", pt.Value)
+		found := pt.Value
+		if found == "" {
+			// not even the start of a number
+			_, lit = p.scan()
+			found = string(lit)
+		}
+		return &ParseError{Offset: start, Element: ElementValue, Expected: "number", Found: found,
+			Category: CategoryInvalidValue, Err: err}
 	}
 	return nil
 }
 
 func (ep *TimestampParser) parse(p *PointParser, pt *common.Point) error {
+	start := p.mark()
 	tok, lit := p.scan()
 	if tok == EOF {
-		return fmt.Errorf("found %q, expected number", lit)
+		return &ParseError{Offset: p.last, Element: ElementTimestamp, Expected: "timestamp", Category: CategoryUnexpectedEnd}
+	} else if tok == INVALID_UTF8 {
+		return inElement(ElementTimestamp, p.invalidUTF8(lit))
 	}
 
 	if tok != NUMBER {
 		if ep.optional {
-			p.unscanTokens(2)
+			p.rewind(start)
 			return setTimestamp(pt, 0, 1)
 		}
-		return ErrInvalidTimestamp
+		return &ParseError{Offset: start, Element: ElementTimestamp, Expected: "timestamp", Found: string(lit),
+			Category: CategoryInvalidTimestamp, Err: ErrInvalidTimestamp}
 	}
 
-	p.writeBuf.Reset()
 	for tok != EOF && tok == NUMBER {
-		p.writeBuf.WriteString(lit)
-		tok, lit = p.scan()
+		p.s.skip(digitBytes)
+		tok, _ = p.scan()
 	}
 	p.unscan()
 
-	tsStr := p.writeBuf.String()
-	ts, err := strconv.ParseInt(tsStr, 10, 64)
+	digits := p.bytes(p.since(start))
+	ts, err := parseDigits(digits)
+	if err == nil {
+		err = setTimestamp(pt, ts, len(digits))
+	}
 	if err != nil {
-		return err
+		return &ParseError{Offset: start, Element: ElementTimestamp, Expected: "timestamp in seconds, milliseconds, microseconds or nanoseconds",
+			Found: string(digits), Category: CategoryInvalidTimestamp, Err: err}
+	}
+	return nil
+}
+
+// parseDigits parses a run of ASCII digits like strconv.ParseInt, without copying them to a string.
+func parseDigits(b []byte) (int64, error) {
+	var n int64
+	for _, ch := range b {
+		d := int64(ch - '0')
+		if n > (math.MaxInt64-d)/10 {
+			return 0, &strconv.NumError{Func: "ParseInt", Num: string(b), Err: strconv.ErrRange}
+		}
+		n = n*10 + d
 	}
-	return setTimestamp(pt, ts, len(tsStr))
+	return n, nil
 }
 
 func setTimestamp(pt *common.Point, ts int64, numDigits int) error {
@@ -124,10 +182,14 @@ func setTimestamp(pt *common.Point, ts int64, numDigits int) error {
 	return nil
 }
 
+// The elements of a LoopedParser are numbered from 1 in its errors, such as tag 2.
 func (ep *LoopedParser) parse(p *PointParser, pt *common.Point) error {
-	for {
+	for n := 1; ; n++ {
 		err := ep.wrappedParser.parse(p, pt)
 		if err != nil {
+			if pe, ok := err.(*ParseError); ok {
+				pe.Element = fmt.Sprintf("%s %d", pe.Element, n)
+			}
 			return err
 		}
 		err = ep.wsPaser.parse(p, pt)
@@ -139,92 +201,120 @@ func (ep *LoopedParser) parse(p *PointParser, pt *common.Point) error {
 }
 
 func (ep *TagParser) parse(p *PointParser, pt *common.Point) error {
-	k, err := parseLiteral(p)
+	k, err := scanLiteral(p)
 	if err != nil {
-		if k == "" {
+		// other key errors have always been ignored
+		if pe, ok := err.(*ParseError); ok && pe.Category != CategoryInvalidUTF8 && pe.Category != CategoryInvalidCharacter {
 			return nil
 		}
-		return err
+		return inElement(ElementTag, err)
 	}
 
 	next, lit := p.scan()
 	if next != EQUALS {
-		return fmt.Errorf("found %q, expected equals", lit)
+		category := CategoryUnexpectedToken
+		if next == EOF {
+			category = CategoryUnexpectedEnd
+		}
+		return &ParseError{Offset: p.last, Element: ElementTag, Expected: `"="`, Found: string(lit), Category: category}
 	}
 
-	v, err := parseLiteral(p)
+	v, err := scanLiteral(p)
 	if err != nil {
-		return err
+		return inElement(ElementTag, err)
 	}
 	if len(pt.Tags) == 0 {
 		pt.Tags = make(map[string]string)
 	}
-	pt.Tags[k] = v
+	key := p.text(k)
+	pt.Tags[key] = p.text(v)
+	if p.locating {
+		p.spans = append(p.spans, Span{Element: ElementTag, Key: key, Start: k.start, End: k.end,
+			ValueStart: v.start, ValueEnd: v.end})
+	}
 	return nil
 }
 
 func (ep *WhiteSpaceParser) parse(p *PointParser, pt *common.Point) error {
-	tok := WS
-	for tok != EOF && tok == WS {
-		tok, _ = p.scan()
-	}
-
-	if tok == EOF {
+	p.s.skip(spaceBytes)
+	if p.s.atEOF() {
 		return ErrEOF
 	}
-	p.unscan()
 	return nil
 }
 
 func (ep *LiteralParser) parse(p *PointParser, pt *common.Point) error {
-	l, err := parseLiteral(p)
+	l, err := scanLiteral(p)
 	if err != nil {
-		return err
+		return inElement(ElementLiteral, err)
 	}
 
-	if l != ep.literal {
-		return fmt.Errorf("found %s, expected %s", l, ep.literal)
+	if lit := p.bytes(l); string(lit) != ep.literal {
+		return &ParseError{Offset: l.start, Element: ElementLiteral, Expected: strconv.Quote(ep.literal),
+			Found: string(lit), Category: CategoryUnexpectedToken}
 	}
 	return nil
 }
 
-func parseQuotedLiteral(p *PointParser) (string, error) {
-	p.writeBuf.Reset()
-
+// scanQuotedLiteral returns the span up to the closing quotes, escape sequences included.
+func scanQuotedLiteral(p *PointParser) (span, error) {
+	quote := p.last
+	start := p.mark()
 	escaped := false
 	tok, lit := p.scan()
 	for tok != EOF && (tok != QUOTES || (tok == QUOTES && escaped)) {
-		// let everything through
+		// let everything through but invalid UTF-8
+		if tok == INVALID_UTF8 {
+			return span{}, p.invalidUTF8(lit)
+		}
 		escaped = tok == BACKSLASH
-		p.writeBuf.WriteString(lit)
+		if !escaped {
+			p.s.skip(quotedBytes)
+		}
 		tok, lit = p.scan()
 	}
 	if tok == EOF {
-		return "", fmt.Errorf("found %q, expected quotes", lit)
+		// the opening quotes are the problem
+		return span{}, &ParseError{Offset: quote, Expected: "closing quotes", Category: CategoryUnterminatedQuote}
 	}
-	return p.writeBuf.String(), nil
+	return span{start, p.last}, nil
 }
 
-func parseLiteral(p *PointParser) (string, error) {
+// scanLiteral returns the span of a quoted or unquoted literal, which is empty if the next token
+// cannot start a literal.
+func scanLiteral(p *PointParser) (span, error) {
+	start := p.mark()
 	tok, lit := p.scan()
 	if tok == EOF {
-		return "", fmt.Errorf("found %q, expected literal", lit)
+		return span{}, p.errorAt(CategoryUnexpectedEnd, "literal", nil)
 	}
 
 	if tok == QUOTES {
-		return parseQuotedLiteral(p)
+		return scanQuotedLiteral(p)
 	}
 
-	p.writeBuf.Reset()
 	for tok != EOF && tok > literal_beg && tok < literal_end {
-		p.writeBuf.WriteString(lit)
+		p.s.skip(literalBytes)
 		tok, lit = p.scan()
 	}
 	if tok == QUOTES {
-		return "", errors.New("found quote inside unquoted literal")
+		return span{}, p.errorAt(CategoryUnexpectedToken, "no quotes inside an unquoted literal", lit)
+	} else if tok == ILLEGAL {
+		return span{}, p.errorAt(CategoryInvalidCharacter, `letters, digits, "-", "_", "." or quotes`, lit)
+	} else if tok == INVALID_UTF8 {
+		return span{}, p.invalidUTF8(lit)
 	}
 	p.unscan()
-	return p.writeBuf.String(), nil
+	return p.since(start), nil
+}
+
+// parseLiteral returns a quoted or unquoted literal as a string.
+func parseLiteral(p *PointParser) (string, error) {
+	lit, err := scanLiteral(p)
+	if err != nil {
+		return "", err
+	}
+	return p.text(lit), nil
 }
 
 func getCurrentTime() int64 {
@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Category of a parse error. Categories are stable, they name the blocked point counters.
+type ErrorCategory string
+
+const (
+	// the line ended before an element
+	CategoryUnexpectedEnd ErrorCategory = "unexpected_end"
+	// such as a missing "=" or a quote inside an unquoted literal
+	CategoryUnexpectedToken   ErrorCategory = "unexpected_token"
+	CategoryUnterminatedQuote ErrorCategory = "unterminated_quote"
+	CategoryInvalidValue      ErrorCategory = "invalid_value"
+	CategoryInvalidTimestamp  ErrorCategory = "invalid_timestamp"
+	CategoryInvalidUTF8       ErrorCategory = "invalid_utf8"
+	// a character not allowed in a name, source or tag, found by validation
+	CategoryInvalidCharacter ErrorCategory = "invalid_character"
+)
+
+// Element names used in errors, tags are numbered from 1.
+const (
+	ElementName      = "name"
+	ElementValue     = "value"
+	ElementTimestamp = "timestamp"
+	ElementTag       = "tag"
+	ElementSource    = "source"
+	ElementLiteral   = "literal"
+)
+
+// Error locating a problem in a line.
+type ParseError struct {
+	// byte offset of the problem in the line
+	Offset int
+	// the element which failed, such as name, value, timestamp or tag 2
+	Element  string
+	Expected string
+	// text of the token found, empty at the end of the line
+	Found    string
+	Category ErrorCategory
+	// underlying error, such as ErrInvalidUTF8
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	found := "end of line"
+	if e.Found != "" {
+		found = strconv.Quote(e.Found)
+	}
+	element := e.Element
+	if element == "" {
+		element = "line"
+	}
+	return fmt.Sprintf("Invalid %s at offset %d: found %s, expected %s", element, e.Offset, found, e.Expected)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Summary leaves out the offset, the found token and the tag number, so blocked points are
+// summarized by category and element.
+func (e *ParseError) Summary() string {
+	element := e.Element
+	if strings.HasPrefix(element, ElementTag+" ") {
+		element = ElementTag
+	}
+	return fmt.Sprintf("%s in %s, expected %s", e.Category, element, e.Expected)
+}
+
+// Position returns the offset, used to mark the problem in the blocked points log.
+func (e *ParseError) Position() int {
+	return e.Offset
+}
+
+// errorAt returns a parse error at the offset of the last scanned token, found at the end of the line
+// if it is EOF.
+func (p *PointParser) errorAt(category ErrorCategory, expected string, found []byte) *ParseError {
+	return &ParseError{Offset: p.last, Expected: expected, Found: string(found), Category: category}
+}
+
+// invalidUTF8 returns the error for the invalid UTF-8 sequence at the last scanned token.
+func (p *PointParser) invalidUTF8(found []byte) *ParseError {
+	err := p.errorAt(CategoryInvalidUTF8, "valid UTF-8", found)
+	err.Err = ErrInvalidUTF8
+	return err
+}
+
+// inElement sets the element of a parse error which does not have one yet.
+func inElement(element string, err error) error {
+	if pe, ok := err.(*ParseError); ok && pe.Element == "" {
+		pe.Element = element
+	}
+	return err
+}
+
+// endOfLine returns the error for a line which ended before an expected element.
+func (p *PointParser) endOfLine(expected string) *ParseError {
+	err := p.errorAt(CategoryUnexpectedEnd, expected, nil)
+	err.Offset = p.mark()
+	return err
+}
+
+// shiftOffset moves the offset of a parse error by n bytes, for parsers which skip a prefix of the line.
+func shiftOffset(err error, n int) error {
+	if pe, ok := err.(*ParseError); ok {
+		pe.Offset += n
+	}
+	return err
+}
@@ -0,0 +1,140 @@
+package parser
+
+import (
+	"errors"
+
+	"github.com/wavefronthq/go-proxy/common"
+)
+
+const (
+	// leading literal of event lines
+	EventLiteral = "@Event"
+
+	hostAnnotation = "host"
+	tagAnnotation  = "tag"
+)
+
+var ErrNotEvent = errors.New("expected @Event")
+
+// Parses event lines in the Wavefront format:
+// @Event <startMillis> [<endMillis>] <name> [<annotation>=<value> ...]
+// The host and tag annotations may be repeated and are collected into the hosts and tags of the
+// event, other annotations given more than once become dimensions.
+type EventParser struct {
+	p PointParser
+}
+
+func NewEventParser() *EventParser {
+	return &EventParser{}
+}
+
+// IsEvent returns true if a line is an event line.
+func IsEvent(b []byte) bool {
+	return hasLiteral(b, EventLiteral)
+}
+
+// Parse parses one entire event line. An event without an end time is instantaneous and ends one
+// millisecond after it starts.
+func (ep *EventParser) Parse(b []byte) (*common.Event, error) {
+	if !IsEvent(b) {
+		return nil, ErrNotEvent
+	}
+	p := &ep.p
+	p.reset(b[len(EventLiteral):])
+	event, err := parseEvent(p)
+	return event, shiftOffset(err, len(EventLiteral))
+}
+
+// parseEvent parses an event after its literal.
+func parseEvent(p *PointParser) (*common.Event, error) {
+	ws := &WhiteSpaceParser{}
+	event := &common.Event{Annotations: make(map[string]string)}
+
+	if err := ws.parse(p, nil); err != nil {
+		return nil, inElement(ElementTimestamp, p.endOfLine("start time"))
+	}
+	start, err := parseMillis(p)
+	if err != nil {
+		return nil, inElement(ElementTimestamp, err)
+	}
+	event.StartTime, event.EndTime = start, start+1
+	if err := ws.parse(p, nil); err != nil {
+		return nil, inElement(ElementName, p.endOfLine("event name"))
+	}
+	if tok, _ := p.scan(); tok == NUMBER {
+		p.unscan()
+		if event.EndTime, err = parseMillis(p); err != nil {
+			return nil, inElement(ElementTimestamp, err)
+		}
+		if err := ws.parse(p, nil); err != nil {
+			return nil, inElement(ElementName, p.endOfLine("event name"))
+		}
+	} else {
+		p.unscan()
+	}
+
+	if event.Name, err = parseLiteral(p); err != nil {
+		return nil, inElement(ElementName, err)
+	}
+	for ws.parse(p, nil) != ErrEOF {
+		k, err := parseLiteral(p)
+		if err != nil {
+			return nil, inElement(ElementTag, err)
+		}
+		if tok, lit := p.scan(); tok != EQUALS {
+			category := CategoryUnexpectedToken
+			if tok == EOF {
+				category = CategoryUnexpectedEnd
+			}
+			return nil, inElement(ElementTag, p.errorAt(category, `"="`, lit))
+		}
+		v, err := parseLiteral(p)
+		if err != nil {
+			return nil, inElement(ElementTag, err)
+		}
+		addAnnotation(event, k, v)
+	}
+	return event, nil
+}
+
+// parseMillis parses an epoch millisecond timestamp.
+func parseMillis(p *PointParser) (int64, error) {
+	start := p.mark()
+	tok, lit := p.scan()
+	for tok == NUMBER {
+		tok, lit = p.scan()
+	}
+	p.unscan()
+	if p.mark() == start {
+		err := p.errorAt(CategoryInvalidTimestamp, "timestamp in milliseconds", lit)
+		err.Err = ErrInvalidTimestamp
+		return 0, err
+	}
+	ms, err := parseDigits(p.bytes(p.since(start)))
+	if err != nil {
+		return 0, &ParseError{Offset: start, Element: ElementTimestamp, Expected: "timestamp in milliseconds",
+			Found: string(p.bytes(p.since(start))), Category: CategoryInvalidTimestamp, Err: err}
+	}
+	return ms, nil
+}
+
+func addAnnotation(event *common.Event, k, v string) {
+	switch k {
+	case hostAnnotation:
+		event.Hosts = append(event.Hosts, v)
+	case tagAnnotation:
+		event.Tags = append(event.Tags, v)
+	default:
+		if values, ok := event.Dimensions[k]; ok {
+			event.Dimensions[k] = append(values, v)
+		} else if first, ok := event.Annotations[k]; ok {
+			delete(event.Annotations, k)
+			if event.Dimensions == nil {
+				event.Dimensions = make(map[string][]string)
+			}
+			event.Dimensions[k] = []string{first, v}
+		} else {
+			event.Annotations[k] = v
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEvent(t *testing.T) {
+	ep := NewEventParser()
+	event, err := ep.Parse([]byte(`@Event 1569423200123 1569423260123 "Deploy web" severity=INFO type="deployment" ` +
+		`details="v1.2 to v1.3" host=app1 host=app2 tag=web tag=prod env=dev env=staging`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Name != "Deploy web" || event.StartTime != 1569423200123 || event.EndTime != 1569423260123 {
+		t.Errorf("unexpected event %+v", event)
+	}
+	annotations := map[string]string{"severity": "INFO", "type": "deployment", "details": "v1.2 to v1.3"}
+	if !reflect.DeepEqual(event.Annotations, annotations) {
+		t.Errorf("unexpected annotations %v", event.Annotations)
+	}
+	if !reflect.DeepEqual(event.Hosts, []string{"app1", "app2"}) || !reflect.DeepEqual(event.Tags, []string{"web", "prod"}) {
+		t.Errorf("unexpected hosts %v and tags %v", event.Hosts, event.Tags)
+	}
+	if !reflect.DeepEqual(event.Dimensions, map[string][]string{"env": {"dev", "staging"}}) {
+		t.Errorf("unexpected dimensions %v", event.Dimensions)
+	}
+
+	event, err = ep.Parse([]byte("@Event 1569423200123 restart"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Name != "restart" || event.EndTime != event.StartTime+1 || len(event.Annotations) != 0 {
+		t.Errorf("expected an instantaneous event, found %+v", event)
+	}
+}
+
+func TestInvalidEvents(t *testing.T) {
+	ep := NewEventParser()
+	for _, line := range []string{
+		"@Event",
+		"@Event ",
+		"@Event 1569423200123",
+		"@Event name",
+		"@Event 1569423200123 name severity",
+		"@Event 1569423200123 name severity=",
+		"@Event 1569423200123 \"name",
+		"@Events 1569423200123 name",
+		"foo.metric 1 source=a",
+	} {
+		if event, err := ep.Parse([]byte(line)); err == nil {
+			t.Errorf("expected an error for %q, found %+v", line, event)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
@@ -45,6 +46,16 @@ var validPoints = [...]string{
 
 	// escaped quotes
 	"foo.metric 1.5 source=foo-linux env=\"de\\\"v\"",
+
+	// delta counters
+	"∆foo.metric 1 source=foo-linux",
+	"Δfoo.metric 1 source=foo-linux",
+	"\"∆foo.metric\" 1 source=foo-linux",
+
+	// unicode
+	"foo.metric 1.5 source=foo-linux region=zürich",
+	"foo.metric 1.5 source=foo-linux city=東京 name=Ελλάδα",
+	"foo.metric 1.5 source=foo-linux status=\"ok ✓\"",
 }
 
 var invalidPoints = [...]string{
@@ -96,6 +107,32 @@ func validateSource(point *common.Point) error {
 	return nil
 }
 
+func TestUnicodePoints(t *testing.T) {
+	pt, err := parsePoint("foo.metric 1.5 source=foo-linux region=zürich env=dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pt.Tags["region"] != "zürich" || pt.Tags["env"] != "dev" {
+		t.Errorf("unexpected tags %v", pt.Tags)
+	}
+
+	for _, pointLine := range []string{
+		"foo.metric 1.5 source=foo-linux region=z\xfcrich",
+		"foo.metric 1.5 source=foo-linux region=\"z\xfcrich\"",
+		"foo.metric 1.5 source=foo-linux \xff",
+		"foo.metric \xff1.5 source=foo-linux",
+	} {
+		if _, err := parsePoint(pointLine); !errors.Is(err, ErrInvalidUTF8) {
+			t.Errorf("expected an invalid UTF-8 error for %q, found %v", pointLine, err)
+		}
+	}
+
+	// symbols are only allowed in quoted literals
+	if _, err := parsePoint("foo.metric 1.5 source=foo-linux status=✓"); err == nil {
+		t.Error("expected an unquoted symbol to be rejected")
+	}
+}
+
 func TestInvalidPoints(t *testing.T) {
 	for _, pointLine := range invalidPoints {
 		pt, err := parsePoint(pointLine)
@@ -110,7 +147,81 @@ func TestInvalidPoints(t *testing.T) {
 	}
 }
 
+func TestParseInPlace(t *testing.T) {
+	line := []byte(`"foo.metric" 1.5 1505454047000 source=foo "env"="a \"b\"" unit=s`)
+	pt, err := graphiteParser.Parse(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the point must not share the line, which readers reuse
+	for i := range line {
+		line[i] = 'x'
+	}
+	if pt.Name != "foo.metric" || pt.Value != "1.5" || pt.Timestamp != 1505454047 ||
+		pt.Tags["env"] != `a \"b\"` || pt.Tags["unit"] != "s" {
+		t.Errorf("unexpected point %+v", pt)
+	}
+
+	// a NUL byte ends the line
+	pt, err = graphiteParser.Parse([]byte("foo.metric 1 source=foo\x00 env=dev"))
+	if err != nil || len(pt.Tags) != 1 {
+		t.Errorf("expected the tags before the NUL byte, found %v %v", pt, err)
+	}
+	if _, err := graphiteParser.Parse([]byte("foo.metric 1 99999999999999999999 source=foo")); err == nil {
+		t.Error("expected an error for an out of range timestamp")
+	}
+	pt, err = graphiteParser.Parse([]byte(`∆"foo metric" 1 source=foo`))
+	if err != nil || pt.Name != "∆foo metric" {
+		t.Errorf("expected a quoted delta counter name, found %v %v", pt, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, test := range []struct {
+		line     string
+		offset   int
+		element  string
+		category ErrorCategory
+		found    string
+	}{
+		{"", 0, ElementName, CategoryUnexpectedEnd, ""},
+		{"foo.metric", 10, ElementValue, CategoryUnexpectedEnd, ""},
+		{"foo.metric 1.5 ", 15, "tag 1", CategoryUnexpectedEnd, ""},
+		{"foo.metric x source=s", 11, ElementValue, CategoryInvalidValue, "x"},
+		{"foo.metric 1.5.0 source=s", 11, ElementValue, CategoryInvalidValue, "1.5.0"},
+		{"foo.metric 1 123 source=s", 13, ElementTimestamp, CategoryInvalidTimestamp, "123"},
+		{"foo#bar 1 source=s", 3, ElementName, CategoryInvalidCharacter, "#"},
+		{"foo.metric 1 source=s #a=b", 22, "tag 2", CategoryInvalidCharacter, "#"},
+		{"te\"st.metric 1 source=s", 2, ElementName, CategoryUnexpectedToken, "\""},
+		{"foo.metric 1 source=s env", 25, "tag 2", CategoryUnexpectedEnd, ""},
+		{"foo.metric 1 source=s env dev", 25, "tag 2", CategoryUnexpectedToken, " "},
+		{"foo.metric 1 source=s env=\"dev", 26, "tag 2", CategoryUnterminatedQuote, ""},
+		{"foo.metric 1 source=s a=b env=d\xffev", 31, "tag 3", CategoryInvalidUTF8, "\xff"},
+	} {
+		_, err := graphiteParser.Parse([]byte(test.line))
+		pe, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("%q: expected a parse error, found %v", test.line, err)
+			continue
+		}
+		if pe.Offset != test.offset || pe.Element != test.element || pe.Category != test.category || pe.Found != test.found {
+			t.Errorf("%q: expected %s in %s at offset %d, found %+v", test.line, test.category, test.element, test.offset, pe)
+		}
+	}
+
+	_, err := NewOpenTSDBParser().Parse([]byte("put foo.metric 1505454047"))
+	if pe, ok := err.(*ParseError); !ok || pe.Element != ElementValue || pe.Offset != 25 {
+		t.Errorf("expected a missing value at offset 25, found %v", err)
+	}
+	// offsets count from the start of event lines
+	_, err = NewEventParser().Parse([]byte("@Event x"))
+	if pe, ok := err.(*ParseError); !ok || pe.Element != ElementTimestamp || pe.Offset != 7 {
+		t.Errorf("expected an invalid start time at offset 7, found %v", err)
+	}
+}
+
 func BenchmarkGraphiteParseBase(b *testing.B) {
+	b.ReportAllocs()
 	pt := "\"foo.metric\" 1.5 source=foo-linux \"env\"=\"dev\""
 	for i := 0; i < b.N; i++ {
 		graphiteParser.Parse([]byte(pt))
@@ -118,6 +229,7 @@ func BenchmarkGraphiteParseBase(b *testing.B) {
 }
 
 func BenchmarkGraphiteParseComplex(b *testing.B) {
+	b.ReportAllocs()
 	pt := "\"mac.disk.total\" 4.9895440384E11 1504118031 source=\"Vikrams-MacBook-Pro.local\" \"path\"=\"/\" \"os\"=\"Mac\" \"device\"=\"disk1\" \"fstype\"=\"hfs\""
 	for i := 0; i < b.N; i++ {
 		graphiteParser.Parse([]byte(pt))
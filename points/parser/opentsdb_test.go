@@ -77,6 +77,7 @@ func TestInvalidOpenTSDBPoints(t *testing.T) {
 }
 
 func BenchmarkOpenTSDBParseBase(b *testing.B) {
+	b.ReportAllocs()
 	pt := "\"foo.metric\" 1.5 source=foo-linux \"env\"=\"dev\""
 	for i := 0; i < b.N; i++ {
 		openTSDBParser.Parse([]byte(pt))
@@ -84,6 +85,7 @@ func BenchmarkOpenTSDBParseBase(b *testing.B) {
 }
 
 func BenchmarkOpenTSDBParseComplex(b *testing.B) {
+	b.ReportAllocs()
 	pt := "\"mac.disk.total\" 4.9895440384E11 1504118031 source=\"Vikrams-MacBook-Pro.local\" \"path\"=\"/\" \"os\"=\"Mac\" \"device\"=\"disk1\" \"fstype\"=\"hfs\""
 	for i := 0; i < b.N; i++ {
 		openTSDBParser.Parse([]byte(pt))
@@ -1,25 +1,41 @@
 package parser
 
 import (
-	"bytes"
-	"log"
+	"strconv"
 
 	"github.com/wavefronthq/go-proxy/common"
 )
 
-const MAX_BUFFER_SIZE = 2
-
-// Parser represents a parser.
+// Parser represents a parser. Elements read tokens as slices of the line, and their literals are
+// substrings of a single string copy of the line.
 type PointParser struct {
-	s   *PointScanner
-	buf struct {
-		tok []Token  // last read n tokens
-		lit []string // last read n literals
-		n   int      // unscanned buffer size (max=2)
-	}
-	scanBuf  bytes.Buffer // buffer reused for scanning tokens
-	writeBuf bytes.Buffer // buffer reused for parsing elements
+	s PointScanner
+	// offset of the last scanned token, unscan returns to it
+	last int
+	// copy of the line, made by the first call to text
+	line     string
+	copied   bool
 	Elements []ElementParser
+	// set by Locate to record the spans of the name and tags
+	locating bool
+	spans    []Span
+}
+
+// Location of the name, the source or a tag in a line, recorded by Locate.
+type Span struct {
+	// ElementName, ElementSource or ElementTag
+	Element string
+	// key of a tag
+	Key string
+	// offsets of the name or of the tag key, without quotes or delta prefix
+	Start, End int
+	// offsets of the tag value
+	ValueStart, ValueEnd int
+}
+
+// Span of the scanned line, from start up to end.
+type span struct {
+	start, end int
 }
 
 // Returns a slice of ElementParser's for the Graphite format
@@ -53,75 +69,113 @@ func NewOpenTSDBParser() *PointParser {
 	return &PointParser{Elements: elements}
 }
 
-// scan returns the next token from the underlying scanner.
-// If a token has been unscanned then read that from the internal buffer instead.
-func (p *PointParser) scan() (Token, string) {
-	// If we have a token on the buffer, then return it.
-	if p.buf.n != 0 {
-		idx := p.buf.n % MAX_BUFFER_SIZE
-		tok, lit := p.buf.tok[idx], p.buf.lit[idx]
-		p.buf.n -= 1
-		return tok, lit
-	}
-
-	// Otherwise read the next token from the scanner.
-	tok, lit := p.s.Scan()
+// scan returns the next token and its bytes from the underlying scanner.
+func (p *PointParser) scan() (Token, []byte) {
+	p.last = p.s.pos
+	return p.s.Scan()
+}
 
-	// Save it to the buffer in case we unscan later.
-	p.buffer(tok, lit)
+// unscan pushes the previously read token back. Use mark and rewind to go back further.
+func (p *PointParser) unscan() {
+	p.s.pos = p.last
+}
 
-	return tok, lit
+// mark returns the offset of the next token.
+func (p *PointParser) mark() int {
+	return p.s.pos
 }
 
-func (p *PointParser) buffer(tok Token, lit string) {
-	// create the buffer if it is empty
-	if len(p.buf.tok) == 0 {
-		p.buf.tok = make([]Token, MAX_BUFFER_SIZE)
-		p.buf.lit = make([]string, MAX_BUFFER_SIZE)
-	}
+// rewind continues scanning at an offset returned by mark.
+func (p *PointParser) rewind(offset int) {
+	p.s.pos = offset
+}
 
-	// for now assume a simple circular buffer of length two
-	p.buf.tok[0], p.buf.lit[0] = p.buf.tok[1], p.buf.lit[1]
-	p.buf.tok[1], p.buf.lit[1] = tok, lit
+// since returns the span from the offset to the next token.
+func (p *PointParser) since(offset int) span {
+	return span{offset, p.s.pos}
 }
 
-// unscan pushes the previously read token back onto the buffer.
-func (p *PointParser) unscan() {
-	p.unscanTokens(1)
+// bytes returns the bytes of a span, which must not be modified.
+func (p *PointParser) bytes(sp span) []byte {
+	return p.s.b[sp.start:sp.end]
 }
 
-func (p *PointParser) unscanTokens(n int) {
-	if n > MAX_BUFFER_SIZE {
-		// just log for now
-		log.Printf("cannot unscan more than %d tokens", MAX_BUFFER_SIZE)
+// text returns a span as a string. Every string of a line shares one copy of the line, so a point
+// costs a single allocation for its name, value and tags.
+func (p *PointParser) text(sp span) string {
+	if !p.copied {
+		p.line, p.copied = string(p.s.b), true
 	}
-	p.buf.n += n
+	return p.line[sp.start:sp.end]
 }
 
 func (p *PointParser) reset(b []byte) {
-
-	// reset the scan buffer and write new byte
-	p.scanBuf.Reset()
-	p.scanBuf.Write(b)
-
-	if p.s == nil {
-		p.s = NewScanner(&p.scanBuf)
-	} else {
-		// reset p.s.r passing in the buffer as the reader
-		p.s.r.Reset(&p.scanBuf)
-	}
-	p.buf.n = 0
+	p.s.Reset(b)
+	p.last = 0
+	p.line, p.copied = "", false
 }
 
 // Parses one entire pointLine
 func (p *PointParser) Parse(b []byte) (*common.Point, error) {
 	p.reset(b)
 	point := common.Point{}
-	for _, element := range p.Elements {
+	for i, element := range p.Elements {
 		err := element.parse(p, &point)
-		if err != nil {
+		if err == ErrEOF {
+			// the line ended before a whitespace element
+			if err := p.finish(p.Elements[i+1:], &point); err != nil {
+				return nil, err
+			}
+			break
+		} else if err != nil {
 			return nil, err
 		}
 	}
 	return &point, nil
 }
+
+// Locate parses a line again and returns the spans of its name and tags, up to the first error.
+// Used to find the offset of a problem reported by validation.
+func (p *PointParser) Locate(b []byte) []Span {
+	p.locating, p.spans = true, nil
+	defer func() {
+		p.locating, p.spans = false, nil
+	}()
+	p.Parse(b)
+	return p.spans
+}
+
+// finish completes a point when the line ended before the given elements. Returns an error for the
+// first required element left.
+func (p *PointParser) finish(elements []ElementParser, pt *common.Point) error {
+	err := p.endOfLine("")
+	for _, element := range elements {
+		switch e := element.(type) {
+		case *WhiteSpaceParser:
+			continue
+		case *TimestampParser:
+			if e.optional {
+				setTimestamp(pt, 0, 1)
+				continue
+			}
+			err.Element, err.Expected = ElementTimestamp, "timestamp"
+		case *NameParser:
+			err.Element, err.Expected = ElementName, "metric name"
+		case *ValueParser:
+			err.Element, err.Expected = ElementValue, "number"
+		case *FixedSourceParser:
+			err.Element, err.Expected = ElementSource, "source"
+		case *LoopedParser:
+			if e.optional {
+				continue
+			}
+			err.Element, err.Expected = ElementTag+" 1", "key=value"
+		case *LiteralParser:
+			err.Element, err.Expected = ElementLiteral, strconv.Quote(e.literal)
+		default:
+			err.Expected = "more elements"
+		}
+		return err
+	}
+	return nil
+}
@@ -1,69 +1,97 @@
 package parser
 
-import (
-	"bufio"
-	"io"
+import "unicode/utf8"
+
+var (
+	// token of each ASCII byte
+	asciiTokens = newASCIITokens()
+
+	// ASCII bytes which element parsers skip rather than scan token by token
+	literalBytes = newByteClass(func(ch byte, tok Token) bool { return tok > literal_beg && tok < literal_end })
+	quotedBytes  = newByteClass(func(ch byte, tok Token) bool { return ch != 0 && tok != QUOTES && tok != BACKSLASH })
+	valueBytes   = newByteClass(func(ch byte, tok Token) bool {
+		return tok == LETTER || tok == NUMBER || tok == DOT || tok == MINUS_SIGN
+	})
+	digitBytes = newByteClass(func(ch byte, tok Token) bool { return tok == NUMBER })
+	spaceBytes = newByteClass(func(ch byte, tok Token) bool { return tok == WS })
 )
 
-// Lexical Point Scanner
-type PointScanner struct {
-	r *bufio.Reader
-}
+// Set of ASCII bytes.
+type byteClass [utf8.RuneSelf]bool
 
-func NewScanner(r io.Reader) *PointScanner {
-	return &PointScanner{r: bufio.NewReader(r)}
+func newASCIITokens() *[utf8.RuneSelf]Token {
+	tokens := &[utf8.RuneSelf]Token{'.': DOT, '-': MINUS_SIGN, '_': UNDERSCORE, '/': SLASH, '\\': BACKSLASH,
+		',': COMMA, '"': QUOTES, '=': EQUALS}
+	for ch := range tokens {
+		r := rune(ch)
+		switch {
+		case isWhitespace(r):
+			tokens[ch] = WS
+		case isLetter(r):
+			tokens[ch] = LETTER
+		case isNumber(r):
+			tokens[ch] = NUMBER
+		}
+	}
+	return tokens
 }
 
-// read reads the next rune from the buffered reader.
-// Returns rune(0) if an error occurs (or io.EOF is returned).
-func (s *PointScanner) read() rune {
-	ch, _, err := s.r.ReadRune()
-	if err != nil {
-		return eof
+func newByteClass(match func(ch byte, tok Token) bool) *byteClass {
+	class := &byteClass{}
+	for ch, tok := range asciiTokens {
+		class[ch] = match(byte(ch), tok)
 	}
-	return ch
+	return class
 }
 
-// unread places the previously read rune back on the reader.
-func (s *PointScanner) unread() {
-	_ = s.r.UnreadRune()
+// Lexical Point Scanner, scanning a line in place.
+type PointScanner struct {
+	b   []byte
+	pos int
 }
 
-// Scan returns the next token and literal value.
-func (s *PointScanner) Scan() (Token, string) {
+func NewScanner(b []byte) *PointScanner {
+	return &PointScanner{b: b}
+}
 
-	// Read the next rune
-	ch := s.read()
-	if isWhitespace(ch) {
-		return WS, string(ch)
-	} else if isLetter(ch) {
-		return LETTER, string(ch)
-	} else if isNumber(ch) {
-		return NUMBER, string(ch)
+// Reset starts scanning b from its first byte.
+func (s *PointScanner) Reset(b []byte) {
+	s.b, s.pos = b, 0
+}
+
+// Scan returns the next token and its bytes, a slice of the scanned line which must not be modified.
+// ASCII characters are one byte tokens, other runes one token each. A NUL byte ends the line.
+func (s *PointScanner) Scan() (Token, []byte) {
+	if s.atEOF() {
+		return EOF, nil
+	}
+	start := s.pos
+	if ch := s.b[start]; ch < utf8.RuneSelf {
+		s.pos++
+		return asciiTokens[ch], s.b[start:s.pos]
+	}
+
+	ch, size := utf8.DecodeRune(s.b[start:])
+	s.pos += size
+	lit := s.b[start:s.pos]
+	if ch == utf8.RuneError && size == 1 {
+		return INVALID_UTF8, lit
+	} else if isUnicode(ch) {
+		return UNICODE, lit
 	}
+	return ILLEGAL, lit
+}
+
+// atEOF returns true if the next token is EOF.
+func (s *PointScanner) atEOF() bool {
+	return s.pos >= len(s.b) || s.b[s.pos] == 0
+}
 
-	// Otherwise read the individual character.
-	switch ch {
-	case eof:
-		return EOF, ""
-	case '\n':
-		return NEWLINE, string(ch)
-	case '.':
-		return DOT, string(ch)
-	case '-':
-		return MINUS_SIGN, string(ch)
-	case '_':
-		return UNDERSCORE, string(ch)
-	case '/':
-		return SLASH, string(ch)
-	case '\\':
-		return BACKSLASH, string(ch)
-	case ',':
-		return COMMA, string(ch)
-	case '"':
-		return QUOTES, string(ch)
-	case '=':
-		return EQUALS, string(ch)
+// skip advances over the ASCII bytes of a class, which is faster than scanning them as tokens.
+func (s *PointScanner) skip(class *byteClass) {
+	b, pos := s.b, s.pos
+	for pos < len(b) && b[pos] < utf8.RuneSelf && class[b[pos]] {
+		pos++
 	}
-	return ILLEGAL, string(ch)
+	s.pos = pos
 }
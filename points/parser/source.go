@@ -0,0 +1,106 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/wavefronthq/go-proxy/common"
+)
+
+const (
+	// leading literals of source metadata lines
+	SourceTagLiteral         = "@" + common.SourceTagType
+	SourceDescriptionLiteral = "@" + common.SourceDescriptionType
+
+	actionKey      = "action"
+	sourceKey      = "source"
+	descriptionKey = "description"
+)
+
+var ErrNotSourceOperation = errors.New("expected @SourceTag or @SourceDescription")
+
+// Parses source metadata lines:
+// @SourceTag action=add|delete|save source=<source> [<tag> ...]
+// @SourceDescription action=save|delete source=<source> [description=<description>]
+// The key value pairs and the tags may be given in any order.
+type SourceParser struct {
+	p PointParser
+}
+
+func NewSourceParser() *SourceParser {
+	return &SourceParser{}
+}
+
+// IsSourceOperation returns true if a line is a source tag or source description line.
+func IsSourceOperation(b []byte) bool {
+	return hasLiteral(b, SourceTagLiteral) || hasLiteral(b, SourceDescriptionLiteral)
+}
+
+func hasLiteral(b []byte, literal string) bool {
+	return bytes.HasPrefix(b, []byte(literal)) && (len(b) == len(literal) || isWhitespace(rune(b[len(literal)])))
+}
+
+// Parse parses one entire source metadata line. The action and source are checked by the decoder.
+func (sp *SourceParser) Parse(b []byte) (*common.SourceOperation, error) {
+	op := &common.SourceOperation{}
+	switch {
+	case hasLiteral(b, SourceTagLiteral):
+		op.Type = common.SourceTagType
+	case hasLiteral(b, SourceDescriptionLiteral):
+		op.Type = common.SourceDescriptionType
+	default:
+		return nil, ErrNotSourceOperation
+	}
+	p := &sp.p
+	p.reset(b[len(op.Type)+1:])
+	err := parseSourceOperation(p, op)
+	if err != nil {
+		return nil, shiftOffset(inElement(ElementTag, err), len(op.Type)+1)
+	}
+	return op, nil
+}
+
+// parseSourceOperation parses the keys and tags of a source line after its literal.
+func parseSourceOperation(p *PointParser, op *common.SourceOperation) error {
+	ws := &WhiteSpaceParser{}
+
+	seen := make(map[string]bool)
+	for ws.parse(p, nil) != ErrEOF {
+		k, err := parseLiteral(p)
+		if err != nil {
+			return err
+		}
+		if k == "" {
+			_, lit := p.scan()
+			return p.errorAt(CategoryUnexpectedToken, "literal", lit)
+		}
+		if tok, _ := p.scan(); tok != EQUALS {
+			p.unscan()
+			if op.Type != common.SourceTagType {
+				return fmt.Errorf("found %q, expected %s=<value>", k, descriptionKey)
+			}
+			op.Tags = append(op.Tags, k)
+			continue
+		}
+		v, err := parseLiteral(p)
+		if err != nil {
+			return err
+		}
+		if seen[k] {
+			return fmt.Errorf("duplicate key %q", k)
+		}
+		seen[k] = true
+		switch {
+		case k == actionKey:
+			op.Action = v
+		case k == sourceKey:
+			op.Source = v
+		case k == descriptionKey && op.Type == common.SourceDescriptionType:
+			op.Description = v
+		default:
+			return fmt.Errorf("unexpected key %q", k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wavefronthq/go-proxy/common"
+)
+
+func TestParseSourceOperation(t *testing.T) {
+	sp := NewSourceParser()
+	tests := []struct {
+		line     string
+		expected common.SourceOperation
+	}{
+		{"@SourceTag action=add source=app1 web prod", common.SourceOperation{
+			Type: common.SourceTagType, Action: "add", Source: "app1", Tags: []string{"web", "prod"}}},
+		{`@SourceTag "db tier" source="app1.example.com" action=save`, common.SourceOperation{
+			Type: common.SourceTagType, Action: "save", Source: "app1.example.com", Tags: []string{"db tier"}}},
+		{`@SourceDescription action=save source=app1 description="Web server, rack 4"`, common.SourceOperation{
+			Type: common.SourceDescriptionType, Action: "save", Source: "app1", Description: "Web server, rack 4"}},
+		{"@SourceDescription action=delete source=app1", common.SourceOperation{
+			Type: common.SourceDescriptionType, Action: "delete", Source: "app1"}},
+	}
+	for _, test := range tests {
+		op, err := sp.Parse([]byte(test.line))
+		if err != nil {
+			t.Errorf("%q: %v", test.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(*op, test.expected) {
+			t.Errorf("%q: expected %+v, found %+v", test.line, test.expected, *op)
+		}
+	}
+}
+
+func TestInvalidSourceOperations(t *testing.T) {
+	if IsSourceOperation([]byte("@SourceTags action=add source=a b")) || !IsSourceOperation([]byte("@SourceTag")) {
+		t.Error("unexpected source line detection")
+	}
+	sp := NewSourceParser()
+	for _, line := range []string{
+		"@SourceTags action=add source=a b",
+		"@SourceTag action=add action=delete source=a b",
+		"@SourceTag action=add source=a color=red",
+		"@SourceTag action=add source=a =b",
+		"@SourceDescription action=save source=a stray",
+		`@SourceDescription action=save source=a description="unterminated`,
+	} {
+		if op, err := sp.Parse([]byte(line)); err == nil {
+			t.Errorf("expected an error for %q, found %+v", line, op)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/wavefronthq/go-proxy/common"
+)
+
+// Kinds of the elements of a line format.
+const (
+	SpecName              = "name"
+	SpecValue             = "value"
+	SpecTimestamp         = "timestamp"
+	SpecOptionalTimestamp = "optionalTimestamp"
+	// the source at a fixed position, without a source tag
+	SpecSource = "source"
+	// key=value tags up to the end of the line
+	SpecTags    = "tags"
+	SpecLiteral = "literal"
+)
+
+// Element of a line format, see NewElements. In YAML an element is its kind, such as name, or a
+// literal keyword written as {literal: put}.
+type ElementSpec struct {
+	Kind    string
+	Literal string
+}
+
+func (s *ElementSpec) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var kind string
+	if err := unmarshal(&kind); err == nil {
+		*s = ElementSpec{Kind: kind}
+		return nil
+	}
+	var literal struct {
+		Literal string `yaml:"literal"`
+	}
+	if err := unmarshal(&literal); err != nil {
+		return fmt.Errorf("invalid element, expected an element kind or literal: <keyword>: %v", err)
+	}
+	*s = ElementSpec{Kind: SpecLiteral, Literal: literal.Literal}
+	return nil
+}
+
+func (s ElementSpec) String() string {
+	if s.Kind == SpecLiteral {
+		return fmt.Sprintf("literal %q", s.Literal)
+	}
+	return s.Kind
+}
+
+// NewElements returns the ElementParsers of a line format, separated by whitespace. A format has one
+// name and one value, at most one timestamp, and either a source or tags. Tags must come last, and are
+// optional if the format has a source.
+func NewElements(specs []ElementSpec) ([]ElementParser, error) {
+	if err := checkSpecs(specs); err != nil {
+		return nil, err
+	}
+
+	hasSource := false
+	for _, spec := range specs {
+		hasSource = hasSource || spec.Kind == SpecSource
+	}
+	wsParser := WhiteSpaceParser{}
+	var elements []ElementParser
+	for i, spec := range specs {
+		if i > 0 {
+			elements = append(elements, &wsParser)
+		}
+		switch spec.Kind {
+		case SpecName:
+			elements = append(elements, &NameParser{})
+		case SpecValue:
+			elements = append(elements, &ValueParser{})
+		case SpecTimestamp:
+			elements = append(elements, &TimestampParser{})
+		case SpecOptionalTimestamp:
+			elements = append(elements, &TimestampParser{optional: true})
+		case SpecSource:
+			elements = append(elements, &FixedSourceParser{})
+		case SpecTags:
+			elements = append(elements, &LoopedParser{wrappedParser: &TagParser{}, wsPaser: &wsParser, optional: hasSource})
+		case SpecLiteral:
+			elements = append(elements, &LiteralParser{literal: spec.Literal})
+		}
+	}
+	return elements, nil
+}
+
+func checkSpecs(specs []ElementSpec) error {
+	counts := make(map[string]int)
+	for i, spec := range specs {
+		switch spec.Kind {
+		case SpecName, SpecValue, SpecTimestamp, SpecOptionalTimestamp, SpecSource:
+		case SpecTags:
+			if i != len(specs)-1 {
+				return errors.New("tags must be the last element")
+			}
+		case SpecLiteral:
+			if err := checkLiteral(spec.Literal); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown element %q, expected name, value, timestamp, optionalTimestamp, source, tags or a literal", spec.Kind)
+		}
+		counts[spec.Kind]++
+		if spec.Kind != SpecLiteral && counts[spec.Kind] > 1 {
+			return fmt.Errorf("duplicate element %s", spec)
+		}
+		// an optional timestamp followed by the value would take the integer part of the value
+		if spec.Kind == SpecOptionalTimestamp && i+1 < len(specs) && specs[i+1].Kind == SpecValue {
+			return errors.New("optionalTimestamp must not be followed by value")
+		}
+	}
+
+	switch {
+	case counts[SpecName] == 0:
+		return errors.New("missing name element")
+	case counts[SpecValue] == 0:
+		return errors.New("missing value element")
+	case counts[SpecTimestamp]+counts[SpecOptionalTimestamp] > 1:
+		return errors.New("only one of timestamp and optionalTimestamp may be used")
+	case counts[SpecSource]+counts[SpecTags] == 0:
+		return errors.New("missing source or tags element, points need a source")
+	}
+	return nil
+}
+
+// checkLiteral checks that a literal keyword is an entire unquoted literal.
+func checkLiteral(literal string) error {
+	if literal == "" {
+		return errors.New("empty literal")
+	}
+	p := &PointParser{}
+	p.reset([]byte(literal))
+	if lit, err := scanLiteral(p); err != nil || p.s.b[0] == '"' || lit.end != len(literal) {
+		return fmt.Errorf("invalid literal %q, expected letters, digits, \"-\", \"_\" or \".\"", literal)
+	}
+	return nil
+}
+
+// Parses the source of a point at a fixed position, for formats without a source tag.
+type FixedSourceParser struct{}
+
+func (ep *FixedSourceParser) parse(p *PointParser, pt *common.Point) error {
+	v, err := scanLiteral(p)
+	if err != nil {
+		return inElement(ElementSource, err)
+	}
+	if v.start == v.end {
+		_, found := p.scan()
+		return &ParseError{Offset: p.last, Element: ElementSource, Expected: "source", Found: string(found),
+			Category: CategoryUnexpectedToken}
+	}
+	if len(pt.Tags) == 0 {
+		pt.Tags = make(map[string]string)
+	}
+	pt.Tags[sourceKey] = p.text(v)
+	if p.locating {
+		p.spans = append(p.spans, Span{Element: ElementSource, Key: sourceKey, ValueStart: v.start, ValueEnd: v.end})
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package parser
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func newSpecParser(t *testing.T, spec string) *PointParser {
+	var specs []ElementSpec
+	if err := yaml.UnmarshalStrict([]byte(spec), &specs); err != nil {
+		t.Fatal(err)
+	}
+	elements, err := NewElements(specs)
+	if err != nil {
+		t.Fatalf("%s: %v", spec, err)
+	}
+	return &PointParser{Elements: elements}
+}
+
+func TestSpecElements(t *testing.T) {
+	p := newSpecParser(t, "[timestamp, value, name, tags]")
+	pt, err := p.Parse([]byte("1505454047 1.5 foo.metric source=a env=dev"))
+	if err != nil || pt.Timestamp != 1505454047 || pt.Value != "1.5" || pt.Name != "foo.metric" || pt.Tags["env"] != "dev" {
+		t.Errorf("unexpected point %+v: %v", pt, err)
+	}
+
+	// tags are optional with a fixed source
+	p = newSpecParser(t, "[{literal: metric}, name, source, value, optionalTimestamp, tags]")
+	for _, line := range []string{"metric foo.metric host1 1.5", "metric foo.metric host1 1.5 1505454047 env=dev",
+		"metric foo.metric host1 1.5 env=dev"} {
+		pt, err := p.Parse([]byte(line))
+		if err != nil || pt.Name != "foo.metric" || pt.Tags["source"] != "host1" || pt.Timestamp == 0 {
+			t.Errorf("%q: unexpected point %+v: %v", line, pt, err)
+		}
+	}
+
+	for _, test := range []struct {
+		line    string
+		element string
+		offset  int
+	}{
+		{"put foo.metric host1 1.5", ElementLiteral, 0},
+		{"metric foo.metric", ElementSource, 17},
+		{"metric foo.metric host1", ElementValue, 23},
+	} {
+		_, err := p.Parse([]byte(test.line))
+		if pe, ok := err.(*ParseError); !ok || pe.Element != test.element || pe.Offset != test.offset {
+			t.Errorf("%q: expected an error in %s at offset %d, found %v", test.line, test.element, test.offset, err)
+		}
+	}
+}
+
+func TestInvalidSpecs(t *testing.T) {
+	for _, spec := range [][]ElementSpec{
+		nil,
+		{{Kind: SpecName}, {Kind: SpecTags}},
+		{{Kind: SpecValue}, {Kind: SpecSource}},
+		{{Kind: SpecName}, {Kind: SpecValue}},
+		{{Kind: SpecName}, {Kind: SpecName}, {Kind: SpecValue}, {Kind: SpecTags}},
+		{{Kind: SpecName}, {Kind: SpecValue}, {Kind: SpecTimestamp}, {Kind: SpecOptionalTimestamp}, {Kind: SpecTags}},
+		{{Kind: SpecName}, {Kind: SpecTags}, {Kind: SpecValue}},
+		{{Kind: SpecName}, {Kind: SpecOptionalTimestamp}, {Kind: SpecValue}, {Kind: SpecTags}},
+		{{Kind: "host"}, {Kind: SpecName}, {Kind: SpecValue}, {Kind: SpecTags}},
+		{{Kind: SpecLiteral}, {Kind: SpecName}, {Kind: SpecValue}, {Kind: SpecTags}},
+		{{Kind: SpecLiteral, Literal: "a b"}, {Kind: SpecName}, {Kind: SpecValue}, {Kind: SpecTags}},
+		{{Kind: SpecLiteral, Literal: `"put"`}, {Kind: SpecName}, {Kind: SpecValue}, {Kind: SpecTags}},
+	} {
+		if _, err := NewElements(spec); err == nil {
+			t.Errorf("expected an error for %v", spec)
+		}
+	}
+
+	var specs []ElementSpec
+	if err := yaml.UnmarshalStrict([]byte("[{keyword: put}, name, value, tags]"), &specs); err == nil {
+		t.Error("expected an error for an unknown element key")
+	}
+}
@@ -1,10 +1,16 @@
 package parser
 
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
 type Token int
 
 const (
 	// Special tokens
 	ILLEGAL Token = iota
+	INVALID_UTF8
 	EOF
 	WS
 
@@ -12,6 +18,7 @@ const (
 	literal_beg
 	LETTER // metric name, source/point tags
 	NUMBER
+	UNICODE // non-ASCII letter, mark or digit
 	MINUS_SIGN
 	UNDERSCORE
 	DOT
@@ -38,4 +45,8 @@ func isNumber(ch rune) bool {
 	return ch >= '0' && ch <= '9'
 }
 
-var eof = rune(0)
+// Non-ASCII characters allowed in unquoted literals are the Unicode letters (L), combining marks (M)
+// and decimal digits (Nd). Quoted literals may contain any valid UTF-8.
+func isUnicode(ch rune) bool {
+	return ch >= utf8.RuneSelf && ch != utf8.RuneError && (unicode.IsLetter(ch) || unicode.IsMark(ch) || unicode.IsDigit(ch))
+}
@@ -0,0 +1,355 @@
+package preprocessor
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/wavefronthq/go-proxy/common"
+	"github.com/wavefronthq/go-proxy/config"
+)
+
+// Configuration of a single rule, compatible with the Java proxy's preprocessor_rules.yaml syntax.
+type RuleConfig struct {
+	Rule          string `yaml:"rule"`
+	Action        string `yaml:"action"`
+	Scope         string `yaml:"scope"`
+	Search        string `yaml:"search"`
+	Replace       string `yaml:"replace"`
+	Match         string `yaml:"match"`
+	Tag           string `yaml:"tag"`
+	NewTag        string `yaml:"newtag"`
+	Value         string `yaml:"value"`
+	Source        string `yaml:"source"`
+	ReplaceSource string `yaml:"replaceSource"`
+	Iterations    int    `yaml:"iterations"`
+	ActionSubtype string `yaml:"actionSubtype"`
+	MaxLength     int    `yaml:"maxLength"`
+}
+
+// Applies an ordered list of rules to the points received on a port.
+type Preprocessor struct {
+	lineRules  []lineRule
+	pointRules []pointRule
+}
+
+// Rejection of a point line or point by a filter rule.
+type RejectedError struct {
+	Rule string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("rejected by preprocessor rule %q", e.Rule)
+}
+
+// Returns true if the preprocessor has rules for raw point lines.
+func (p *Preprocessor) HasPointLineRules() bool {
+	return p != nil && len(p.lineRules) > 0
+}
+
+// Returns true if the preprocessor has rules for decoded points.
+func (p *Preprocessor) HasPointRules() bool {
+	return p != nil && len(p.pointRules) > 0
+}
+
+// ForPointLine applies the point line rules and returns the transformed line.
+// Returns a *RejectedError if the line is rejected by a filter rule.
+func (p *Preprocessor) ForPointLine(line string) (string, error) {
+	if p == nil {
+		return line, nil
+	}
+	for _, rule := range p.lineRules {
+		var ok bool
+		if line, ok = rule.applyLine(line); !ok {
+			return line, &RejectedError{Rule: rule.name()}
+		}
+	}
+	return line, nil
+}
+
+// ForPoint applies the point rules, transforming the point in place.
+// Returns a *RejectedError if the point is rejected by a filter rule.
+func (p *Preprocessor) ForPoint(pt *common.Point) error {
+	if p == nil {
+		return nil
+	}
+	for _, rule := range p.pointRules {
+		if !rule.apply(pt) {
+			return &RejectedError{Rule: rule.name()}
+		}
+	}
+	return nil
+}
+
+// Preprocessors of the listener ports. Ports without rules of their own apply the global rules.
+type Preprocessors struct {
+	mtx    sync.Mutex
+	ports  map[int]*Preprocessor
+	global []RuleConfig
+}
+
+// For returns the preprocessor of a port, or nil if no rules apply to the port.
+func (p *Preprocessors) For(port int) (*Preprocessor, error) {
+	if p == nil {
+		return nil, nil
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if pp, ok := p.ports[port]; ok {
+		return pp, nil
+	}
+	if len(p.global) == 0 {
+		return nil, nil
+	}
+	pp, err := New(strconv.Itoa(port), p.global)
+	if err != nil {
+		return nil, err
+	}
+	p.ports[port] = pp
+	return pp, nil
+}
+
+// LoadFile reads a preprocessor rules file.
+func LoadFile(filename string) (*Preprocessors, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Load(data)
+}
+
+// Load parses preprocessor rules keyed by comma separated port lists.
+// Rules under the "global" key are applied to every port ahead of the port specific rules.
+func Load(data []byte) (*Preprocessors, error) {
+	file, err := config.ParsePortFile(data, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var globalRules []RuleConfig
+	if file.Global != nil {
+		if err := file.Global.Decode(&globalRules); err != nil {
+			return nil, fmt.Errorf("%s: %v", config.GlobalKey, err)
+		}
+	}
+	// unlisted ports build their preprocessor on first use, so check the global rules now
+	if _, err := build(globalRules, func(string) metrics.Counter { return metrics.NilCounter{} }); err != nil {
+		return nil, fmt.Errorf("%s: %v", config.GlobalKey, err)
+	}
+
+	portRules := make(map[int][]RuleConfig)
+	for _, section := range file.Sections {
+		var rules []RuleConfig
+		if err := section.Decode(&rules); err != nil {
+			return nil, fmt.Errorf("%s: %v", section.Key, err)
+		}
+		for _, port := range section.Ports {
+			portRules[port] = append(portRules[port], rules...)
+		}
+	}
+
+	preprocessors := &Preprocessors{ports: make(map[int]*Preprocessor), global: globalRules}
+	for port, rules := range portRules {
+		p, err := New(strconv.Itoa(port), append(globalRules[:len(globalRules):len(globalRules)], rules...))
+		if err != nil {
+			return nil, fmt.Errorf("port %d: %v", port, err)
+		}
+		preprocessors.ports[port] = p
+	}
+	return preprocessors, nil
+}
+
+// New creates a Preprocessor from an ordered list of rules.
+// The prefix (typically the port) is used to name the per rule hit counters.
+func New(prefix string, rules []RuleConfig) (*Preprocessor, error) {
+	return build(rules, func(rule string) metrics.Counter {
+		return metrics.GetOrRegisterCounter("preprocessor."+prefix+"."+rule+".count", nil)
+	})
+}
+
+func build(rules []RuleConfig, hits func(rule string) metrics.Counter) (*Preprocessor, error) {
+	p := &Preprocessor{}
+	names := make(map[string]bool)
+	for _, cfg := range rules {
+		if cfg.Rule == "" {
+			return nil, fmt.Errorf("missing rule name for %s rule", cfg.Action)
+		}
+		if names[cfg.Rule] {
+			return nil, fmt.Errorf("duplicate rule name %q", cfg.Rule)
+		}
+		names[cfg.Rule] = true
+
+		base := baseRule{ruleName: cfg.Rule, hits: hits(cfg.Rule)}
+		if err := p.addRule(base, cfg); err != nil {
+			return nil, fmt.Errorf("rule %q: %v", cfg.Rule, err)
+		}
+	}
+	return p, nil
+}
+
+func (p *Preprocessor) addRule(base baseRule, cfg RuleConfig) error {
+	match, err := compileOptional(cfg.Match)
+	if err != nil {
+		return err
+	}
+
+	switch cfg.Action {
+	case "replaceRegex":
+		if err := require(cfg.Scope, "scope"); err != nil {
+			return err
+		}
+		search, err := compileRequired(cfg.Search, "search")
+		if err != nil {
+			return err
+		}
+		iterations := cfg.Iterations
+		if iterations <= 0 {
+			iterations = 1
+		}
+		rule := &replaceRegexRule{baseRule: base, scope: cfg.Scope, search: search, replace: cfg.Replace,
+			match: match, iterations: iterations}
+		if cfg.Scope == scopePointLine {
+			p.lineRules = append(p.lineRules, rule)
+		} else {
+			p.pointRules = append(p.pointRules, rule)
+		}
+
+	case "blacklistRegex", "whitelistRegex":
+		if err := require(cfg.Scope, "scope"); err != nil {
+			return err
+		}
+		if match == nil {
+			return errors.New("missing match")
+		}
+		rule := &filterRule{baseRule: base, scope: cfg.Scope, match: match, whitelist: cfg.Action == "whitelistRegex"}
+		if cfg.Scope == scopePointLine {
+			p.lineRules = append(p.lineRules, rule)
+		} else {
+			p.pointRules = append(p.pointRules, rule)
+		}
+
+	case "forceLowercase":
+		if err := requirePointScope(cfg.Scope); err != nil {
+			return err
+		}
+		p.pointRules = append(p.pointRules, &forceLowercaseRule{baseRule: base, scope: cfg.Scope, match: match})
+
+	case "addTag", "addTagIfNotExists":
+		if err := require(cfg.Tag, "tag"); err != nil {
+			return err
+		}
+		if err := require(cfg.Value, "value"); err != nil {
+			return err
+		}
+		p.pointRules = append(p.pointRules, &addTagRule{baseRule: base, tag: cfg.Tag, value: cfg.Value,
+			onlyMissing: cfg.Action == "addTagIfNotExists"})
+
+	case "dropTag":
+		if err := require(cfg.Tag, "tag"); err != nil {
+			return err
+		}
+		tag, err := compile(anchor(cfg.Tag), "tag")
+		if err != nil {
+			return err
+		}
+		p.pointRules = append(p.pointRules, &dropTagRule{baseRule: base, tag: tag, match: match})
+
+	case "renameTag":
+		if err := require(cfg.Tag, "tag"); err != nil {
+			return err
+		}
+		if err := require(cfg.NewTag, "newtag"); err != nil {
+			return err
+		}
+		p.pointRules = append(p.pointRules, &renameTagRule{baseRule: base, tag: cfg.Tag, newTag: cfg.NewTag, match: match})
+
+	case "extractTag":
+		if err := require(cfg.Tag, "tag"); err != nil {
+			return err
+		}
+		if err := requirePointScope(cfg.Source); err != nil {
+			return err
+		}
+		search, err := compileRequired(cfg.Search, "search")
+		if err != nil {
+			return err
+		}
+		if err := require(cfg.Replace, "replace"); err != nil {
+			return err
+		}
+		p.pointRules = append(p.pointRules, &extractTagRule{baseRule: base, tag: cfg.Tag, source: cfg.Source,
+			search: search, replace: cfg.Replace, replaceSource: cfg.ReplaceSource, match: match})
+
+	case "limitLength":
+		if err := requirePointScope(cfg.Scope); err != nil {
+			return err
+		}
+		switch cfg.ActionSubtype {
+		case limitTruncate:
+		case limitTruncateWithEllipsis:
+			if cfg.MaxLength <= len(ellipsis) {
+				return fmt.Errorf("maxLength must be greater than %d for %s", len(ellipsis), cfg.ActionSubtype)
+			}
+		case limitDrop:
+			if cfg.Scope == scopeMetricName || cfg.Scope == scopeSourceName {
+				return fmt.Errorf("%s is only supported for point tags", limitDrop)
+			}
+		default:
+			return fmt.Errorf("invalid actionSubtype %q", cfg.ActionSubtype)
+		}
+		if cfg.MaxLength <= 0 {
+			return errors.New("maxLength must be positive")
+		}
+		p.pointRules = append(p.pointRules, &limitLengthRule{baseRule: base, scope: cfg.Scope,
+			subtype: cfg.ActionSubtype, maxLength: cfg.MaxLength, match: match})
+
+	default:
+		return fmt.Errorf("invalid action %q", cfg.Action)
+	}
+	return nil
+}
+
+func require(value, key string) error {
+	if value == "" {
+		return fmt.Errorf("missing %s", key)
+	}
+	return nil
+}
+
+func requirePointScope(scope string) error {
+	if scope == scopePointLine {
+		return fmt.Errorf("scope %s is not supported for this action", scopePointLine)
+	}
+	return require(scope, "scope")
+}
+
+func compileRequired(expr, key string) (*regexp.Regexp, error) {
+	if err := require(expr, key); err != nil {
+		return nil, err
+	}
+	return compile(expr, key)
+}
+
+// compileOptional compiles an optional match regex, which like in the Java proxy must match the entire value.
+func compileOptional(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return compile(anchor(expr), "match")
+}
+
+func anchor(expr string) string {
+	return "^(?:" + expr + ")$"
+}
+
+func compile(expr, key string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s regex: %v", key, err)
+	}
+	return re, nil
+}
@@ -0,0 +1,219 @@
+package preprocessor
+
+import (
+	"testing"
+
+	"github.com/wavefronthq/go-proxy/common"
+)
+
+const testRules = `
+global:
+  - rule    : lowercase-name
+    action  : forceLowercase
+    scope   : metricName
+
+'2878':
+  - rule    : replace-badchars
+    action  : replaceRegex
+    scope   : pointLine
+    search  : "[&$!@]"
+    replace : "_"
+
+  - rule    : block-test
+    action  : blacklistRegex
+    scope   : pointLine
+    match   : ".*blockme.*"
+
+  - rule    : drop-az
+    action  : dropTag
+    tag     : "a."
+    match   : "dev.*"
+
+  - rule    : add-dc
+    action  : addTagIfNotExists
+    tag     : dc
+    value   : default
+
+  - rule    : rename-env
+    action  : renameTag
+    tag     : environment
+    newtag  : env
+
+  - rule    : extract-region
+    action  : extractTag
+    tag     : region
+    source  : metricName
+    search  : "^(us-\\w+)\\.(.*)$"
+    replace : "$1"
+    replaceSource : "$2"
+
+  - rule    : limit-path
+    action  : limitLength
+    scope   : path
+    actionSubtype : truncateWithEllipsis
+    maxLength : 8
+
+  - rule    : only-foo
+    action  : whitelistRegex
+    scope   : metricName
+    match   : "foo\\..*"
+
+'2878, 4242':
+  - rule    : drop-long-dir
+    action  : limitLength
+    scope   : dir
+    actionSubtype : drop
+    maxLength : 4
+`
+
+func loadTestRules(t *testing.T) map[int]*Preprocessor {
+	preprocessors, err := Load([]byte(testRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preprocessors.ports) != 2 {
+		t.Fatalf("expected 2 preprocessors, found %d", len(preprocessors.ports))
+	}
+	return preprocessors.ports
+}
+
+func TestPointLineRules(t *testing.T) {
+	p := loadTestRules(t)[2878]
+	if !p.HasPointLineRules() {
+		t.Fatal("expected point line rules")
+	}
+
+	line, err := p.ForPointLine("foo.metric&x 1 source=a")
+	if err != nil || line != "foo.metric_x 1 source=a" {
+		t.Errorf("unexpected result %q, %v", line, err)
+	}
+
+	_, err = p.ForPointLine("foo.blockme 1 source=a")
+	if rejected, ok := err.(*RejectedError); !ok || rejected.Rule != "block-test" {
+		t.Errorf("expected rejection by block-test, found %v", err)
+	}
+	if count := p.lineRules[1].(*filterRule).hits.Count(); count != 1 {
+		t.Errorf("expected 1 hit, found %d", count)
+	}
+}
+
+func TestPointRules(t *testing.T) {
+	p := loadTestRules(t)[2878]
+	pt := &common.Point{
+		Name:   "US-West.FOO.Metric",
+		Source: "host",
+		Tags: map[string]string{
+			"az":          "dev-1",
+			"ab":          "prod",
+			"environment": "prod",
+			"path":        "/var/lib/data",
+			"dir":         "/tmp",
+		},
+	}
+
+	if err := p.ForPoint(pt); err != nil {
+		t.Fatal(err)
+	}
+	if pt.Name != "foo.metric" {
+		t.Errorf("unexpected metric name %s", pt.Name)
+	}
+
+	expected := map[string]string{
+		"ab":     "prod",
+		"dc":     "default",
+		"env":    "prod",
+		"region": "us-west",
+		"path":   "/var/...",
+		"dir":    "/tmp",
+	}
+	if len(pt.Tags) != len(expected) {
+		t.Errorf("expected tags %v, found %v", expected, pt.Tags)
+	}
+	for k, v := range expected {
+		if pt.Tags[k] != v {
+			t.Errorf("expected %s=%s, found %q", k, v, pt.Tags[k])
+		}
+	}
+
+	pt = &common.Point{Name: "bar.metric", Source: "host"}
+	if err := p.ForPoint(pt); err == nil {
+		t.Error("expected point to be rejected by whitelist")
+	}
+}
+
+func TestSharedPortRules(t *testing.T) {
+	p := loadTestRules(t)[4242]
+	if p.HasPointLineRules() {
+		t.Error("unexpected point line rules")
+	}
+
+	pt := &common.Point{Name: "Bar", Tags: map[string]string{"dir": "/var/tmp"}}
+	if err := p.ForPoint(pt); err != nil {
+		t.Fatal(err)
+	}
+	if pt.Name != "bar" {
+		t.Errorf("expected global rule to apply, found %s", pt.Name)
+	}
+	if _, ok := pt.Tags["dir"]; ok {
+		t.Error("expected dir tag to be dropped")
+	}
+}
+
+func TestGlobalOnlyRules(t *testing.T) {
+	preprocessors, err := Load([]byte("global:\n  - rule: lowercase-name\n    action: forceLowercase\n    scope: metricName"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := preprocessors.For(2003)
+	if err != nil || p == nil {
+		t.Fatalf("expected a preprocessor, found %v, %v", p, err)
+	}
+	pt := &common.Point{Name: "Foo"}
+	if err := p.ForPoint(pt); err != nil || pt.Name != "foo" {
+		t.Errorf("expected global rule to apply, found %s, %v", pt.Name, err)
+	}
+	if count := p.pointRules[0].(*forceLowercaseRule).hits.Count(); count != 1 {
+		t.Errorf("expected 1 hit, found %d", count)
+	}
+
+	if p, err := (*Preprocessors)(nil).For(2878); p != nil || err != nil {
+		t.Errorf("expected no preprocessor without rules, found %v, %v", p, err)
+	}
+}
+
+func TestLimitLengthRunes(t *testing.T) {
+	p, err := New(t.Name(), []RuleConfig{
+		{Rule: "limit-name", Action: "limitLength", Scope: "metricName", ActionSubtype: "truncate", MaxLength: 2},
+		{Rule: "limit-city", Action: "limitLength", Scope: "city", ActionSubtype: "truncateWithEllipsis", MaxLength: 5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// é and ü are 2 bytes, cut in the middle by a byte limit
+	pt := &common.Point{Name: "métrique", Tags: map[string]string{"city": "Zürich-Süd"}}
+	if err := p.ForPoint(pt); err != nil {
+		t.Fatal(err)
+	}
+	if pt.Name != "m" || pt.Tags["city"] != "Z..." {
+		t.Errorf("expected truncation at a character boundary, found %q and %q", pt.Name, pt.Tags["city"])
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	invalidRules := []string{
+		"'2878':\n  - action: dropTag\n    tag: foo",
+		"'2878':\n  - rule: r1\n    action: unknown",
+		"'2878':\n  - rule: r1\n    action: replaceRegex\n    scope: metricName",
+		"'2878':\n  - rule: r1\n    action: replaceRegex\n    scope: metricName\n    search: \"(\"",
+		"'2878':\n  - rule: r1\n    action: forceLowercase\n    scope: pointLine",
+		"'2878':\n  - rule: r1\n    action: limitLength\n    scope: metricName\n    actionSubtype: drop\n    maxLength: 4",
+		"'2878':\n  - rule: r1\n    action: addTag\n    tag: foo\n    value: bar\n  - rule: r1\n    action: addTag\n    tag: foo\n    value: bar",
+		"'foo':\n  - rule: r1\n    action: addTag\n    tag: foo\n    value: bar",
+		"global:\n  - rule: r1\n    action: unknown",
+	}
+	for _, rules := range invalidRules {
+		if _, err := Load([]byte(rules)); err == nil {
+			t.Errorf("expected error for rules: %s", rules)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package preprocessor
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/wavefronthq/go-proxy/common"
+)
+
+const (
+	scopePointLine  = "pointLine"
+	scopeMetricName = "metricName"
+	scopeSourceName = "sourceName"
+
+	limitTruncate             = "truncate"
+	limitTruncateWithEllipsis = "truncateWithEllipsis"
+	limitDrop                 = "drop"
+
+	ellipsis = "..."
+)
+
+// Interface for rules applied to the raw point line before it is decoded.
+type lineRule interface {
+	name() string
+	// applyLine returns the transformed line and false if the line should be rejected.
+	applyLine(line string) (string, bool)
+}
+
+// Interface for rules applied to decoded points.
+type pointRule interface {
+	name() string
+	// apply transforms the point in place and returns false if the point should be rejected.
+	apply(pt *common.Point) bool
+}
+
+// Common state shared by all rules.
+type baseRule struct {
+	ruleName string
+	hits     metrics.Counter
+}
+
+func (r *baseRule) name() string {
+	return r.ruleName
+}
+
+// matches returns true if pattern is nil or matches s.
+func matches(pattern *regexp.Regexp, s string) bool {
+	return pattern == nil || pattern.MatchString(s)
+}
+
+// getScope returns the value of the metric name, source or a point tag.
+func getScope(pt *common.Point, scope string) (string, bool) {
+	switch scope {
+	case scopeMetricName:
+		return pt.Name, true
+	case scopeSourceName:
+		return pt.Source, true
+	}
+	v, ok := pt.Tags[scope]
+	return v, ok
+}
+
+func setScope(pt *common.Point, scope, value string) {
+	switch scope {
+	case scopeMetricName:
+		pt.Name = value
+	case scopeSourceName:
+		pt.Source = value
+	default:
+		setTag(pt, scope, value)
+	}
+}
+
+func setTag(pt *common.Point, k, v string) {
+	if pt.Tags == nil {
+		pt.Tags = make(map[string]string)
+	}
+	pt.Tags[k] = v
+}
+
+// Replaces every match of a regex in the scope.
+type replaceRegexRule struct {
+	baseRule
+	scope      string
+	search     *regexp.Regexp
+	replace    string
+	match      *regexp.Regexp
+	iterations int
+}
+
+func (r *replaceRegexRule) replaceAll(s string) (string, bool) {
+	if !matches(r.match, s) {
+		return s, false
+	}
+	replaced := false
+	for i := 0; i < r.iterations && r.search.MatchString(s); i++ {
+		s = r.search.ReplaceAllString(s, r.replace)
+		replaced = true
+	}
+	return s, replaced
+}
+
+func (r *replaceRegexRule) applyLine(line string) (string, bool) {
+	line, replaced := r.replaceAll(line)
+	if replaced {
+		r.hits.Inc(1)
+	}
+	return line, true
+}
+
+func (r *replaceRegexRule) apply(pt *common.Point) bool {
+	v, ok := getScope(pt, r.scope)
+	if !ok {
+		return true
+	}
+	if v, replaced := r.replaceAll(v); replaced {
+		setScope(pt, r.scope, v)
+		r.hits.Inc(1)
+	}
+	return true
+}
+
+// Lowercases the scope.
+type forceLowercaseRule struct {
+	baseRule
+	scope string
+	match *regexp.Regexp
+}
+
+func (r *forceLowercaseRule) apply(pt *common.Point) bool {
+	v, ok := getScope(pt, r.scope)
+	if !ok || !matches(r.match, v) {
+		return true
+	}
+	if lower := strings.ToLower(v); lower != v {
+		setScope(pt, r.scope, lower)
+		r.hits.Inc(1)
+	}
+	return true
+}
+
+// Adds a point tag, optionally only if it is not already present.
+type addTagRule struct {
+	baseRule
+	tag         string
+	value       string
+	onlyMissing bool
+}
+
+func (r *addTagRule) apply(pt *common.Point) bool {
+	if _, ok := pt.Tags[r.tag]; ok && r.onlyMissing {
+		return true
+	}
+	setTag(pt, r.tag, r.value)
+	r.hits.Inc(1)
+	return true
+}
+
+// Drops point tags whose key matches a regex and, optionally, whose value matches another.
+type dropTagRule struct {
+	baseRule
+	tag   *regexp.Regexp
+	match *regexp.Regexp
+}
+
+func (r *dropTagRule) apply(pt *common.Point) bool {
+	for k, v := range pt.Tags {
+		if r.tag.MatchString(k) && matches(r.match, v) {
+			delete(pt.Tags, k)
+			r.hits.Inc(1)
+		}
+	}
+	return true
+}
+
+// Renames a point tag, optionally only if its value matches a regex.
+type renameTagRule struct {
+	baseRule
+	tag    string
+	newTag string
+	match  *regexp.Regexp
+}
+
+func (r *renameTagRule) apply(pt *common.Point) bool {
+	v, ok := pt.Tags[r.tag]
+	if !ok || !matches(r.match, v) {
+		return true
+	}
+	delete(pt.Tags, r.tag)
+	pt.Tags[r.newTag] = v
+	r.hits.Inc(1)
+	return true
+}
+
+// Creates a point tag from the first match of a regex in the source scope,
+// optionally rewriting the source scope afterwards.
+type extractTagRule struct {
+	baseRule
+	tag           string
+	source        string
+	search        *regexp.Regexp
+	replace       string
+	replaceSource string
+	match         *regexp.Regexp
+}
+
+func (r *extractTagRule) apply(pt *common.Point) bool {
+	v, ok := getScope(pt, r.source)
+	if !ok || !matches(r.match, v) {
+		return true
+	}
+	submatches := r.search.FindStringSubmatchIndex(v)
+	if submatches == nil {
+		return true
+	}
+	setTag(pt, r.tag, string(r.search.ExpandString(nil, r.replace, v, submatches)))
+	if r.replaceSource != "" {
+		setScope(pt, r.source, r.search.ReplaceAllString(v, r.replaceSource))
+	}
+	r.hits.Inc(1)
+	return true
+}
+
+// Enforces a maximum length for the scope by truncating it or, for point tags, dropping the tag.
+type limitLengthRule struct {
+	baseRule
+	scope     string
+	subtype   string
+	maxLength int
+	match     *regexp.Regexp
+}
+
+func (r *limitLengthRule) apply(pt *common.Point) bool {
+	v, ok := getScope(pt, r.scope)
+	if !ok || len(v) <= r.maxLength || !matches(r.match, v) {
+		return true
+	}
+	switch r.subtype {
+	case limitDrop:
+		delete(pt.Tags, r.scope)
+	case limitTruncateWithEllipsis:
+		setScope(pt, r.scope, common.Truncate(v, r.maxLength-len(ellipsis))+ellipsis)
+	default:
+		setScope(pt, r.scope, common.Truncate(v, r.maxLength))
+	}
+	r.hits.Inc(1)
+	return true
+}
+
+// Rejects points whose scope matches (blacklist) or does not match (whitelist) a regex.
+type filterRule struct {
+	baseRule
+	scope     string
+	match     *regexp.Regexp
+	whitelist bool
+}
+
+func (r *filterRule) accept(s string, present bool) bool {
+	if (present && r.match.MatchString(s)) == r.whitelist {
+		return true
+	}
+	r.hits.Inc(1)
+	return false
+}
+
+func (r *filterRule) applyLine(line string) (string, bool) {
+	return line, r.accept(line, true)
+}
+
+func (r *filterRule) apply(pt *common.Point) bool {
+	v, ok := getScope(pt, r.scope)
+	return r.accept(v, ok)
+}
@@ -0,0 +1,160 @@
+package points
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/wavefronthq/go-proxy/api"
+)
+
+const queuedFlushInterval = time.Second
+
+// Outcome of posting a batch.
+type postResult int
+
+const (
+	postSent postResult = iota
+	// put back in the buffer to be retried
+	postRetry
+	// dropped since the server will never accept them
+	postRejected
+)
+
+// Buffers the items received by a listener, such as events, and posts them in batches every second,
+// in the order received. A batch which may succeed later is retried ahead of the following items, and
+// the oldest items are dropped when the buffer is full.
+type queuedForwarder struct {
+	batchSize  int
+	bufferSize int
+	// posts a batch and returns postSent, postRetry or postRejected
+	post func(batch []interface{}) postResult
+
+	mtx      sync.Mutex
+	items    []interface{}
+	done     chan struct{}
+	exited   chan struct{}
+	stopOnce sync.Once
+	sent     metrics.Counter
+	dropped  metrics.Counter
+}
+
+// newQueuedForwarder starts a forwarder whose sent and dropped counters are named prefix.sent and
+// prefix.dropped.
+func newQueuedForwarder(prefix string, batchSize, bufferSize int, post func(batch []interface{}) postResult) *queuedForwarder {
+	f := &queuedForwarder{
+		batchSize:  batchSize,
+		bufferSize: bufferSize,
+		post:       post,
+		done:       make(chan struct{}),
+		exited:     make(chan struct{}),
+		sent:       metrics.GetOrRegisterCounter(prefix+".sent", nil),
+		dropped:    metrics.GetOrRegisterCounter(prefix+".dropped", nil),
+	}
+	go f.run()
+	return f
+}
+
+func (f *queuedForwarder) add(item interface{}) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.items = append(f.items, item)
+	if overflow := len(f.items) - f.bufferSize; overflow > 0 {
+		f.items = f.items[overflow:]
+		f.dropped.Inc(int64(overflow))
+	}
+}
+
+func (f *queuedForwarder) run() {
+	defer close(f.exited)
+	ticker := time.NewTicker(queuedFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			f.flush()
+		case <-f.done:
+			return
+		}
+	}
+}
+
+// stop stops the periodic flushes, it may be called more than once.
+func (f *queuedForwarder) stop() {
+	f.stopOnce.Do(func() {
+		close(f.done)
+	})
+}
+
+// drain stops the periodic flushes and then posts the buffered items until none are left or the
+// deadline has passed. Returns the number of items sent and the number dropped.
+func (f *queuedForwarder) drain(deadline time.Time) (flushed, dropped int64) {
+	f.stop()
+	<-f.exited
+
+	for time.Now().Before(deadline) {
+		sent, done := f.flush()
+		flushed += sent
+		if done {
+			break
+		}
+		wait := time.Until(deadline)
+		if wait > drainRetryInterval {
+			wait = drainRetryInterval
+		}
+		time.Sleep(wait)
+	}
+
+	f.mtx.Lock()
+	dropped = int64(len(f.items))
+	f.items = nil
+	f.mtx.Unlock()
+	f.dropped.Inc(dropped)
+	return flushed, dropped
+}
+
+// flush posts batches until the buffer is empty or a batch has to be retried. Returns the number of
+// items sent and true if the buffer was emptied.
+func (f *queuedForwarder) flush() (int64, bool) {
+	var sent int64
+	for {
+		batch := f.getBatch()
+		if len(batch) == 0 {
+			return sent, true
+		}
+		switch f.post(batch) {
+		case postSent:
+			f.sent.Inc(int64(len(batch)))
+			sent += int64(len(batch))
+		case postRetry:
+			f.mtx.Lock()
+			f.items = append(batch, f.items...)
+			f.mtx.Unlock()
+			return sent, false
+		case postRejected:
+			f.dropped.Inc(int64(len(batch)))
+		}
+	}
+}
+
+func (f *queuedForwarder) getBatch() []interface{} {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	batch := f.items[:min(len(f.items), f.batchSize)]
+	f.items = f.items[len(batch):]
+	return batch
+}
+
+// postOutcome classifies the response to a post. Errors, server errors, throttling and 406 (the
+// server not accepting data for now) are retried, other client errors are rejected.
+func postOutcome(resp *http.Response, err error) postResult {
+	switch {
+	case err != nil || resp.StatusCode >= http.StatusInternalServerError ||
+		resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == api.NotAcceptableStatusCode:
+		return postRetry
+	case resp.StatusCode >= http.StatusBadRequest:
+		return postRejected
+	}
+	return postSent
+}
@@ -0,0 +1,40 @@
+package points
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueuedForwarder(t *testing.T) {
+	var posted [][]interface{}
+	results := []postResult{postRetry, postRejected, postSent}
+	f := newQueuedForwarder(t.Name(), 2, 4, func(batch []interface{}) postResult {
+		posted = append(posted, batch)
+		result := results[0]
+		results = results[1:]
+		return result
+	})
+	for i := 0; i < 5; i++ {
+		f.add(i)
+	}
+	if f.dropped.Count() != 1 {
+		t.Errorf("expected the oldest item to be dropped, found %d dropped", f.dropped.Count())
+	}
+
+	if sent, done := f.flush(); sent != 0 || done {
+		t.Errorf("expected the first post to fail, found %d sent", sent)
+	}
+	// stopped twice, as Stop following Shutdown does
+	f.stop()
+	flushed, dropped := f.drain(time.Now().Add(time.Second))
+	if flushed != 2 || dropped != 0 {
+		t.Errorf("expected 2 items flushed, found %d flushed and %d dropped", flushed, dropped)
+	}
+	if len(posted) != 3 || posted[0][0] != 1 || posted[1][0] != 1 || posted[2][0] != 3 {
+		t.Errorf("expected the retried batch to be posted again, found %v", posted)
+	}
+	if f.sent.Count() != 2 || f.dropped.Count() != 3 {
+		t.Errorf("unexpected sent count %d and dropped count %d", f.sent.Count(), f.dropped.Count())
+	}
+	f.stop()
+}
@@ -0,0 +1,78 @@
+package points
+
+import (
+	"bufio"
+	"errors"
+	"io"
+
+	"github.com/wavefronthq/go-proxy/config"
+)
+
+const (
+	// Number of leading bytes of a discarded line kept for logging.
+	maxDiscardedPrefix = 256
+)
+
+var (
+	ErrLineTooLong = errors.New("line too long")
+)
+
+// Reads newline delimited lines from a stream, discarding lines that exceed a maximum length
+// without giving up on the rest of the stream.
+type lineReader struct {
+	r      *bufio.Reader
+	maxLen int
+}
+
+func newLineReader(r io.Reader, maxLen int) *lineReader {
+	if maxLen <= 0 {
+		maxLen = config.DefaultMaxReceivedLength
+	}
+	// leave room for the trailing "\r\n"
+	return &lineReader{r: bufio.NewReaderSize(r, maxLen+2), maxLen: maxLen}
+}
+
+// readLine returns the next line without the trailing newline.
+// The returned slice is only valid until the next call to readLine.
+// If the line exceeds the maximum length, the remainder of the line is discarded and
+// ErrLineTooLong is returned along with a copy of the leading part of the line.
+func (lr *lineReader) readLine() ([]byte, error) {
+	line, err := lr.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		prefix := append([]byte(nil), line[:min(maxDiscardedPrefix, lr.maxLen)]...)
+		return prefix, lr.discardLine()
+	}
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		return nil, err
+	}
+
+	line = dropLineEnding(line)
+	if len(line) > lr.maxLen {
+		return line[:min(maxDiscardedPrefix, lr.maxLen)], ErrLineTooLong
+	}
+	return line, nil
+}
+
+// discards everything up to and including the next newline.
+func (lr *lineReader) discardLine() error {
+	for {
+		_, err := lr.r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		return ErrLineTooLong
+	}
+}
+
+func dropLineEnding(line []byte) []byte {
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line = line[:n-1]
+	}
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	return line
+}
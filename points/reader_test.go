@@ -0,0 +1,54 @@
+package points
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadLines(t *testing.T) {
+	input := "foo.metric 1 source=a\r\nfoo.metric 2 source=b\nfoo.metric 3 source=c"
+	expected := []string{"foo.metric 1 source=a", "foo.metric 2 source=b", "foo.metric 3 source=c"}
+
+	reader := newLineReader(strings.NewReader(input), 64)
+	for _, exp := range expected {
+		line, err := reader.readLine()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(line) != exp {
+			t.Errorf("expected %q, found %q", exp, line)
+		}
+	}
+
+	if _, err := reader.readLine(); err != io.EOF {
+		t.Errorf("expected EOF, found %v", err)
+	}
+}
+
+func TestReadLineTooLong(t *testing.T) {
+	longLine := "foo.metric 1 source=" + strings.Repeat("a", 1000)
+	input := "foo.metric 1 source=a\n" + longLine + "\nfoo.metric 2 source=b\n" + longLine
+
+	reader := newLineReader(strings.NewReader(input), 64)
+	expected := []struct {
+		line string
+		err  error
+	}{
+		{"foo.metric 1 source=a", nil},
+		{longLine[:64], ErrLineTooLong},
+		{"foo.metric 2 source=b", nil},
+		{longLine[:64], ErrLineTooLong},
+		{"", io.EOF},
+	}
+
+	for _, exp := range expected {
+		line, err := reader.readLine()
+		if err != exp.err {
+			t.Fatalf("expected error %v, found %v", exp.err, err)
+		}
+		if string(line) != exp.line {
+			t.Errorf("expected %q, found %q", exp.line, line)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package points
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/wavefronthq/go-proxy/api"
+	"github.com/wavefronthq/go-proxy/common"
+	"github.com/wavefronthq/go-proxy/logging"
+)
+
+const (
+	selfMetricsPrefix  = "~proxy."
+	selfMetricsHandler = "internal"
+)
+
+var selfMetricsPercentiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+// Reports the proxy's internal metrics as ~proxy.* points, sent through its own handler like any
+// other points. The listener port in a metric name becomes a port tag.
+type MetricsReporter struct {
+	Hostname string
+	AgentID  string
+	Interval time.Duration
+	// defaults to metrics.DefaultRegistry
+	Registry metrics.Registry
+	handler  PointHandler
+	done     chan struct{}
+}
+
+func (r *MetricsReporter) Start(flushInterval, bufferSize, maxFlushSize int, format, workUnitId string, service api.WavefrontAPI) {
+	if r.Registry == nil {
+		r.Registry = metrics.DefaultRegistry
+	}
+	logging.Info("reporting internal metrics", "interval", r.Interval)
+	r.handler = &DefaultPointHandler{name: selfMetricsHandler}
+	r.handler.init(1, clampFlushInterval(flushInterval), bufferSize, maxFlushSize, format, workUnitId, service)
+	r.done = make(chan struct{})
+	go r.run()
+}
+
+func (r *MetricsReporter) run() {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.handler.reportPoints(r.points(time.Now()))
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// Shutdown reports the metrics a last time and flushes them until flushDeadline.
+func (r *MetricsReporter) Shutdown(flushDeadline time.Time) (flushed, dropped int64) {
+	close(r.done)
+	r.handler.reportPoints(r.points(time.Now()))
+	return r.handler.drain(flushDeadline)
+}
+
+// points converts the registry to points: counters and gauges become a single point, meters,
+// timers and histograms one point per statistic. Timer values are in milliseconds.
+func (r *MetricsReporter) points(now time.Time) []*common.Point {
+	timestamp := now.Unix()
+	pts := []*common.Point{r.point("heartbeat", "", 1, timestamp)}
+	add := func(name, port string, value float64) {
+		// statistics of empty samples
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return
+		}
+		pts = append(pts, r.point(name, port, value, timestamp))
+	}
+
+	r.Registry.Each(func(fullName string, i interface{}) {
+		name, port := common.SplitPort(fullName)
+		switch metric := i.(type) {
+		case metrics.Counter:
+			add(name, port, float64(metric.Count()))
+		case metrics.Gauge:
+			add(name, port, float64(metric.Value()))
+		case metrics.GaugeFloat64:
+			add(name, port, metric.Value())
+		case metrics.Meter:
+			meter := metric.Snapshot()
+			add(name+".count", port, float64(meter.Count()))
+			add(name+".m1", port, meter.Rate1())
+		case metrics.Timer:
+			timer := metric.Snapshot()
+			addStats(add, name, port, timer.Count(), float64(timer.Max()), timer.Mean(),
+				timer.Percentiles(selfMetricsPercentiles), 1e6)
+		case metrics.Histogram:
+			histo := metric.Snapshot()
+			addStats(add, name, port, histo.Count(), float64(histo.Max()), histo.Mean(),
+				histo.Percentiles(selfMetricsPercentiles), 1)
+		}
+	})
+	return pts
+}
+
+func addStats(add func(name, port string, value float64), name, port string, count int64, max, mean float64,
+	percentiles []float64, scale float64) {
+	add(name+".count", port, float64(count))
+	add(name+".max", port, max/scale)
+	add(name+".mean", port, mean/scale)
+	add(name+".median", port, percentiles[0]/scale)
+	add(name+".p75", port, percentiles[1]/scale)
+	add(name+".p95", port, percentiles[2]/scale)
+	add(name+".p99", port, percentiles[3]/scale)
+	add(name+".p999", port, percentiles[4]/scale)
+}
+
+func (r *MetricsReporter) point(name, port string, value float64, timestamp int64) *common.Point {
+	tags := map[string]string{"agentId": r.AgentID}
+	if port != "" {
+		tags["port"] = port
+	}
+	return &common.Point{
+		Name:      selfMetricsPrefix + name,
+		Value:     strconv.FormatFloat(value, 'f', -1, 64),
+		Timestamp: timestamp,
+		Source:    r.Hostname,
+		Tags:      tags,
+	}
+}
@@ -0,0 +1,46 @@
+package points
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/wavefronthq/go-proxy/common"
+)
+
+func TestReporterPoints(t *testing.T) {
+	registry := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("points.2878.received", registry).Inc(5)
+	metrics.GetOrRegisterTimer("push.2878.duration", registry).Update(20 * time.Millisecond)
+	metrics.GetOrRegisterGauge("build.version", registry).Update(4001)
+
+	r := &MetricsReporter{Hostname: "proxy-host", AgentID: "agent", Registry: registry}
+	now := time.Now()
+	pts := make(map[string]*common.Point)
+	for _, pt := range r.points(now) {
+		pts[pt.Name] = pt
+	}
+
+	for name, value := range map[string]string{
+		"~proxy.heartbeat":            "1",
+		"~proxy.points.received":      "5",
+		"~proxy.push.duration.count":  "1",
+		"~proxy.push.duration.median": "20",
+		"~proxy.build.version":        "4001",
+	} {
+		pt, ok := pts[name]
+		if !ok {
+			t.Errorf("missing point %s", name)
+			continue
+		}
+		if pt.Value != value || pt.Source != "proxy-host" || pt.Timestamp != now.Unix() || pt.Tags["agentId"] != "agent" {
+			t.Errorf("unexpected point %+v", pt)
+		}
+	}
+	if pts["~proxy.points.received"].Tags["port"] != "2878" {
+		t.Errorf("expected port tag, found %v", pts["~proxy.points.received"].Tags)
+	}
+	if _, ok := pts["~proxy.heartbeat"].Tags["port"]; ok {
+		t.Error("unexpected port tag on heartbeat")
+	}
+}
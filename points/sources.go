@@ -0,0 +1,74 @@
+package points
+
+import (
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/wavefronthq/go-proxy/api"
+	"github.com/wavefronthq/go-proxy/common"
+	"github.com/wavefronthq/go-proxy/logging"
+)
+
+const (
+	// operations buffered per listener, the oldest are dropped when updates keep failing
+	sourceBufferSize = 10000
+)
+
+// Counts the source tag and description commands received by a listener and hands them to its
+// forwarder, which applies them one at a time so that a retried operation stays ahead of the
+// following ones.
+type sourceHandler struct {
+	name      string
+	api       api.WavefrontAPI
+	forwarder *queuedForwarder
+	received  metrics.Counter
+	blocked   metrics.Counter
+}
+
+func newSourceHandler(name string, service api.WavefrontAPI) *sourceHandler {
+	h := &sourceHandler{
+		name:     name,
+		api:      service,
+		received: metrics.GetOrRegisterCounter("sources."+name+".received", nil),
+		blocked:  metrics.GetOrRegisterCounter("sources."+name+".blocked", nil),
+	}
+	h.forwarder = newQueuedForwarder("sources."+name, 1, sourceBufferSize, h.post)
+	return h
+}
+
+// reportSource queues an operation, split into one operation per tag to add or delete.
+func (h *sourceHandler) reportSource(op *common.SourceOperation) {
+	h.received.Inc(1)
+	for _, single := range op.Split() {
+		h.forwarder.add(single)
+	}
+}
+
+// handleBlockedSource counts a blocked command and logs it to the sampled blocked points log.
+func (h *sourceHandler) handleBlockedSource(line, client string, reason error) {
+	logging.LogBlockedPoint(h.name, client, line, reason)
+	h.blocked.Inc(1)
+}
+
+func (h *sourceHandler) stop() {
+	h.forwarder.stop()
+}
+
+func (h *sourceHandler) drain(deadline time.Time) (flushed, dropped int64) {
+	return h.forwarder.drain(deadline)
+}
+
+// post applies a batch of a single operation.
+func (h *sourceHandler) post(batch []interface{}) postResult {
+	op := batch[0].(*common.SourceOperation)
+	resp, err := h.api.UpdateSource(op)
+	result := postOutcome(resp, err)
+	switch {
+	case result == postRetry && err != nil:
+		logging.Warn("error updating source", "forwarder", h.name, "source", op.Source, "error", err)
+	case result == postRejected:
+		logging.Warn("source update rejected", "forwarder", h.name, "source", op.Source,
+			"type", op.Type, "action", op.Action, "status", resp.StatusCode)
+	}
+	return result
+}
@@ -0,0 +1,57 @@
+package points
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wavefronthq/go-proxy/common"
+)
+
+func TestProcessSources(t *testing.T) {
+	l := newTestListener(nil)
+	defer l.handler.stop()
+	service := &testAPI{}
+	l.sources.stop()
+	l.sources = newSourceHandler(t.Name(), service)
+
+	blocked, err := l.processLines(strings.NewReader("@SourceTag action=add source=app1 web prod\n"+
+		"@SourceTag action=add source=app1\n"+
+		`@SourceDescription action=save source=app1 description="Web server"`+"\n"+
+		"a.b 1 source=x\n"), "10.0.0.1:5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocked != 1 || l.sources.received.Count() != 2 || l.sources.blocked.Count() != 1 {
+		t.Errorf("expected 2 commands received and 1 blocked, found %d, %d and %d",
+			blocked, l.sources.received.Count(), l.sources.blocked.Count())
+	}
+
+	flushed, dropped := l.sources.drain(time.Now().Add(time.Second))
+	if flushed != 3 || dropped != 0 {
+		t.Fatalf("expected 3 operations to be flushed, found %d flushed and %d dropped", flushed, dropped)
+	}
+	// tags are added one at a time, in the order received
+	if service.sources[0].Tags[0] != "web" || service.sources[1].Tags[0] != "prod" ||
+		service.sources[2].Description != "Web server" {
+		t.Errorf("unexpected operations %+v %+v %+v", service.sources[0], service.sources[1], service.sources[2])
+	}
+}
+
+func TestSourceForwarderRetry(t *testing.T) {
+	service := &testAPI{failures: 1}
+	f := newSourceHandler(t.Name(), service).forwarder
+	f.add(&common.SourceOperation{Type: common.SourceTagType, Action: common.SourceActionSave, Source: "a"})
+	f.add(&common.SourceOperation{Type: common.SourceTagType, Action: common.SourceActionAdd, Source: "a", Tags: []string{"t"}})
+
+	if sent, done := f.flush(); sent != 0 || done {
+		t.Errorf("expected the first update to fail, found %d sent", sent)
+	}
+	if sent, done := f.flush(); sent != 2 || !done {
+		t.Errorf("expected both updates to be sent, found %d sent", sent)
+	}
+	if len(service.sources) != 2 || service.sources[0].Action != common.SourceActionSave || f.sent.Count() != 2 {
+		t.Errorf("expected the failed update to be retried first, found %+v", service.sources)
+	}
+	f.stop()
+}
@@ -0,0 +1,197 @@
+package points
+
+import (
+	"bytes"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wavefronthq/go-proxy/common"
+)
+
+// Outcome of a tapped point line.
+const (
+	TapAccepted  = "accepted"
+	TapBlocked   = "blocked"
+	TapRewritten = "rewritten"
+	// a rate or delta point derived from a cumulative counter on the line
+	TapDerived = "derived"
+
+	// events buffered per tap, events are dropped when a slow reader falls further behind
+	tapBufferSize = 1000
+)
+
+// Point line seen by a listener while a tap is attached.
+type TapEvent struct {
+	Time   time.Time `json:"time"`
+	Port   int       `json:"port"`
+	Client string    `json:"client,omitempty"`
+	Status string    `json:"status"`
+	Reason string    `json:"reason,omitempty"`
+	// the line as received, blocked lines are shown after the point line rules were applied
+	Line string `json:"line"`
+	// the point as reported after preprocessing, empty for blocked lines
+	Point string `json:"point,omitempty"`
+}
+
+// Selects the tapped point lines. Nil matchers match everything.
+type TapFilter struct {
+	Metric *regexp.Regexp
+	Source *regexp.Regexp
+	// tag key to value matcher, the point must have all of the keys
+	Tags map[string]*regexp.Regexp
+	// fraction of the matching lines to keep, 0 or 1 keeps all of them
+	SampleRate float64
+}
+
+// match returns true if a point with the given name, source and tags is tapped. Blocked lines which
+// could not be decoded only have a name, so they never match a source or tag filter.
+func (f *TapFilter) match(name, source string, tags map[string]string, decoded bool) bool {
+	if f.Metric != nil && !f.Metric.MatchString(name) {
+		return false
+	}
+	if f.Source != nil && (!decoded || !f.Source.MatchString(source)) {
+		return false
+	}
+	for key, re := range f.Tags {
+		value, ok := tags[key]
+		if !ok || !re.MatchString(value) {
+			return false
+		}
+	}
+	return f.SampleRate <= 0 || f.SampleRate >= 1 || rand.Float64() < f.SampleRate
+}
+
+// Stream of the point lines passing through a listener which match a filter.
+type Tap struct {
+	filter  *TapFilter
+	events  chan TapEvent
+	dropped int64
+	set     *tapSet
+	once    sync.Once
+}
+
+// Events returns the tapped lines. The channel is closed when the tap or its listener is closed.
+func (t *Tap) Events() <-chan TapEvent {
+	return t.events
+}
+
+// Dropped returns the number of events dropped because the reader fell behind.
+func (t *Tap) Dropped() int64 {
+	return atomic.LoadInt64(&t.dropped)
+}
+
+// Close detaches the tap from its listener.
+func (t *Tap) Close() {
+	t.set.remove(t)
+}
+
+// Taps attached to a listener. The count is checked for every line without locking, so an idle
+// listener only pays for an atomic load.
+type tapSet struct {
+	count int32
+	mtx   sync.RWMutex
+	taps  []*Tap
+}
+
+func (s *tapSet) active() bool {
+	return atomic.LoadInt32(&s.count) > 0
+}
+
+func (s *tapSet) add(filter *TapFilter) *Tap {
+	t := &Tap{filter: filter, events: make(chan TapEvent, tapBufferSize), set: s}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.taps = append(s.taps, t)
+	atomic.StoreInt32(&s.count, int32(len(s.taps)))
+	return t
+}
+
+func (s *tapSet) remove(t *Tap) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for i, tap := range s.taps {
+		if tap == t {
+			s.taps = append(s.taps[:i], s.taps[i+1:]...)
+			break
+		}
+	}
+	atomic.StoreInt32(&s.count, int32(len(s.taps)))
+	t.once.Do(func() { close(t.events) })
+}
+
+// closeAll closes every tap, ending their streams.
+func (s *tapSet) closeAll() {
+	s.mtx.Lock()
+	taps := s.taps
+	s.mtx.Unlock()
+	for _, t := range taps {
+		s.remove(t)
+	}
+}
+
+// publish sends an event to the matching taps without blocking. point is nil if the line could not
+// be decoded.
+func (s *tapSet) publish(event TapEvent, point *common.Point) {
+	name, source, tags := tapMetricName(event.Line), "", map[string]string(nil)
+	if point != nil {
+		name, source, tags = point.Name, point.Source, point.Tags
+	}
+	event.Time = time.Now()
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	for _, t := range s.taps {
+		if !t.filter.match(name, source, tags, point != nil) {
+			continue
+		}
+		select {
+		case t.events <- event:
+		default:
+			atomic.AddInt64(&t.dropped, 1)
+		}
+	}
+}
+
+// tapMetricName returns the leading metric name of a line which could not be decoded.
+func tapMetricName(line string) string {
+	line = strings.TrimSpace(line)
+	if end := strings.IndexAny(line, " \t"); end >= 0 {
+		line = line[:end]
+	}
+	if unquoted, err := strconv.Unquote(line); err == nil {
+		return unquoted
+	}
+	return line
+}
+
+// formatTapPoint formats a point in the wavefront format with sorted tags, so that points can be
+// compared before and after preprocessing.
+func formatTapPoint(point *common.Point) string {
+	var buf bytes.Buffer
+	buf.WriteString(strconv.Quote(point.Name))
+	buf.WriteByte(' ')
+	buf.WriteString(point.Value)
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatInt(point.Timestamp, 10))
+	buf.WriteString(" source=")
+	buf.WriteString(strconv.Quote(point.Source))
+
+	keys := make([]string, 0, len(point.Tags))
+	for k := range point.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.Quote(k))
+		buf.WriteByte('=')
+		buf.WriteString(strconv.Quote(point.Tags[k]))
+	}
+	return buf.String()
+}
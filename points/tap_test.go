@@ -0,0 +1,77 @@
+package points
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/wavefronthq/go-proxy/points/preprocessor"
+)
+
+func TestTapFilter(t *testing.T) {
+	filter := &TapFilter{
+		Metric: regexp.MustCompile(`^cpu\.`),
+		Tags:   map[string]*regexp.Regexp{"env": regexp.MustCompile("^prod$")},
+	}
+	if !filter.match("cpu.idle", "host", map[string]string{"env": "prod"}, true) {
+		t.Error("expected a match")
+	}
+	if filter.match("cpu.idle", "host", map[string]string{"env": "dev"}, true) ||
+		filter.match("cpu.idle", "host", nil, true) || filter.match("mem.free", "host", map[string]string{"env": "prod"}, true) {
+		t.Error("unexpected match")
+	}
+
+	filter = &TapFilter{Source: regexp.MustCompile("host")}
+	if filter.match("cpu.idle", "", nil, false) {
+		t.Error("expected an undecoded line not to match a source filter")
+	}
+}
+
+func TestTapEvents(t *testing.T) {
+	pp, err := preprocessor.New("2878", []preprocessor.RuleConfig{
+		{Rule: "block-test", Action: "blacklistRegex", Scope: "pointLine", Match: ".*blockme.*"},
+		{Rule: "add-dc", Action: "addTagIfNotExists", Tag: "dc", Value: "default"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newTestListener(pp)
+	defer l.handler.stop()
+
+	l.processLines(strings.NewReader("untapped 1 source=a dc=x\n"), "client")
+	tap := l.Tap(&TapFilter{Metric: regexp.MustCompile("^test")})
+	l.processLines(strings.NewReader(strings.Join([]string{
+		"test.kept 1 1533529977 source=a dc=x",
+		"test.tagged 1 1533529977 source=a",
+		"test.blockme 1 source=a",
+		"test.invalid",
+		"other.metric 1 source=a dc=x",
+	}, "\n")), "127.0.0.1:1234")
+	tap.Close()
+
+	var events []TapEvent
+	for event := range tap.Events() {
+		events = append(events, event)
+	}
+	expected := []struct{ status, line, point string }{
+		{TapAccepted, "test.kept 1 1533529977 source=a dc=x", `"test.kept" 1 1533529977 source="a" "dc"="x"`},
+		{TapRewritten, "test.tagged 1 1533529977 source=a", `"test.tagged" 1 1533529977 source="a" "dc"="default"`},
+		{TapBlocked, "test.blockme 1 source=a", ""},
+		{TapBlocked, "test.invalid", ""},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, found %+v", len(expected), events)
+	}
+	for i, e := range expected {
+		event := events[i]
+		if event.Status != e.status || event.Line != e.line || event.Point != e.point || event.Client != "127.0.0.1:1234" {
+			t.Errorf("expected %+v, found %+v", e, event)
+		}
+		if e.status == TapBlocked && event.Reason == "" {
+			t.Errorf("expected a reason for %+v", event)
+		}
+	}
+	if l.taps.active() {
+		t.Error("expected no active taps after close")
+	}
+}